@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"r-server/internal/mcp"
 
@@ -14,8 +15,52 @@ import (
 func main() {
 	// Parse command-line flags
 	testTool := flag.String("test-tool", "", "Path to a JSON file containing a tool request for testing")
+	renderMode := flag.String("render-mode", "image", "Default plot render mode (image, text, both); use text for clients without image support")
+	fontDirs := flag.String("font-dir", "", "Comma-separated directories of font files to register for plot rendering")
+	rmdDir := flag.String("rmd-dir", "rmd", "Directory for R Markdown files; rendered outputs go to its output subdirectory")
+	templateDir := flag.String("template-dir", "templates", "Directory of R Markdown and Quarto report templates")
+	dataDir := flag.String("data-dir", "data", "Directory for the datasets stored by upload_data")
+	catalog := flag.String("catalog", "catalog", "Dataset catalog: a directory of data files with an optional catalog.yaml manifest, or the path of a manifest")
+	databases := flag.String("databases", "", "Comma-separated name=path pairs of the SQLite (.sqlite, .db) and DuckDB (.duckdb) files that query_database can open")
+	bundleDir := flag.String("bundle-dir", "bundles", "Directory for the reproducibility bundles of tool calls")
+	timeout := flag.Duration("timeout", mcp.ExecutionTimeout, "Maximum run time of a single R script or document render (0 for no limit)")
 	flag.Parse()
 
+	if !mcp.IsRenderMode(*renderMode) {
+		fmt.Fprintf(os.Stderr, "Error: -render-mode must be image, text or both\n")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	mcp.DefaultRenderMode = *renderMode
+	mcp.RmdDir = *rmdDir
+	mcp.TemplateDir = *templateDir
+	mcp.DataDir = *dataDir
+	mcp.CatalogPath = *catalog
+	mcp.BundleDir = *bundleDir
+	mcp.ExecutionTimeout = *timeout
+
+	// Check the configured font directories
+	if *fontDirs != "" {
+		for _, dir := range strings.Split(*fontDirs, ",") {
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				fmt.Fprintf(os.Stderr, "Error: font directory %s does not exist\n", dir)
+				os.Exit(1)
+			}
+			mcp.FontDirs = append(mcp.FontDirs, dir)
+		}
+	}
+
+	// Parse the configured databases
+	if *databases != "" {
+		parsed, err := mcp.ParseDatabases(*databases)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		mcp.Databases = parsed
+	}
+
 	// If test-tool flag is provided, run the tool test
 	if *testTool != "" {
 	if err := mcp.TestTool(*testTool); err != nil {
@@ -0,0 +1,431 @@
+package mcp
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// BundleDir is the directory holding the reproducibility bundles
+var BundleDir = "bundles"
+
+// BundleOption is embedded in the arguments of every tool to offer a
+// reproducibility bundle of the call
+type BundleOption struct {
+	Bundle bool `json:"bundle,omitempty" jsonschema:"description=Also save a reproducibility bundle of this call as a zip resource with its R scripts and inputs and outputs"`
+}
+
+// bundleRequested reports whether the caller asked for a bundle
+func (o BundleOption) bundleRequested() bool {
+	return o.Bundle
+}
+
+// bundleable is implemented by tool arguments that embed BundleOption
+type bundleable interface {
+	bundleRequested() bool
+}
+
+// bundleSessionScript records the R session into the given directory at the
+// end of a bundled script. It runs in a local environment, so the code of the
+// script cannot see or overwrite the directory.
+const bundleSessionScript = `
+# Reproducibility bundle: record the R session
+local({
+  bundle_dir <- %s
+  writeLines(capture.output(sessionInfo()), file.path(bundle_dir, "sessionInfo.txt"))
+  packages <- sort(loadedNamespaces())
+  versions <- vapply(packages, function(p) as.character(utils::packageVersion(p)), "")
+  jsonlite::write_json(as.list(versions), file.path(bundle_dir, "packages.json"), auto_unbox = TRUE, pretty = TRUE)
+})
+`
+
+// bundleRun is a single R execution captured for a bundle
+type bundleRun struct {
+	Seed    int64
+	Files   map[string][]byte
+	Inputs  map[string]string
+	Capture string
+}
+
+// capturingExecutor records the scripts, inputs and outputs of the R
+// executions of a bundled tool call. Each script is run with a recorded random
+// seed and records its sessionInfo() and package versions when it finishes.
+type capturingExecutor struct {
+	inner RExecutor
+	runs  []*bundleRun
+}
+
+// ExecuteRScript captures the execution of a script by the wrapped executor
+func (e *capturingExecutor) ExecuteRScript(config RExecutionConfig) ([]byte, error) {
+	script, err := os.ReadFile(config.ScriptPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read R script: %w", err)
+	}
+
+	captureDir, err := os.MkdirTemp("", "bundle-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	run := &bundleRun{Seed: rand.Int63n(1 << 31), Files: make(map[string][]byte), Inputs: make(map[string]string), Capture: captureDir}
+	e.runs = append(e.runs, run)
+
+	// Fix the random seed up front and record the session at the end
+	script = []byte(fmt.Sprintf("# Reproducibility bundle: random seed\nset.seed(%d)\n%s\n%s",
+		run.Seed, script, fmt.Sprintf(bundleSessionScript, rQuote(captureDir))))
+	if err := os.WriteFile(config.ScriptPath, script, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write R script: %w", err)
+	}
+
+	// Everything next to the script before it runs is an input
+	jobDir := filepath.Dir(config.ScriptPath)
+	before, err := readTree(jobDir)
+	if err != nil {
+		return nil, err
+	}
+	for name, data := range before {
+		if name != filepath.Base(config.ScriptPath) {
+			run.Files["inputs/"+name] = data
+		}
+	}
+
+	// So are the files the tool reads from elsewhere. They are copied to
+	// inputs/external and the bundled script reads them from there.
+	captured := make(map[string]bool)
+	for _, path := range config.Inputs {
+		if captured[path] {
+			continue
+		}
+		captured[path] = true
+		name := "inputs/external/" + filepath.Base(path)
+		for i := 2; run.Inputs[name] != ""; i++ {
+			name = fmt.Sprintf("inputs/external/%d-%s", i, filepath.Base(path))
+		}
+		if err := captureInput(run.Files, name, path); err != nil {
+			return nil, err
+		}
+		run.Inputs[name] = path
+	}
+
+	// The archived script works relative to the run directory: it reads the
+	// inputs from their copies, writes the rest of the job directory to
+	// outputs/ and records the session next to them
+	paths := map[string]string{jobDir: "outputs", captureDir: "."}
+	for name := range before {
+		if name != filepath.Base(config.ScriptPath) {
+			paths[filepath.Join(jobDir, filepath.FromSlash(name))] = "inputs/" + name
+		}
+	}
+	for name, path := range run.Inputs {
+		paths[path] = name
+	}
+	run.Files["script.R"] = []byte(rewritePaths(string(script), paths))
+
+	outputData, err := e.inner.ExecuteRScript(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything that appeared while it ran is an output
+	run.Files["outputs/"+filepath.Base(config.OutputPath)] = outputData
+	after, err := readTree(jobDir)
+	if err != nil {
+		return nil, err
+	}
+	for name, data := range after {
+		if _, ok := before[name]; !ok && name != filepath.Base(config.OutputPath) {
+			run.Files["outputs/"+name] = data
+		}
+	}
+
+	return outputData, nil
+}
+
+// cleanup removes the capture directories
+func (e *capturingExecutor) cleanup() {
+	for _, run := range e.runs {
+		os.RemoveAll(run.Capture)
+	}
+}
+
+// captureInput adds the file or directory at path to files under name
+func captureInput(files map[string][]byte, name string, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read input %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read input %s: %w", path, err)
+		}
+		files[name] = data
+		return nil
+	}
+
+	tree, err := readTree(path)
+	if err != nil {
+		return err
+	}
+	for rel, data := range tree {
+		files[name+"/"+rel] = data
+	}
+	return nil
+}
+
+// rewritePaths replaces the paths in a script, and the paths of files below
+// them, by their replacements. Paths are only replaced as a whole, so
+// /srv/data.rds does not touch /srv/data.rds.bak.
+func rewritePaths(script string, replacements map[string]string) string {
+	paths := make([]string, 0, len(replacements))
+	for path := range replacements {
+		paths = append(paths, path)
+	}
+	// Rewrite longer paths first so a directory does not take the files
+	// below it that have replacements of their own
+	sort.Slice(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+
+	for _, path := range paths {
+		original := strings.Trim(rQuote(path), `"`)
+		pattern := regexp.MustCompile(`(^|[^A-Za-z0-9._/-])` + regexp.QuoteMeta(original) + `($|[^A-Za-z0-9._-])`)
+		replacement := strings.ReplaceAll(strings.Trim(rQuote(replacements[path]), `"`), "$", "$$")
+		script = pattern.ReplaceAllString(script, "${1}"+replacement+"${2}")
+	}
+	return script
+}
+
+// readTree reads the files below a directory by slash separated relative path
+func readTree(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// bundling wraps a tool handler so callers can ask for a reproducibility
+// bundle of the call. A bundled call swaps DefaultExecutor for a capturing
+// one, so it runs exclusively; other calls share the lock.
+func bundling[T bundleable](s *MCPServer, tool string, handler func(T) (*mcp.ToolResponse, error)) func(T) (*mcp.ToolResponse, error) {
+	return func(args T) (*mcp.ToolResponse, error) {
+		if !args.bundleRequested() {
+			s.bundleMu.RLock()
+			defer s.bundleMu.RUnlock()
+			return handler(args)
+		}
+
+		s.bundleMu.Lock()
+		defer s.bundleMu.Unlock()
+
+		// Restore the executor even if the handler panics, while the lock is
+		// still held
+		capture := &capturingExecutor{inner: DefaultExecutor}
+		defer capture.cleanup()
+		DefaultExecutor = capture
+		defer func() { DefaultExecutor = capture.inner }()
+		response, err := handler(args)
+		if err != nil {
+			return nil, err
+		}
+
+		file, hash, err := writeBundle(tool, args, capture.runs, response)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.syncResources(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating resources: %v\n", err)
+		}
+
+		response.Content = append(response.Content, mcp.NewTextContent(
+			fmt.Sprintf("Reproducibility bundle: bundle:///%s (sha256 %s)", file, hash)))
+		return response, nil
+	}
+}
+
+// bundleManifest describes the contents of a bundle
+type bundleManifest struct {
+	Tool      string               `json:"tool"`
+	Created   string               `json:"created"`
+	Arguments any                  `json:"arguments"`
+	Runs      []bundleManifestRun  `json:"runs"`
+	Files     []bundleManifestFile `json:"files"`
+}
+
+// bundleManifestRun describes a captured R execution
+type bundleManifestRun struct {
+	Directory string            `json:"directory"`
+	Seed      int64             `json:"seed"`
+	Inputs    map[string]string `json:"inputs,omitempty"`
+}
+
+// bundleManifestFile is a file of the bundle with its SHA-256 hash
+type bundleManifestFile struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeBundle writes the zip bundle of a tool call to BundleDir and returns
+// its file name and SHA-256 hash
+func writeBundle(tool string, args any, runs []*bundleRun, response *mcp.ToolResponse) (string, string, error) {
+	files := make(map[string][]byte)
+
+	arguments, err := json.MarshalIndent(args, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode arguments: %w", err)
+	}
+	files["arguments.json"] = arguments
+
+	manifest := bundleManifest{Tool: tool, Created: time.Now().UTC().Format(time.RFC3339), Arguments: args}
+	for i, run := range runs {
+		dir := fmt.Sprintf("run-%d/", i+1)
+		manifest.Runs = append(manifest.Runs, bundleManifestRun{Directory: dir, Seed: run.Seed, Inputs: run.Inputs})
+		for name, data := range run.Files {
+			files[dir+name] = data
+		}
+		for _, name := range []string{"sessionInfo.txt", "packages.json"} {
+			if data, err := os.ReadFile(filepath.Join(run.Capture, name)); err == nil {
+				files[dir+name] = data
+			}
+		}
+	}
+
+	// Keep what the tool returned to the client as well
+	for i, c := range response.Content {
+		name := fmt.Sprintf("response/content-%d", i+1)
+		switch {
+		case c.TextContent != nil:
+			files[name+".txt"] = []byte(c.TextContent.Text)
+		case c.ImageContent != nil:
+			if data, err := base64.StdEncoding.DecodeString(c.ImageContent.Data); err == nil {
+				files[name+mimeExtension(c.ImageContent.MimeType)] = data
+			}
+		case c.EmbeddedResource != nil && c.EmbeddedResource.TextResourceContents != nil:
+			files[name+".txt"] = []byte(c.EmbeddedResource.TextResourceContents.Text)
+		case c.EmbeddedResource != nil && c.EmbeddedResource.BlobResourceContents != nil:
+			if data, err := base64.StdEncoding.DecodeString(c.EmbeddedResource.BlobResourceContents.Blob); err == nil {
+				files[name+".bin"] = data
+			}
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sums strings.Builder
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		hash := hex.EncodeToString(sum[:])
+		manifest.Files = append(manifest.Files, bundleManifestFile{Path: name, Size: len(files[name]), SHA256: hash})
+		fmt.Fprintf(&sums, "%s  %s\n", hash, name)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	entries := append([]string{"manifest.json", "SHA256SUMS"}, names...)
+	for _, name := range entries {
+		data := files[name]
+		switch name {
+		case "manifest.json":
+			data = manifestData
+		case "SHA256SUMS":
+			data = []byte(sums.String())
+		}
+		w, err := archive.Create(name)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to write bundle: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return "", "", fmt.Errorf("failed to write bundle: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return "", "", fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	hash := hex.EncodeToString(sum[:])
+	file := fmt.Sprintf("%s-%s-%s.zip", tool, time.Now().UTC().Format("20060102-150405"), hash[:8])
+	if err := os.MkdirAll(BundleDir, 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(BundleDir, file), buf.Bytes(), 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return file, hash, nil
+}
+
+// mimeExtension returns the file extension of an output MIME type
+func mimeExtension(mimeType string) string {
+	switch mimeType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpeg"
+	case "image/svg+xml":
+		return ".svg"
+	case "application/pdf":
+		return ".pdf"
+	default:
+		return ".bin"
+	}
+}
+
+// listBundleResources returns the bundles in BundleDir
+func listBundleResources() ([]workspaceResource, error) {
+	files, err := readDirFiles(BundleDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []workspaceResource
+	for name, modTime := range files {
+		if filepath.Ext(name) != ".zip" {
+			continue
+		}
+		resources = append(resources, workspaceResource{
+			URI:         "bundle:///" + name,
+			Name:        "Bundle: " + name,
+			Description: "Reproducibility bundle: " + name,
+			MimeType:    "application/zip",
+			Path:        filepath.Join(BundleDir, name),
+			ModTime:     modTime,
+		})
+	}
+	return resources, nil
+}
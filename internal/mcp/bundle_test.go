@@ -0,0 +1,216 @@
+package mcp
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupBundleDir points BundleDir at a temporary directory for the test
+func setupBundleDir(t *testing.T) string {
+	original := BundleDir
+	BundleDir = t.TempDir()
+	t.Cleanup(func() { BundleDir = original })
+	return BundleDir
+}
+
+// readZip returns the files of a zip archive by name
+func readZip(t *testing.T, path string) map[string]string {
+	archive, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer archive.Close()
+
+	files := make(map[string]string)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+	return files
+}
+
+// TestBundling tests that a bundled call writes the script, inputs, session and
+// outputs of its R executions to a zip resource
+func TestBundling(t *testing.T) {
+	setupSession(t)
+	setupRmdDir(t)
+	dir := setupBundleDir(t)
+
+	var tempDirs []string
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(script), "# Reproducibility bundle: random seed\nset.seed("))
+			assert.Contains(t, string(script), "sessionInfo()")
+			assert.Contains(t, string(script), "local({\n  bundle_dir <- ", "the capture directory is hidden from the code")
+			tempDirs = append(tempDirs, filepath.Dir(config.ScriptPath))
+
+			// Stand in for the session epilogue of the script
+			for _, line := range strings.Split(string(script), "\n") {
+				if captureDir, ok := strings.CutPrefix(strings.TrimSpace(line), "bundle_dir <- "); ok {
+					captureDir = strings.Trim(captureDir, `"`)
+					tempDirs = append(tempDirs, captureDir)
+					require.NoError(t, os.WriteFile(filepath.Join(captureDir, "sessionInfo.txt"), []byte("R version 4.3.3"), 0644))
+					require.NoError(t, os.WriteFile(filepath.Join(captureDir, "packages.json"), []byte(`{"base":"4.3.3"}`), 0644))
+				}
+			}
+			return []byte("[1] 2\nR script execution completed successfully!\n"), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	server := &MCPServer{Server: mcp.NewServer(nil)}
+	handler := bundling(server, "execute_r_script", ExecuteRScriptTool)
+
+	response, err := handler(RScriptArgs{Code: "1 + 1", BundleOption: BundleOption{Bundle: true}})
+	require.NoError(t, err)
+	assert.Same(t, mockExecutor, DefaultExecutor)
+
+	notice := response.Content[len(response.Content)-1].TextContent.Text
+	require.True(t, strings.HasPrefix(notice, "Reproducibility bundle: bundle:///execute_r_script-"), notice)
+	uri := strings.Fields(notice)[2]
+	file := strings.TrimPrefix(uri, "bundle:///")
+	assert.True(t, server.CheckResourceRegistered(uri))
+
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+	assert.Contains(t, notice, "(sha256 "+hex.EncodeToString(sum[:])+")")
+
+	files := readZip(t, filepath.Join(dir, file))
+	assert.JSONEq(t, `{"code": "1 + 1", "bundle": true}`, files["arguments.json"])
+	// The archived script runs from the run directory of the bundle
+	script := files["run-1/script.R"]
+	assert.Contains(t, script, `sink("outputs/output.txt")`)
+	assert.Contains(t, script, `job_dir <- "outputs"`)
+	assert.Contains(t, script, `parse(file = "inputs/code.R"`)
+	assert.Contains(t, script, `bundle_dir <- "."`)
+	require.Len(t, tempDirs, 2)
+	for _, tempDir := range tempDirs {
+		assert.NotContains(t, script, tempDir)
+	}
+	assert.Equal(t, "1 + 1", files["run-1/inputs/code.R"])
+	assert.Equal(t, "R version 4.3.3", files["run-1/sessionInfo.txt"])
+	assert.Equal(t, `{"base":"4.3.3"}`, files["run-1/packages.json"])
+	assert.Equal(t, "[1] 2\nR script execution completed successfully!\n", files["run-1/outputs/output.txt"])
+	assert.Contains(t, files["response/content-1.txt"], "[1] 2")
+
+	var manifest bundleManifest
+	require.NoError(t, json.Unmarshal([]byte(files["manifest.json"]), &manifest))
+	assert.Equal(t, "execute_r_script", manifest.Tool)
+	require.Len(t, manifest.Runs, 1)
+	assert.Contains(t, files["run-1/script.R"], "set.seed("+strconv.FormatInt(manifest.Runs[0].Seed, 10)+")")
+	for _, f := range manifest.Files {
+		sum := sha256.Sum256([]byte(files[f.Path]))
+		assert.Equal(t, hex.EncodeToString(sum[:]), f.SHA256, f.Path)
+		assert.Contains(t, files["SHA256SUMS"], f.SHA256+"  "+f.Path+"\n")
+	}
+}
+
+// TestBundlingPanic tests that the executor is restored when a bundled handler
+// panics
+func TestBundlingPanic(t *testing.T) {
+	setupBundleDir(t)
+	mockExecutor := &MockRExecutor{}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	handler := bundling(&MCPServer{}, "execute_r_script", func(args RScriptArgs) (*mcp.ToolResponse, error) {
+		panic("boom")
+	})
+	assert.Panics(t, func() { handler(RScriptArgs{Code: "1", BundleOption: BundleOption{Bundle: true}}) })
+	assert.Same(t, mockExecutor, DefaultExecutor)
+}
+
+// TestBundlingNotRequested tests that calls without a bundle are passed through
+func TestBundlingNotRequested(t *testing.T) {
+	dir := setupBundleDir(t)
+
+	handler := bundling(&MCPServer{}, "list_report_templates", func(args ListReportTemplatesArgs) (*mcp.ToolResponse, error) {
+		_, captured := DefaultExecutor.(*capturingExecutor)
+		assert.False(t, captured)
+		return mcp.NewToolResponse(mcp.NewTextContent("[]")), nil
+	})
+	response, err := handler(ListReportTemplatesArgs{})
+	require.NoError(t, err)
+	assert.Len(t, response.Content, 1)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// TestBundlingInputs tests that the files a tool reads from outside its job
+// directory are bundled and that the bundled script reads the copies
+func TestBundlingInputs(t *testing.T) {
+	catalog := setupCatalog(t)
+	setupDataDir(t)
+	dir := setupBundleDir(t)
+	path := filepath.Join(catalog, "extracts", "sales_2024.parquet")
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), rQuote(path))
+			return []byte(`{"rows": 120, "columns": []}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	handler := bundling(&MCPServer{Server: mcp.NewServer(nil)}, "describe_dataset", DescribeDataset)
+	response, err := handler(DescribeDatasetArgs{Name: "sales", BundleOption: BundleOption{Bundle: true}})
+	require.NoError(t, err)
+
+	notice := response.Content[len(response.Content)-1].TextContent.Text
+	files := readZip(t, filepath.Join(dir, strings.TrimPrefix(strings.Fields(notice)[2], "bundle:///")))
+	assert.Equal(t, "mock-parquet", files["run-1/inputs/external/sales_2024.parquet"])
+	assert.Contains(t, files["run-1/script.R"], `arrow::read_parquet("inputs/external/sales_2024.parquet")`)
+	assert.NotContains(t, files["run-1/script.R"], path)
+
+	var manifest bundleManifest
+	require.NoError(t, json.Unmarshal([]byte(files["manifest.json"]), &manifest))
+	require.Len(t, manifest.Runs, 1)
+	assert.Equal(t, map[string]string{"inputs/external/sales_2024.parquet": path}, manifest.Runs[0].Inputs)
+}
+
+// TestRewritePaths tests that only whole paths and the files below a
+// directory are rewritten
+func TestRewritePaths(t *testing.T) {
+	replacements := map[string]string{
+		"/srv/data/sales.rds": "inputs/external/sales.rds",
+		"/srv/reports":        "inputs/external/reports",
+		"/tmp/job-1":          "outputs",
+	}
+	script := `a <- readRDS("/srv/data/sales.rds")
+b <- readRDS("/srv/data/sales.rds.bak")
+c <- rmarkdown::render("/srv/reports/q1.Rmd")
+d <- list.files("/srv/reports")
+e <- list.files("/srv/reports2")
+cat("Output file path: /tmp/job-1/output.txt\n")
+`
+	assert.Equal(t, `a <- readRDS("inputs/external/sales.rds")
+b <- readRDS("/srv/data/sales.rds.bak")
+c <- rmarkdown::render("inputs/external/reports/q1.Rmd")
+d <- list.files("inputs/external/reports")
+e <- list.files("/srv/reports2")
+cat("Output file path: outputs/output.txt\n")
+`, rewritePaths(script, replacements))
+}
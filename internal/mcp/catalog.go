@@ -0,0 +1,469 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"gopkg.in/yaml.v3"
+)
+
+// CatalogPath is the dataset catalog: either a directory of data files with
+// an optional catalog.yaml manifest describing them, or the path of a
+// manifest file
+var CatalogPath = "catalog"
+
+// catalogManifest is the name of the manifest file in a catalog directory
+const catalogManifest = "catalog.yaml"
+
+// datasetReader is the R code reading a file of a dataset format into a data
+// frame, where %s stands for the quoted path and the reader options, and the R
+// package it needs beyond the ones installed with R
+type datasetReader struct {
+	Code    string
+	Package string
+}
+
+// datasetReaders maps the dataset formats to their readers
+var datasetReaders = map[string]datasetReader{
+	"csv":     {Code: `utils::read.csv(%s, stringsAsFactors = FALSE, check.names = FALSE, na.strings = c("", "NA"))`},
+	"tsv":     {Code: `utils::read.delim(%s, stringsAsFactors = FALSE, check.names = FALSE, na.strings = c("", "NA"))`},
+	"json":    {Code: `as.data.frame(jsonlite::fromJSON(%s), stringsAsFactors = FALSE)`},
+	"rds":     {Code: `readRDS(%s)`},
+	"parquet": {Code: `as.data.frame(arrow::read_parquet(%s))`, Package: "arrow"},
+	"feather": {Code: `as.data.frame(arrow::read_feather(%s))`, Package: "arrow"},
+	"arrow":   {Code: `as.data.frame(arrow::read_ipc_file(%s))`, Package: "arrow"},
+	"ipc":     {Code: `as.data.frame(arrow::read_ipc_file(%s))`, Package: "arrow"},
+	"xlsx":    {Code: `as.data.frame(readxl::read_excel(%s))`, Package: "readxl"},
+	"xls":     {Code: `as.data.frame(readxl::read_excel(%s))`, Package: "readxl"},
+}
+
+// isExcelFormat reports whether a dataset format is an Excel workbook, whose
+// reader takes a sheet and a range
+func isExcelFormat(format string) bool {
+	return format == "xlsx" || format == "xls"
+}
+
+// dataset is a dataset that R code can refer to by name, either from the
+// catalog or uploaded with upload_data
+type dataset struct {
+	Name        string          `json:"name" yaml:"name"`
+	Description string          `json:"description,omitempty" yaml:"description"`
+	Path        string          `json:"path" yaml:"path"`
+	Format      string          `json:"format" yaml:"format"`
+	Sheet       string          `json:"sheet,omitempty" yaml:"sheet"`
+	Range       string          `json:"range,omitempty" yaml:"range"`
+	Columns     []datasetColumn `json:"columns,omitempty" yaml:"columns"`
+	Source      string          `json:"source" yaml:"-"`
+	ModTime     time.Time       `json:"-" yaml:"-"`
+}
+
+// datasetColumn documents a column of a catalog dataset
+type datasetColumn struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+}
+
+// ListDatasetsArgs represents the arguments for listing the datasets
+type ListDatasetsArgs struct {
+	BundleOption
+}
+
+// DescribeDatasetArgs represents the arguments for describing a dataset
+type DescribeDatasetArgs struct {
+	Name string `json:"name" jsonschema:"required,description=Name of the dataset"`
+
+	BundleOption
+}
+
+// describeDatasetScript reads a dataset and summarizes its columns
+const describeDatasetScript = `
+df <- tryCatch(as.data.frame(read_dataset(), stringsAsFactors = FALSE), error = function(e) {
+  message("Error: failed to read dataset: ", conditionMessage(e))
+  quit(save = "no", status = 1)
+})
+jsonlite::write_json(list(
+  rows = nrow(df),
+  columns = lapply(names(df), function(n) {
+    x <- df[[n]]
+    present <- x[!is.na(x)]
+    list(
+      name = n,
+      type = class(x)[1],
+      missing = sum(is.na(x)),
+      example = if (length(present) > 0) format(present[[1]]) else ""
+    )
+  })
+), output_file, auto_unbox = TRUE, digits = NA)
+`
+
+// ListDatasets returns the catalog and uploaded datasets
+func ListDatasets(args ListDatasetsArgs) (*mcp.ToolResponse, error) {
+	datasets, err := listDatasets()
+	if err != nil {
+		return nil, err
+	}
+	if datasets == nil {
+		datasets = []dataset{}
+	}
+
+	data, err := json.MarshalIndent(datasets, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode datasets: %w", err)
+	}
+	return mcp.NewToolResponse(mcp.NewTextContent(string(data))), nil
+}
+
+// DescribeDataset reads a dataset and returns its documentation with the
+// number of rows and the type, missing values and an example of each column
+func DescribeDataset(args DescribeDatasetArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if args.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	d, err := findDataset(args.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newRJob("describe-dataset-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	scriptContent := fmt.Sprintf(`
+read_dataset <- function() %s
+output_file <- %s
+%s`, datasetReadCode(d), rQuote(job.Path("output.json")), describeDatasetScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{Inputs: []string{d.Path}})
+	if err != nil {
+		return nil, err
+	}
+
+	var summary struct {
+		Rows    int `json:"rows"`
+		Columns []struct {
+			Name    string `json:"name"`
+			Type    string `json:"type"`
+			Missing int    `json:"missing"`
+			Example string `json:"example"`
+		} `json:"columns"`
+	}
+	if err := json.Unmarshal(outputData, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse dataset summary: %w", err)
+	}
+
+	docs := make(map[string]string, len(d.Columns))
+	for _, column := range d.Columns {
+		docs[column.Name] = column.Description
+	}
+
+	type columnInfo struct {
+		Name        string `json:"name"`
+		Type        string `json:"type"`
+		Missing     int    `json:"missing"`
+		Example     string `json:"example"`
+		Description string `json:"description,omitempty"`
+	}
+	info := struct {
+		dataset
+		Rows    int          `json:"rows"`
+		Columns []columnInfo `json:"columns"`
+	}{dataset: d, Rows: summary.Rows, Columns: []columnInfo{}}
+	for _, column := range summary.Columns {
+		info.Columns = append(info.Columns, columnInfo{
+			Name:        column.Name,
+			Type:        column.Type,
+			Missing:     column.Missing,
+			Example:     column.Example,
+			Description: docs[column.Name],
+		})
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode dataset description: %w", err)
+	}
+	return mcp.NewToolResponse(mcp.NewTextContent(string(data))), nil
+}
+
+// catalogProblemOutput receives the warnings about catalog problems
+var catalogProblemOutput io.Writer = os.Stderr
+
+// reportedCatalogProblems holds the catalog problems already reported, so
+// each is reported once rather than on every tool call
+var (
+	reportedCatalogProblems   = make(map[string]bool)
+	reportedCatalogProblemsMu sync.Mutex
+)
+
+// reportCatalogProblem warns about a manifest or dataset that is skipped
+func reportCatalogProblem(format string, args ...any) {
+	problem := fmt.Sprintf(format, args...)
+	reportedCatalogProblemsMu.Lock()
+	defer reportedCatalogProblemsMu.Unlock()
+	if !reportedCatalogProblems[problem] {
+		reportedCatalogProblems[problem] = true
+		fmt.Fprintf(catalogProblemOutput, "Warning: %s\n", problem)
+	}
+}
+
+// loadCatalog returns the datasets of the catalog ordered by name: the ones
+// described in the manifest and the data files of a catalog directory that
+// the manifest does not mention, named after their file. Every tool that
+// binds the datasets loads the catalog, so a manifest that cannot be read and
+// invalid manifest entries are reported on stderr and skipped rather than
+// failing the tools.
+func loadCatalog() ([]dataset, error) {
+	info, err := os.Stat(CatalogPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		reportCatalogProblem("failed to read catalog, its datasets are skipped: %v", err)
+		return nil, nil
+	}
+
+	dir, manifest := CatalogPath, filepath.Join(CatalogPath, catalogManifest)
+	if !info.IsDir() {
+		dir, manifest = filepath.Dir(CatalogPath), CatalogPath
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, fmt.Errorf("failed to resolve catalog directory: %w", err)
+	}
+
+	var entries []dataset
+	var manifestTime time.Time
+	if data, err := os.ReadFile(manifest); err == nil {
+		var m struct {
+			Datasets []dataset `yaml:"datasets"`
+		}
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			reportCatalogProblem("failed to parse catalog manifest %s, its datasets are skipped: %v", manifest, err)
+		} else {
+			entries = m.Datasets
+		}
+		if info, err := os.Stat(manifest); err == nil {
+			manifestTime = info.ModTime()
+		}
+	} else if !os.IsNotExist(err) {
+		reportCatalogProblem("failed to read catalog manifest, its datasets are skipped: %v", err)
+	}
+
+	var datasets []dataset
+	seen := make(map[string]bool)
+	listed := make(map[string]bool)
+	for _, d := range entries {
+		if err := checkManifestEntry(&d, dir, seen); err != nil {
+			reportCatalogProblem("catalog manifest: %v; the dataset is skipped", err)
+			continue
+		}
+		seen[d.Name] = true
+		listed[d.Path] = true
+		d.Source = "catalog"
+		d.ModTime = manifestTime
+		if info, err := os.Stat(d.Path); err == nil && info.ModTime().After(d.ModTime) {
+			d.ModTime = info.ModTime()
+		}
+		datasets = append(datasets, d)
+	}
+
+	if info.IsDir() {
+		files, err := readDirFiles(dir)
+		if err != nil {
+			reportCatalogProblem("%v; the data files of the catalog directory are skipped", err)
+		}
+		for file, modTime := range files {
+			ext := filepath.Ext(file)
+			name := strings.TrimSuffix(file, ext)
+			format := strings.ToLower(strings.TrimPrefix(ext, "."))
+			path := filepath.Join(dir, file)
+			if _, ok := datasetReaders[format]; !ok || listed[path] || seen[name] || !isDatasetName(name) {
+				continue
+			}
+			seen[name] = true
+			datasets = append(datasets, dataset{Name: name, Path: path, Format: format, Source: "catalog", ModTime: modTime})
+		}
+	}
+
+	sort.Slice(datasets, func(i, j int) bool { return datasets[i].Name < datasets[j].Name })
+	return datasets, nil
+}
+
+// checkManifestEntry checks a dataset described in the manifest, resolving
+// its path against the catalog directory and its format from the extension
+func checkManifestEntry(d *dataset, dir string, seen map[string]bool) error {
+	if !isRIdentifier(d.Name) {
+		return fmt.Errorf("invalid dataset name: %q", d.Name)
+	}
+	if baseConstants[d.Name] {
+		return fmt.Errorf("dataset name %s would shadow the R constant", d.Name)
+	}
+	if seen[d.Name] {
+		return fmt.Errorf("dataset %s is listed more than once", d.Name)
+	}
+	if d.Path == "" {
+		return fmt.Errorf("dataset %s has no path", d.Name)
+	}
+	if !filepath.IsAbs(d.Path) {
+		d.Path = filepath.Join(dir, d.Path)
+	}
+	if d.Format == "" {
+		d.Format = strings.ToLower(strings.TrimPrefix(filepath.Ext(d.Path), "."))
+	}
+	if _, ok := datasetReaders[d.Format]; !ok {
+		return fmt.Errorf("dataset %s: unsupported format %q", d.Name, d.Format)
+	}
+	if (d.Sheet != "" || d.Range != "") && !isExcelFormat(d.Format) {
+		return fmt.Errorf("dataset %s: sheet and range can only be used with xlsx and xls files", d.Name)
+	}
+	return nil
+}
+
+// listDatasets returns the catalog datasets followed by the datasets uploaded
+// to DataDir, each ordered by name. An upload never hides a catalog dataset of
+// the same name.
+func listDatasets() ([]dataset, error) {
+	datasets, err := loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := readDirFiles(DataDir)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve data directory: %w", err)
+	}
+
+	catalog := make(map[string]bool, len(datasets))
+	for _, d := range datasets {
+		catalog[d.Name] = true
+	}
+
+	var uploads []dataset
+	for file, modTime := range files {
+		name, ok := strings.CutSuffix(file, ".rds")
+		if !ok || !isDatasetName(name) || catalog[name] {
+			continue
+		}
+		uploads = append(uploads, dataset{Name: name, Path: filepath.Join(dir, file), Format: "rds", Source: "upload", ModTime: modTime})
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].Name < uploads[j].Name })
+
+	return append(datasets, uploads...), nil
+}
+
+// findDataset returns the dataset with the given name
+func findDataset(name string) (dataset, error) {
+	datasets, err := listDatasets()
+	if err != nil {
+		return dataset{}, err
+	}
+	for _, d := range datasets {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return dataset{}, fmt.Errorf("dataset not found: %s", name)
+}
+
+// catalogDataset returns the catalog dataset with the given name, if any
+func catalogDataset(name string) (*dataset, error) {
+	datasets, err := loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	for i := range datasets {
+		if datasets[i].Name == name {
+			return &datasets[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// datasetReadCode returns the R expression reading a dataset. Formats whose
+// package is missing fail with an error naming the package.
+func datasetReadCode(d dataset) string {
+	reader := datasetReaders[d.Format]
+	options := rQuote(d.Path)
+	if d.Sheet != "" {
+		options += ", sheet = " + excelSheet(d.Sheet)
+	}
+	if d.Range != "" {
+		options += ", range = " + rQuote(d.Range)
+	}
+	code := fmt.Sprintf(reader.Code, options)
+	if reader.Package == "" {
+		return code
+	}
+	message := fmt.Sprintf("the %s package is needed to read %s data; install it with install.packages(%s)",
+		reader.Package, d.Format, rQuote(reader.Package))
+	return fmt.Sprintf("{ if (!requireNamespace(%s, quietly = TRUE)) stop(%s, call. = FALSE); %s }",
+		rQuote(reader.Package), rQuote(message), code)
+}
+
+// excelSheet returns the R value selecting a sheet of an Excel workbook:
+// its position when the sheet is given as a number, else its name
+func excelSheet(sheet string) string {
+	if n, err := strconv.Atoi(sheet); err == nil && n > 0 {
+		return strconv.Itoa(n)
+	}
+	return rQuote(sheet)
+}
+
+// listDatasetResources returns the datasets as dataset resources holding
+// their JSON description, ordered by URI
+func listDatasetResources() ([]workspaceResource, error) {
+	datasets, err := listDatasets()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []workspaceResource
+	for _, d := range datasets {
+		description := d.Description
+		if description == "" {
+			description = "Dataset: " + d.Name
+		}
+		resources = append(resources, workspaceResource{
+			URI:         "dataset:///" + d.Name,
+			Name:        "Dataset: " + d.Name,
+			Description: description,
+			MimeType:    "application/json",
+			Path:        d.Path,
+			ModTime:     d.ModTime,
+			Read:        datasetResource(d.Name),
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].URI < resources[j].URI })
+	return resources, nil
+}
+
+// datasetResource returns a function that describes a dataset as JSON when
+// the client requests its resource
+func datasetResource(name string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		d, err := findDataset(name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode dataset: %w", err)
+		}
+		return data, nil
+	}
+}
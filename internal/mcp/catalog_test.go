@@ -0,0 +1,216 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleCatalogManifest = `datasets:
+  - name: sales
+    description: Monthly sales by store
+    path: extracts/sales_2024.parquet
+    columns:
+      - name: store
+        description: Store number
+      - name: revenue
+        description: Revenue in EUR
+  - name: stores
+    path: /srv/shared/stores.txt
+    format: tsv
+`
+
+// setupCatalog points CatalogPath to a temporary catalog directory with a
+// manifest and a data file it does not mention
+func setupCatalog(t *testing.T) string {
+	original := CatalogPath
+	CatalogPath = t.TempDir()
+	t.Cleanup(func() { CatalogPath = original })
+
+	require.NoError(t, os.WriteFile(filepath.Join(CatalogPath, catalogManifest), []byte(sampleCatalogManifest), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(CatalogPath, "extracts"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(CatalogPath, "extracts", "sales_2024.parquet"), []byte("mock-parquet"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(CatalogPath, "regions.csv"), []byte("region\nnorth\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(CatalogPath, "README.md"), []byte("ignored"), 0644))
+	return CatalogPath
+}
+
+// TestListDatasets tests that the manifest, the catalog directory and the
+// uploads are listed
+func TestListDatasets(t *testing.T) {
+	dir := setupCatalog(t)
+	dataDir := setupDataDir(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "visits.rds"), []byte("mock-rds"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "sales.rds"), []byte("mock-rds"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "letters.rds"), []byte("mock-rds"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "LETTERS.csv"), []byte("a\n1\n"), 0644))
+
+	response, err := ListDatasets(ListDatasetsArgs{})
+	require.NoError(t, err)
+
+	var datasets []dataset
+	require.NoError(t, json.Unmarshal([]byte(response.Content[0].TextContent.Text), &datasets))
+	require.Len(t, datasets, 4)
+	assert.Equal(t, dataset{
+		Name:   "regions",
+		Path:   filepath.Join(dir, "regions.csv"),
+		Format: "csv",
+		Source: "catalog",
+	}, datasets[0])
+	assert.Equal(t, "sales", datasets[1].Name)
+	assert.Equal(t, "Monthly sales by store", datasets[1].Description)
+	assert.Equal(t, filepath.Join(dir, "extracts", "sales_2024.parquet"), datasets[1].Path)
+	assert.Equal(t, "parquet", datasets[1].Format)
+	assert.Len(t, datasets[1].Columns, 2)
+	assert.Equal(t, "/srv/shared/stores.txt", datasets[2].Path)
+	assert.Equal(t, "tsv", datasets[2].Format)
+	assert.Equal(t, "visits", datasets[3].Name)
+	assert.Equal(t, "upload", datasets[3].Source)
+
+	// Uploads cannot take the name of a catalog dataset
+	_, err = UploadData(UploadDataArgs{Name: "regions", Content: "region\nsouth\n"})
+	assert.EqualError(t, err, "name is used by the catalog dataset regions")
+
+	preamble, err := datasetPreamble()
+	require.NoError(t, err)
+	assert.Contains(t, preamble, `delayedAssign("sales", { if (!requireNamespace("arrow", quietly = TRUE))`)
+	assert.Contains(t, preamble, `delayedAssign("regions", utils::read.csv(`+rQuote(filepath.Join(dir, "regions.csv")))
+	assert.Contains(t, preamble, `delayedAssign("visits", readRDS(`)
+}
+
+// TestCatalogManifestFile tests a catalog configured as a manifest file
+func TestCatalogManifestFile(t *testing.T) {
+	dir := setupCatalog(t)
+	CatalogPath = filepath.Join(dir, catalogManifest)
+
+	datasets, err := loadCatalog()
+	require.NoError(t, err)
+	require.Len(t, datasets, 2)
+	assert.Equal(t, "sales", datasets[0].Name)
+	assert.Equal(t, "stores", datasets[1].Name)
+}
+
+// TestDatasetReadCode tests the R code reading each kind of dataset
+func TestDatasetReadCode(t *testing.T) {
+	assert.Equal(t, `readRDS("/srv/a.rds")`, datasetReadCode(dataset{Path: "/srv/a.rds", Format: "rds"}))
+	assert.Equal(t, `{ if (!requireNamespace("arrow", quietly = TRUE)) `+
+		`stop("the arrow package is needed to read feather data; install it with install.packages(\"arrow\")", call. = FALSE); `+
+		`as.data.frame(arrow::read_feather("/srv/a.feather")) }`, datasetReadCode(dataset{Path: "/srv/a.feather", Format: "feather"}))
+	assert.Contains(t, datasetReadCode(dataset{Path: "/srv/a.arrow", Format: "arrow"}), `arrow::read_ipc_file("/srv/a.arrow")`)
+	assert.Contains(t, datasetReadCode(dataset{Path: "/srv/a.xlsx", Format: "xlsx", Sheet: "Q1 budget", Range: "A1:D20"}),
+		`readxl::read_excel("/srv/a.xlsx", sheet = "Q1 budget", range = "A1:D20")`)
+	assert.Contains(t, datasetReadCode(dataset{Path: "/srv/a.xls", Format: "xls", Sheet: "3"}), `readxl::read_excel("/srv/a.xls", sheet = 3)`)
+}
+
+// TestCatalogManifestValidation tests that invalid manifest entries and
+// manifests are reported and skipped without failing the catalog
+func TestCatalogManifestValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		warning  string
+	}{
+		{"Bad name", "datasets:\n  - name: my data\n    path: a.csv\n", `catalog manifest: invalid dataset name: "my data"; the dataset is skipped`},
+		{"Constant name", "datasets:\n  - name: letters\n    path: a.csv\n", "catalog manifest: dataset name letters would shadow the R constant; the dataset is skipped"},
+		{"Duplicate name", "datasets:\n  - name: a\n    path: a.csv\n  - name: a\n    path: b.csv\n", "dataset a is listed more than once"},
+		{"No path", "datasets:\n  - name: a\n", "dataset a has no path"},
+		{"Bad format", "datasets:\n  - name: a\n    path: a.xml\n", `dataset a: unsupported format "xml"`},
+		{"Sheet of CSV", "datasets:\n  - name: a\n    path: a.csv\n    sheet: Budget\n", "dataset a: sheet and range can only be used with xlsx and xls files"},
+		{"Bad YAML", "datasets: [", "failed to parse catalog manifest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setupCatalog(t)
+			var warnings strings.Builder
+			catalogProblemOutput = &warnings
+			reportedCatalogProblems = make(map[string]bool)
+			t.Cleanup(func() { catalogProblemOutput = os.Stderr })
+			manifest := tt.manifest + "  - name: kept\n    path: extracts/sales_2024.parquet\n"
+			if tt.name == "Bad YAML" {
+				manifest = tt.manifest
+			}
+			require.NoError(t, os.WriteFile(filepath.Join(dir, catalogManifest), []byte(manifest), 0644))
+
+			datasets, err := loadCatalog()
+			require.NoError(t, err)
+			var names []string
+			for _, d := range datasets {
+				names = append(names, d.Name)
+			}
+			assert.Contains(t, names, "regions", "data files of the directory are still listed")
+			if tt.name != "Bad YAML" {
+				assert.Contains(t, names, "kept", "valid entries are still listed")
+			}
+			assert.Contains(t, warnings.String(), "Warning: ")
+			assert.Contains(t, warnings.String(), tt.warning)
+
+			// Each problem is reported once
+			_, err = loadCatalog()
+			require.NoError(t, err)
+			assert.Equal(t, 1, strings.Count(warnings.String(), tt.warning))
+		})
+	}
+}
+
+// TestDescribeDataset tests that the column summary is merged with the
+// column documentation of the catalog
+func TestDescribeDataset(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "read_dataset <- function() { if (!requireNamespace(\"arrow\"")
+			return []byte(`{"rows": 120, "columns": [
+				{"name": "store", "type": "character", "missing": 0, "example": "007"},
+				{"name": "month", "type": "Date", "missing": 3, "example": "2024-01-01"}
+			]}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := DescribeDataset(DescribeDatasetArgs{Name: "sales"})
+	require.NoError(t, err)
+
+	var info map[string]any
+	require.NoError(t, json.Unmarshal([]byte(response.Content[0].TextContent.Text), &info))
+	assert.Equal(t, "Monthly sales by store", info["description"])
+	assert.Equal(t, 120.0, info["rows"])
+	assert.Equal(t, []any{
+		map[string]any{"name": "store", "type": "character", "missing": 0.0, "example": "007", "description": "Store number"},
+		map[string]any{"name": "month", "type": "Date", "missing": 3.0, "example": "2024-01-01"},
+	}, info["columns"])
+
+	_, err = DescribeDataset(DescribeDatasetArgs{Name: "missing"})
+	assert.EqualError(t, err, "dataset not found: missing")
+	_, err = DescribeDataset(DescribeDatasetArgs{})
+	assert.EqualError(t, err, "name is required")
+}
+
+// TestDatasetResources tests that the datasets are exposed as JSON resources
+func TestDatasetResources(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+
+	resources, err := listDatasetResources()
+	require.NoError(t, err)
+	require.Len(t, resources, 3)
+	assert.Equal(t, "dataset:///regions", resources[0].URI)
+	assert.Equal(t, "Dataset: regions", resources[0].Description)
+	assert.Equal(t, "Monthly sales by store", resources[1].Description)
+
+	response, err := resources[1].handler()()
+	require.NoError(t, err)
+	resource := response.Contents[0].TextResourceContents
+	assert.Equal(t, "application/json", *resource.MimeType)
+	assert.Contains(t, resource.Text, `"description": "Store number"`)
+}
@@ -0,0 +1,393 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// CompareDatasetsArgs represents the arguments for comparing two datasets
+type CompareDatasetsArgs struct {
+	Before      string   `json:"before" jsonschema:"required,description=Name of the dataset holding the earlier version"`
+	After       string   `json:"after" jsonschema:"required,description=Name of the dataset holding the later version"`
+	Keys        []string `json:"keys" jsonschema:"required,description=Columns identifying a row in both datasets"`
+	Tolerance   float64  `json:"tolerance,omitempty" jsonschema:"description=Numeric cells differing by at most this much count as unchanged (default 0)"`
+	MaxExamples int      `json:"max_examples,omitempty" jsonschema:"description=Number of example rows listed for added; removed and changed rows each (default 10; maximum 100)"`
+
+	BundleOption
+}
+
+// datasetComparison is the difference between two versions of a dataset.
+// Added and removed rows are records of all their columns; the example lists
+// hold at most max_examples rows while the counts cover every row.
+type datasetComparison struct {
+	Before      comparedDataset   `json:"before"`
+	After       comparedDataset   `json:"after"`
+	Keys        []string          `json:"keys"`
+	Schema      schemaDiff        `json:"schema"`
+	Rows        rowDiff           `json:"rows"`
+	Columns     []columnDiff      `json:"columns"`
+	AddedRows   []json.RawMessage `json:"added_rows"`
+	RemovedRows []json.RawMessage `json:"removed_rows"`
+	ChangedRows []changedRow      `json:"changed_rows"`
+}
+
+// comparedDataset describes one side of a comparison
+type comparedDataset struct {
+	Name    string `json:"name"`
+	Rows    int    `json:"rows"`
+	Columns int    `json:"columns"`
+}
+
+// schemaDiff lists the columns only one side has and the columns whose type
+// changed
+type schemaDiff struct {
+	AddedColumns   []comparedColumn `json:"added_columns"`
+	RemovedColumns []comparedColumn `json:"removed_columns"`
+	TypeChanges    []typeChange     `json:"type_changes"`
+}
+
+// comparedColumn is a column with its R class
+type comparedColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// typeChange is a column whose R class differs between the datasets
+type typeChange struct {
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// rowDiff counts the rows by their state. Matched rows have a key found in
+// both datasets and are either changed or unchanged.
+type rowDiff struct {
+	Matched   int `json:"matched"`
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// columnDiff counts the changed cells of a column both datasets have
+type columnDiff struct {
+	Name    string `json:"name"`
+	Changed int    `json:"changed"`
+}
+
+// changedRow is a matched row with the cells that changed
+type changedRow struct {
+	Key     json.RawMessage `json:"key"`
+	Changes []cellChange    `json:"changes"`
+}
+
+// cellChange is the value of a cell in both datasets; null is a missing value
+type cellChange struct {
+	Column string          `json:"column"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// compareDatasetsScript matches the rows of both datasets by their keys and
+// compares the cells of the shared columns. Cells are compared as text unless
+// both are numeric, and a missing value only equals a missing value.
+const compareDatasetsScript = `
+read_side <- function(read, name) {
+  df <- tryCatch(as.data.frame(read(), stringsAsFactors = FALSE), error = function(e) {
+    message("Error: failed to read dataset ", name, ": ", conditionMessage(e))
+    quit(save = "no", status = 1)
+  })
+  missing <- setdiff(keys, names(df))
+  if (length(missing) > 0) {
+    message("Error: key column not found in ", name, ": ", paste(missing, collapse = ", "))
+    quit(save = "no", status = 1)
+  }
+  df
+}
+
+row_keys <- function(df, name) {
+  k <- do.call(paste, c(lapply(df[keys], as.character), sep = "\x1f"))
+  duplicated_key <- anyDuplicated(k)
+  if (duplicated_key > 0) {
+    message("Error: keys do not identify the rows of ", name, " uniquely; duplicate key: ",
+      gsub("\x1f", ", ", k[duplicated_key], fixed = TRUE))
+    quit(save = "no", status = 1)
+  }
+  k
+}
+
+column_type <- function(x) class(x)[1]
+
+cells_differ <- function(x, y) {
+  if (is.numeric(x) && is.numeric(y)) {
+    differ <- abs(x - y) > tolerance
+  } else {
+    differ <- as.character(x) != as.character(y)
+  }
+  differ[is.na(differ)] <- FALSE
+  differ | (is.na(x) != is.na(y))
+}
+
+cell <- function(x) if (is.factor(x)) as.character(x) else x
+
+before_df <- read_side(read_before, before_name)
+after_df <- read_side(read_after, after_name)
+before_keys <- row_keys(before_df, before_name)
+after_keys <- row_keys(after_df, after_name)
+
+matches <- match(after_keys, before_keys)
+after_rows <- which(!is.na(matches))
+before_rows <- matches[after_rows]
+added <- which(is.na(matches))
+removed <- which(is.na(match(before_keys, after_keys)))
+
+shared <- intersect(names(before_df), names(after_df))
+compared <- setdiff(shared, keys)
+changed <- lapply(compared, function(col) cells_differ(before_df[[col]][before_rows], after_df[[col]][after_rows]))
+names(changed) <- compared
+changed_any <- Reduce("|", changed, rep(FALSE, length(after_rows)))
+
+columns_of <- function(df, cols) lapply(cols, function(col) list(name = col, type = column_type(df[[col]])))
+type_changes <- Filter(Negate(is.null), lapply(shared, function(col) {
+  before_type <- column_type(before_df[[col]])
+  after_type <- column_type(after_df[[col]])
+  if (before_type != after_type) list(name = col, before = before_type, after = after_type)
+}))
+
+changed_rows <- lapply(utils::head(which(changed_any), max_examples), function(i) {
+  cols <- compared[vapply(compared, function(col) changed[[col]][i], TRUE)]
+  list(
+    key = lapply(as.list(after_df[after_rows[i], keys, drop = FALSE]), cell),
+    changes = lapply(cols, function(col) list(
+      column = col,
+      before = cell(before_df[[col]][before_rows[i]]),
+      after = cell(after_df[[col]][after_rows[i]])
+    ))
+  )
+})
+
+jsonlite::write_json(list(
+  before = list(rows = nrow(before_df), columns = ncol(before_df)),
+  after = list(rows = nrow(after_df), columns = ncol(after_df)),
+  schema = list(
+    added_columns = columns_of(after_df, setdiff(names(after_df), names(before_df))),
+    removed_columns = columns_of(before_df, setdiff(names(before_df), names(after_df))),
+    type_changes = type_changes
+  ),
+  rows = list(
+    matched = length(after_rows),
+    added = length(added),
+    removed = length(removed),
+    changed = sum(changed_any),
+    unchanged = length(after_rows) - sum(changed_any)
+  ),
+  columns = lapply(compared, function(col) list(name = col, changed = sum(changed[[col]]))),
+  added_rows = utils::head(after_df[added, , drop = FALSE], max_examples),
+  removed_rows = utils::head(before_df[removed, , drop = FALSE], max_examples),
+  changed_rows = changed_rows
+), output_file, auto_unbox = TRUE, digits = NA, na = "null", POSIXt = "ISO8601")
+`
+
+// CompareDatasets compares two versions of a dataset whose rows are
+// identified by key columns and returns the differences as JSON with a
+// markdown summary
+func CompareDatasets(args CompareDatasetsArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if args.Before == "" {
+		return nil, fmt.Errorf("before is required")
+	}
+	if args.After == "" {
+		return nil, fmt.Errorf("after is required")
+	}
+	if len(args.Keys) == 0 {
+		return nil, fmt.Errorf("keys are required")
+	}
+	seen := make(map[string]bool)
+	for _, key := range args.Keys {
+		if key == "" {
+			return nil, fmt.Errorf("key column name is required")
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("key %s is given more than once", key)
+		}
+		seen[key] = true
+	}
+	if args.Tolerance < 0 {
+		return nil, fmt.Errorf("tolerance cannot be negative")
+	}
+
+	maxExamples := args.MaxExamples
+	if maxExamples == 0 {
+		maxExamples = 10
+	} else if maxExamples < 1 || maxExamples > 100 {
+		return nil, fmt.Errorf("max_examples must be between 1 and 100")
+	}
+
+	before, err := findDataset(args.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := findDataset(args.After)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newRJob("compare-datasets-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	keys := make([]string, len(args.Keys))
+	for i, key := range args.Keys {
+		keys[i] = rQuote(key)
+	}
+	scriptContent := fmt.Sprintf(`
+read_before <- function() %s
+read_after <- function() %s
+before_name <- %s
+after_name <- %s
+keys <- c(%s)
+tolerance <- %s
+max_examples <- %d
+output_file <- %s
+%s`, datasetReadCode(before), datasetReadCode(after), rQuote(before.Name), rQuote(after.Name),
+		strings.Join(keys, ", "), formatRNumber(args.Tolerance), maxExamples,
+		rQuote(job.Path("output.json")), compareDatasetsScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{Inputs: []string{before.Path, after.Path}})
+	if err != nil {
+		return nil, err
+	}
+
+	var result datasetComparison
+	if err := json.Unmarshal(outputData, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse comparison: %w", err)
+	}
+	result.Before.Name = before.Name
+	result.After.Name = after.Name
+	result.Keys = args.Keys
+	if result.Schema.AddedColumns == nil {
+		result.Schema.AddedColumns = []comparedColumn{}
+	}
+	if result.Schema.RemovedColumns == nil {
+		result.Schema.RemovedColumns = []comparedColumn{}
+	}
+	if result.Schema.TypeChanges == nil {
+		result.Schema.TypeChanges = []typeChange{}
+	}
+	if result.Columns == nil {
+		result.Columns = []columnDiff{}
+	}
+	if result.AddedRows == nil {
+		result.AddedRows = []json.RawMessage{}
+	}
+	if result.RemovedRows == nil {
+		result.RemovedRows = []json.RawMessage{}
+	}
+	if result.ChangedRows == nil {
+		result.ChangedRows = []changedRow{}
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode comparison: %w", err)
+	}
+	return mcp.NewToolResponse(
+		mcp.NewTextContent(string(data)),
+		mcp.NewTextContent(comparisonSummary(result)),
+	), nil
+}
+
+// comparisonSummary describes a comparison in markdown: the changes of the
+// schema and the row counts, the changed cells per column and the changed
+// rows listed as examples
+func comparisonSummary(c datasetComparison) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Changes from %s to %s\n\n", c.Before.Name, c.After.Name)
+	fmt.Fprintf(&b, "Rows matched by %s: %d → %d; %d added, %d removed, %d changed, %d unchanged.\n",
+		strings.Join(c.Keys, ", "), c.Before.Rows, c.After.Rows, c.Rows.Added, c.Rows.Removed, c.Rows.Changed, c.Rows.Unchanged)
+
+	var schema []string
+	for _, column := range c.Schema.AddedColumns {
+		schema = append(schema, fmt.Sprintf("added `%s` (%s)", column.Name, column.Type))
+	}
+	for _, column := range c.Schema.RemovedColumns {
+		schema = append(schema, fmt.Sprintf("removed `%s` (%s)", column.Name, column.Type))
+	}
+	for _, change := range c.Schema.TypeChanges {
+		schema = append(schema, fmt.Sprintf("`%s` changed from %s to %s", change.Name, change.Before, change.After))
+	}
+	if len(schema) == 0 {
+		b.WriteString("\nColumns: unchanged.\n")
+	} else {
+		fmt.Fprintf(&b, "\nColumns: %s.\n", strings.Join(schema, "; "))
+	}
+
+	var counts strings.Builder
+	for _, column := range c.Columns {
+		if column.Changed > 0 {
+			fmt.Fprintf(&counts, "| %s | %d |\n", markdownCell(column.Name), column.Changed)
+		}
+	}
+	if counts.Len() > 0 {
+		b.WriteString("\n| Column | Changed cells |\n| :--- | ---: |\n")
+		b.WriteString(counts.String())
+	}
+
+	if len(c.ChangedRows) > 0 {
+		fmt.Fprintf(&b, "\nChanged rows (%d of %d):\n\n", len(c.ChangedRows), c.Rows.Changed)
+		b.WriteString("| Key | Column | Before | After |\n| :--- | :--- | :--- | :--- |\n")
+		for _, row := range c.ChangedRows {
+			key := markdownCell(jsonRecordText(row.Key))
+			for _, change := range row.Changes {
+				fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", key, markdownCell(change.Column),
+					markdownCell(jsonValueText(change.Before)), markdownCell(jsonValueText(change.After)))
+			}
+		}
+	}
+	if len(c.AddedRows) < c.Rows.Added || len(c.RemovedRows) < c.Rows.Removed {
+		fmt.Fprintf(&b, "\nThe JSON lists %d of %d added and %d of %d removed rows.\n",
+			len(c.AddedRows), c.Rows.Added, len(c.RemovedRows), c.Rows.Removed)
+	}
+	return b.String()
+}
+
+// jsonRecordText formats a JSON object of key values as "name=value" pairs,
+// keeping the order of its fields
+func jsonRecordText(record json.RawMessage) string {
+	decoder := json.NewDecoder(strings.NewReader(string(record)))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return string(record)
+	}
+	var pairs []string
+	for decoder.More() {
+		name, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			break
+		}
+		pairs = append(pairs, fmt.Sprintf("%v=%s", name, jsonValueText(value)))
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// jsonValueText formats a JSON value for a markdown cell: strings without
+// quotes, null as NA and anything else as JSON
+func jsonValueText(value json.RawMessage) string {
+	text := strings.TrimSpace(string(value))
+	if text == "" || text == "null" {
+		return "NA"
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	return text
+}
@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleComparison = `{
+	"before": {"rows": 3, "columns": 4}, "after": {"rows": 3, "columns": 4},
+	"schema": {
+		"added_columns": [{"name": "margin", "type": "numeric"}],
+		"removed_columns": [{"name": "note", "type": "character"}],
+		"type_changes": [{"name": "units", "before": "integer", "after": "numeric"}]
+	},
+	"rows": {"matched": 2, "added": 1, "removed": 1, "changed": 1, "unchanged": 1},
+	"columns": [{"name": "revenue", "changed": 1}, {"name": "units", "changed": 0}],
+	"added_rows": [{"store": "014", "month": "2024-02-01", "revenue": 210.5, "units": 7, "margin": null}],
+	"removed_rows": [{"store": "003", "month": "2024-01-01", "revenue": 99, "units": 2, "note": "closed"}],
+	"changed_rows": [{"key": {"store": "007", "month": "2024-01-01"}, "changes": [{"column": "revenue", "before": 1520.5, "after": null}]}]
+}`
+
+// TestCompareDatasets tests that the datasets and options reach the script and
+// the differences are returned as JSON and markdown
+func TestCompareDatasets(t *testing.T) {
+	setupCatalog(t)
+	dataDir := setupDataDir(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "sales_v2.rds"), []byte("mock-rds"), 0644))
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "read_before <- function() { if (!requireNamespace(\"arrow\"")
+			assert.Contains(t, string(script), "read_after <- function() readRDS("+rQuote(filepath.Join(dataDir, "sales_v2.rds"))+")\n")
+			assert.Contains(t, string(script), "before_name <- \"sales\"\nafter_name <- \"sales_v2\"\nkeys <- c(\"store\", \"month\")\ntolerance <- 0.01\nmax_examples <- 10\n")
+			return []byte(sampleComparison), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := CompareDatasets(CompareDatasetsArgs{Before: "sales", After: "sales_v2", Keys: []string{"store", "month"}, Tolerance: 0.01})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 2)
+
+	var result datasetComparison
+	require.NoError(t, json.Unmarshal([]byte(response.Content[0].TextContent.Text), &result))
+	assert.Equal(t, "sales", result.Before.Name)
+	assert.Equal(t, "sales_v2", result.After.Name)
+	assert.Equal(t, []string{"store", "month"}, result.Keys)
+	assert.Equal(t, rowDiff{Matched: 2, Added: 1, Removed: 1, Changed: 1, Unchanged: 1}, result.Rows)
+	assert.JSONEq(t, `{"store": "014", "month": "2024-02-01", "revenue": 210.5, "units": 7, "margin": null}`, string(result.AddedRows[0]))
+	assert.JSONEq(t, "null", string(result.ChangedRows[0].Changes[0].After))
+
+	assert.Equal(t, "## Changes from sales to sales_v2\n\n"+
+		"Rows matched by store, month: 3 → 3; 1 added, 1 removed, 1 changed, 1 unchanged.\n\n"+
+		"Columns: added `margin` (numeric); removed `note` (character); `units` changed from integer to numeric.\n\n"+
+		"| Column | Changed cells |\n| :--- | ---: |\n| revenue | 1 |\n\n"+
+		"Changed rows (1 of 1):\n\n"+
+		"| Key | Column | Before | After |\n| :--- | :--- | :--- | :--- |\n"+
+		"| store=007, month=2024-01-01 | revenue | 1520.5 | NA |\n", response.Content[1].TextContent.Text)
+}
+
+// TestComparisonSummary tests the summary of comparisons without changes and
+// with more rows than examples
+func TestComparisonSummary(t *testing.T) {
+	unchanged := datasetComparison{
+		Before: comparedDataset{Name: "a", Rows: 2},
+		After:  comparedDataset{Name: "b", Rows: 2},
+		Keys:   []string{"id"},
+		Rows:   rowDiff{Matched: 2, Unchanged: 2},
+	}
+	assert.Equal(t, "## Changes from a to b\n\nRows matched by id: 2 → 2; 0 added, 0 removed, 0 changed, 2 unchanged.\n\nColumns: unchanged.\n", comparisonSummary(unchanged))
+
+	truncated := unchanged
+	truncated.After.Rows = 40
+	truncated.Rows.Added = 38
+	truncated.AddedRows = []json.RawMessage{json.RawMessage(`{"id": 3}`)}
+	assert.Contains(t, comparisonSummary(truncated), "\nThe JSON lists 1 of 38 added and 0 of 0 removed rows.\n")
+
+	assert.Equal(t, "id=3, name=NA", jsonRecordText(json.RawMessage(`{"id": 3, "name": null}`)))
+}
+
+// TestCompareDatasetsValidation tests the validation of the comparison
+// arguments
+func TestCompareDatasetsValidation(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+
+	tests := []struct {
+		name     string
+		args     CompareDatasetsArgs
+		errorMsg string
+	}{
+		{"No before", CompareDatasetsArgs{After: "sales", Keys: []string{"id"}}, "before is required"},
+		{"No after", CompareDatasetsArgs{Before: "sales", Keys: []string{"id"}}, "after is required"},
+		{"No keys", CompareDatasetsArgs{Before: "sales", After: "regions"}, "keys are required"},
+		{"Empty key", CompareDatasetsArgs{Before: "sales", After: "regions", Keys: []string{""}}, "key column name is required"},
+		{"Duplicate key", CompareDatasetsArgs{Before: "sales", After: "regions", Keys: []string{"id", "id"}}, "key id is given more than once"},
+		{"Negative tolerance", CompareDatasetsArgs{Before: "sales", After: "regions", Keys: []string{"id"}, Tolerance: -1}, "tolerance cannot be negative"},
+		{"Too many examples", CompareDatasetsArgs{Before: "sales", After: "regions", Keys: []string{"id"}, MaxExamples: 500}, "max_examples must be between 1 and 100"},
+		{"Unknown dataset", CompareDatasetsArgs{Before: "sales", After: "sales_v3", Keys: []string{"id"}}, "dataset not found: sales_v3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := CompareDatasets(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// Databases maps the names of the databases that query_database can open to
+// the paths of their SQLite or DuckDB files
+var Databases = map[string]string{}
+
+// databaseDrivers maps the extensions of database files to their drivers
+var databaseDrivers = map[string]string{
+	".sqlite":  "sqlite",
+	".sqlite3": "sqlite",
+	".db":      "sqlite",
+	".duckdb":  "duckdb",
+}
+
+// queryPreviewRows is the number of result rows shown as markdown
+const queryPreviewRows = 50
+
+// QueryDatabaseArgs represents the arguments for querying a database
+type QueryDatabaseArgs struct {
+	Database string `json:"database" jsonschema:"required,description=Name of a configured database"`
+	Query    string `json:"query" jsonschema:"required,description=SQL SELECT query"`
+	MaxRows  int    `json:"max_rows,omitempty" jsonschema:"description=Maximum number of rows returned (default 1000; maximum 100000)"`
+	Timeout  int    `json:"timeout,omitempty" jsonschema:"description=Time limit of the query in seconds (default 30; maximum 600)"`
+	BindAs   string `json:"bind_as,omitempty" jsonschema:"description=Also store the result as a dataset of this name for later execute_r_script and render_ggplot calls"`
+
+	BundleOption
+}
+
+// queryDatabaseScript opens a read-only connection, fetches at most max_rows
+// rows of the query and writes them as CSV, along with a preview table and an
+// .rds file when the result is bound as a dataset
+const queryDatabaseScript = tablePreviewScript + `
+fail <- function(msg) {
+  message("Error: ", msg)
+  quit(save = "no", status = 1)
+}
+
+need_package <- function(pkg, what) {
+  if (!requireNamespace("DBI", quietly = TRUE)) fail("the DBI package is needed to query databases")
+  if (!requireNamespace(pkg, quietly = TRUE)) fail(paste("the", pkg, "package is needed to query", what, "databases"))
+}
+
+con <- tryCatch(switch(driver,
+  sqlite = {
+    need_package("RSQLite", "SQLite")
+    DBI::dbConnect(RSQLite::SQLite(), db_path, flags = RSQLite::SQLITE_RO)
+  },
+  duckdb = {
+    need_package("duckdb", "DuckDB")
+    DBI::dbConnect(duckdb::duckdb(), dbdir = db_path, read_only = TRUE, config = list(enable_external_access = "false"))
+  }
+), error = function(e) fail(paste("failed to open database:", conditionMessage(e))))
+
+df <- tryCatch({
+  res <- DBI::dbSendQuery(con, sql)
+  out <- DBI::dbFetch(res, n = max_rows + 1)
+  DBI::dbClearResult(res)
+  out
+}, error = function(e) fail(conditionMessage(e)))
+if (driver == "duckdb") DBI::dbDisconnect(con, shutdown = TRUE) else DBI::dbDisconnect(con)
+
+truncated <- nrow(df) > max_rows
+df <- as.data.frame(utils::head(df, max_rows), stringsAsFactors = FALSE)
+utils::write.csv(df, csv_file, row.names = FALSE, na = "")
+if (nzchar(rds_file)) saveRDS(df, rds_file)
+
+jsonlite::write_json(list(
+  rows = nrow(df),
+  truncated = truncated,
+  table = table_preview(df, preview_rows)
+), output_file, auto_unbox = TRUE, digits = NA)
+`
+
+// ParseDatabases parses a comma-separated list of name=path pairs naming the
+// database files that query_database can open. The driver is chosen by the
+// file extension: .sqlite, .sqlite3 and .db for SQLite and .duckdb for DuckDB.
+func ParseDatabases(spec string) (map[string]string, error) {
+	databases := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("invalid database %q: use name=path", entry)
+		}
+		if _, ok := databaseDrivers[strings.ToLower(filepath.Ext(path))]; !ok {
+			return nil, fmt.Errorf("database %s: unsupported file extension (use .sqlite, .sqlite3, .db or .duckdb)", name)
+		}
+		if _, ok := databases[name]; ok {
+			return nil, fmt.Errorf("database %s is given more than once", name)
+		}
+		databases[name] = path
+	}
+	return databases, nil
+}
+
+// QueryDatabase runs a SQL query on a read-only connection to a configured
+// database and returns the result as a markdown table and a CSV resource. The
+// result can also be stored as a dataset.
+func QueryDatabase(args QueryDatabaseArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if args.Database == "" {
+		return nil, fmt.Errorf("database is required")
+	}
+	path, ok := Databases[args.Database]
+	if !ok {
+		names := make([]string, 0, len(Databases))
+		for name := range Databases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("database not found: %s (no databases are configured)", args.Database)
+		}
+		return nil, fmt.Errorf("database not found: %s (available: %s)", args.Database, strings.Join(names, ", "))
+	}
+	if err := checkReadQuery(args.Query); err != nil {
+		return nil, err
+	}
+
+	maxRows := args.MaxRows
+	if maxRows == 0 {
+		maxRows = 1000
+	} else if maxRows < 1 || maxRows > 100000 {
+		return nil, fmt.Errorf("max_rows must be between 1 and 100000")
+	}
+
+	timeout := args.Timeout
+	if timeout == 0 {
+		timeout = 30
+	} else if timeout < 1 || timeout > 600 {
+		return nil, fmt.Errorf("timeout must be between 1 and 600 seconds")
+	}
+
+	if args.BindAs != "" {
+		if err := checkDatasetName("bind_as", args.BindAs); err != nil {
+			return nil, err
+		}
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve database path: %w", err)
+	}
+	driver := databaseDrivers[strings.ToLower(filepath.Ext(path))]
+
+	job, err := newRJob("query-database-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	rdsPath := ""
+	if args.BindAs != "" {
+		rdsPath = job.Path("result.rds")
+	}
+
+	scriptContent := fmt.Sprintf(`
+driver <- %s
+db_path <- %s
+sql <- %s
+max_rows <- %d
+preview_rows <- %d
+csv_file <- %s
+rds_file <- %s
+output_file <- %s
+%s`, rQuote(driver), rQuote(absPath), rQuote(args.Query), maxRows, queryPreviewRows,
+		rQuote(job.Path("result.csv")), rQuote(rdsPath), rQuote(job.Path("output.json")), queryDatabaseScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{Timeout: time.Duration(timeout) * time.Second, Inputs: []string{absPath}})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Rows      int           `json:"rows"`
+		Truncated bool          `json:"truncated"`
+		Table     renderedTable `json:"table"`
+	}
+	if err := json.Unmarshal(outputData, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse query result: %w", err)
+	}
+	csv, err := job.ReadFile("result.csv")
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Query returned %d rows", result.Rows)
+	if result.Truncated {
+		b.WriteString(" (stopped at max_rows; the query has more)")
+	}
+	fmt.Fprintf(&b, "\n\n%s", markdownTable(result.Table, "", ""))
+
+	// Record the query as the R code that reproduces it
+	connect := fmt.Sprintf("DBI::dbConnect(RSQLite::SQLite(), %s, flags = RSQLite::SQLITE_RO)", rQuote(absPath))
+	if driver == "duckdb" {
+		connect = fmt.Sprintf(`DBI::dbConnect(duckdb::duckdb(), dbdir = %s, read_only = TRUE, config = list(enable_external_access = "false"))`, rQuote(absPath))
+	}
+	variable := "result"
+	if args.BindAs != "" {
+		variable = args.BindAs
+	}
+	code := fmt.Sprintf("con <- %s\n%s <- DBI::dbGetQuery(con, %s, n = %d)\nDBI::dbDisconnect(con)",
+		connect, variable, rQuote(args.Query), maxRows)
+
+	content := []*mcp.Content{
+		mcp.NewTextContent(b.String()),
+		mcp.NewTextResourceContent("result:///"+args.Database+".csv", string(csv), GetMimeType("csv")),
+	}
+
+	if args.BindAs != "" {
+		rds, err := job.ReadFile("result.rds")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := storeDataset(args.BindAs, rds); err != nil {
+			return nil, err
+		}
+		content = append(content, mcp.NewTextContent(fmt.Sprintf(
+			"Stored the result as dataset %s. Later execute_r_script and render_ggplot calls can use it as the data frame `%s`.", args.BindAs, args.BindAs)))
+	}
+
+	session.record("query_database", code, contentOutputs(content[:1]))
+	return mcp.NewToolResponse(content...), nil
+}
+
+// checkReadQuery checks that a query is a single statement that reads data.
+// DuckDB runs every statement of a query and can read and write other files
+// even on a read-only connection, which is why the connection also disables
+// external access.
+func checkReadQuery(query string) error {
+	sql := strings.TrimSpace(query)
+	for {
+		if rest, ok := strings.CutPrefix(sql, "--"); ok {
+			_, sql, _ = strings.Cut(rest, "\n")
+		} else if rest, ok := strings.CutPrefix(sql, "/*"); ok {
+			_, sql, _ = strings.Cut(rest, "*/")
+		} else {
+			break
+		}
+		sql = strings.TrimSpace(sql)
+	}
+	if sql == "" {
+		return fmt.Errorf("query is required")
+	}
+	if hasSeveralStatements(sql) {
+		return fmt.Errorf("query must be a single statement")
+	}
+
+	keyword := strings.ToUpper(strings.TrimLeft(sql, "("))
+	if i := strings.IndexFunc(keyword, func(r rune) bool { return !('A' <= r && r <= 'Z') }); i >= 0 {
+		keyword = keyword[:i]
+	}
+	switch keyword {
+	case "SELECT", "WITH", "VALUES", "EXPLAIN", "SHOW", "DESCRIBE", "PRAGMA":
+		return nil
+	}
+	return fmt.Errorf("only queries that read data are allowed (SELECT, WITH, VALUES, EXPLAIN, SHOW, DESCRIBE or PRAGMA)")
+}
+
+// hasSeveralStatements reports whether a semicolon outside string literals,
+// quoted identifiers and comments is followed by more SQL
+func hasSeveralStatements(sql string) bool {
+	ended := false
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(sql[i+1:], c)
+			if end < 0 {
+				return ended
+			}
+			if ended {
+				return true
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return false
+			}
+			i += end
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 3
+		case c == ';':
+			ended = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			if ended {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupDatabases configures the databases for the test
+func setupDatabases(t *testing.T, databases map[string]string) {
+	original := Databases
+	Databases = databases
+	t.Cleanup(func() { Databases = original })
+}
+
+// TestQueryDatabase tests that the query reaches the script with its limits
+// and the result is returned as a table and stored as a dataset
+func TestQueryDatabase(t *testing.T) {
+	dataDir := setupDataDir(t)
+	setupSession(t)
+	setupDatabases(t, map[string]string{"shop": "/srv/shop.duckdb"})
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			assert.Equal(t, 10*time.Second, config.Timeout)
+			assert.Equal(t, []string{"/srv/shop.duckdb"}, config.Inputs)
+
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "driver <- \"duckdb\"\ndb_path <- \"/srv/shop.duckdb\"\nsql <- \"SELECT store, sum(revenue) AS revenue FROM sales GROUP BY store\"\nmax_rows <- 2\n")
+			assert.Contains(t, string(script), "read_only = TRUE")
+
+			jobDir := filepath.Dir(config.OutputPath)
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "result.csv"), []byte("\"store\",\"revenue\"\n\"007\",1520.5\n\"012\",980\n"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "result.rds"), []byte("mock-rds"), 0644))
+			return []byte(`{"rows": 2, "truncated": true, "table": {
+				"total_rows": 2,
+				"columns": [{"label": "store", "align": "left"}, {"label": "revenue", "align": "right"}],
+				"rows": [
+					{"group": "", "cells": ["007", "1520.5"], "highlighted": [false, false]},
+					{"group": "", "cells": ["012", "980.0"], "highlighted": [false, false]}
+				]
+			}}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := QueryDatabase(QueryDatabaseArgs{
+		Database: "shop",
+		Query:    "SELECT store, sum(revenue) AS revenue FROM sales GROUP BY store",
+		MaxRows:  2,
+		Timeout:  10,
+		BindAs:   "revenue",
+	})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 3)
+	assert.Equal(t, "Query returned 2 rows (stopped at max_rows; the query has more)\n\n"+
+		"| store | revenue |\n| :--- | ---: |\n| 007 | 1520.5 |\n| 012 | 980.0 |\n", response.Content[0].TextContent.Text)
+	resource := response.Content[1].EmbeddedResource.TextResourceContents
+	assert.Equal(t, "result:///shop.csv", resource.Uri)
+	assert.Equal(t, "text/csv", *resource.MimeType)
+	assert.Contains(t, response.Content[2].TextContent.Text, "Stored the result as dataset revenue.")
+
+	data, err := os.ReadFile(filepath.Join(dataDir, "revenue.rds"))
+	require.NoError(t, err)
+	assert.Equal(t, "mock-rds", string(data))
+
+	entries := session.snapshot()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "con <- DBI::dbConnect(duckdb::duckdb(), dbdir = \"/srv/shop.duckdb\", read_only = TRUE, config = list(enable_external_access = \"false\"))\n"+
+		"revenue <- DBI::dbGetQuery(con, \"SELECT store, sum(revenue) AS revenue FROM sales GROUP BY store\", n = 2)\n"+
+		"DBI::dbDisconnect(con)", entries[0].Code)
+}
+
+// TestParseDatabases tests the parsing of the -databases flag
+func TestParseDatabases(t *testing.T) {
+	databases, err := ParseDatabases("shop=/srv/shop.duckdb, events=events.SQLITE,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"shop": "/srv/shop.duckdb", "events": "events.SQLITE"}, databases)
+
+	_, err = ParseDatabases("shop")
+	assert.EqualError(t, err, `invalid database "shop": use name=path`)
+	_, err = ParseDatabases("shop=shop.csv")
+	assert.EqualError(t, err, "database shop: unsupported file extension (use .sqlite, .sqlite3, .db or .duckdb)")
+	_, err = ParseDatabases("shop=a.db,shop=b.db")
+	assert.EqualError(t, err, "database shop is given more than once")
+}
+
+// TestQueryDatabaseValidation tests the validation of the query arguments
+func TestQueryDatabaseValidation(t *testing.T) {
+	setupCatalog(t)
+	setupDatabases(t, map[string]string{"shop": "shop.sqlite", "events": "events.duckdb"})
+
+	tests := []struct {
+		name     string
+		args     QueryDatabaseArgs
+		errorMsg string
+	}{
+		{"No database", QueryDatabaseArgs{Query: "SELECT 1"}, "database is required"},
+		{"Unknown database", QueryDatabaseArgs{Database: "crm", Query: "SELECT 1"}, "database not found: crm (available: events, shop)"},
+		{"No query", QueryDatabaseArgs{Database: "shop", Query: " -- nothing\n"}, "query is required"},
+		{"Write query", QueryDatabaseArgs{Database: "shop", Query: "/* cleanup */ DELETE FROM sales"}, "only queries that read data are allowed"},
+		{"Two statements", QueryDatabaseArgs{Database: "events", Query: "SELECT 1; COPY (SELECT 1) TO '/tmp/out.csv'"}, "query must be a single statement"},
+		{"Statement after comment", QueryDatabaseArgs{Database: "events", Query: "SELECT 1; -- done\nINSTALL httpfs"}, "query must be a single statement"},
+		{"Attach", QueryDatabaseArgs{Database: "shop", Query: "ATTACH 'other.db' AS other"}, "only queries that read data are allowed"},
+		{"Too many rows", QueryDatabaseArgs{Database: "shop", Query: "SELECT 1", MaxRows: 200000}, "max_rows must be between 1 and 100000"},
+		{"Bad timeout", QueryDatabaseArgs{Database: "shop", Query: "SELECT 1", Timeout: 3600}, "timeout must be between 1 and 600 seconds"},
+		{"Bad dataset name", QueryDatabaseArgs{Database: "shop", Query: "SELECT 1", BindAs: "my result"}, "bind_as must be a valid R name"},
+		{"Catalog dataset name", QueryDatabaseArgs{Database: "shop", Query: "SELECT 1", BindAs: "regions"}, "bind_as is used by the catalog dataset regions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := QueryDatabase(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+
+	for _, query := range []string{"select 1", "-- totals\nWITH t AS (SELECT 1) SELECT * FROM t", "(SELECT 1) UNION (SELECT 2)", "PRAGMA table_info(sales)",
+		"SELECT 1;", "SELECT 'a;b' AS \"x;y\"; -- trailing comment", "SELECT 1 /* ; */ ;\n"} {
+		assert.NoError(t, checkReadQuery(query), query)
+	}
+}
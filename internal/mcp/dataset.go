@@ -0,0 +1,387 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// DataDir is the directory holding the datasets stored by upload_data. Every
+// dataset is an .rds file named after the dataset.
+var DataDir = "data"
+
+// maxUploadBytes bounds the size of the data accepted by upload_data
+const maxUploadBytes = 50 << 20
+
+// dataFormats maps the upload formats to the extension of the uploaded file
+var dataFormats = map[string]string{
+	"csv": "csv", "tsv": "tsv", "json": "json",
+	"parquet": "parquet", "feather": "feather", "arrow": "arrow", "xlsx": "xlsx", "xls": "xls",
+}
+
+// textDataFormats are the upload formats read by uploadDataScript itself; the
+// binary formats are read with the dataset readers and must be base64 encoded
+var textDataFormats = map[string]bool{"csv": true, "tsv": true, "json": true}
+
+// dataColumnTypes are the column types of an upload schema
+var dataColumnTypes = map[string]bool{
+	"character": true, "integer": true, "double": true, "logical": true,
+	"factor": true, "date": true, "datetime": true,
+}
+
+// DataColumn declares the type of a column of uploaded data
+type DataColumn struct {
+	Name   string `json:"name" jsonschema:"required,description=Column name"`
+	Type   string `json:"type" jsonschema:"required,description=Column type (character, integer, double, logical, factor, date, datetime)"`
+	Format string `json:"format,omitempty" jsonschema:"description=strptime format of date and datetime columns; ISO 8601 by default"`
+}
+
+// UploadDataArgs represents the arguments for uploading a dataset
+type UploadDataArgs struct {
+	Name     string       `json:"name" jsonschema:"required,description=Name of the dataset; later execute_r_script and render_ggplot calls can use it as a data frame of this name"`
+	Content  string       `json:"content" jsonschema:"required,description=The data as CSV or TSV with a header row or as JSON records; or a Parquet; Feather; Arrow IPC or Excel file encoded as base64"`
+	Format   string       `json:"format,omitempty" jsonschema:"description=Format of the data (csv, tsv, json, parquet, feather, arrow, xlsx, xls); default csv"`
+	Encoding string       `json:"encoding,omitempty" jsonschema:"description=Encoding of the content (text, base64); default text; binary formats must be base64"`
+	Sheet    string       `json:"sheet,omitempty" jsonschema:"description=Sheet of an Excel file given by name or position; default the first sheet"`
+	Range    string       `json:"range,omitempty" jsonschema:"description=Cell range of an Excel file such as B3:F120 or Budget!B3:F120; default the used cells"`
+	Columns  []DataColumn `json:"columns,omitempty" jsonschema:"description=Types of some or all columns; the types of the other columns are detected"`
+
+	BundleOption
+}
+
+// datasetSummary describes a stored dataset
+type datasetSummary struct {
+	Rows    int `json:"rows"`
+	Columns []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"columns"`
+}
+
+// uploadDataScript reads the uploaded file into a data frame, applies the
+// column types and saves it as an .rds file. Columns of CSV and TSV data with a
+// declared type are read as text so that values like "007" keep their leading
+// zeros. Binary formats are read by read_data, which keeps their column types.
+const uploadDataScript = `
+schema <- jsonlite::fromJSON(schema_file, simplifyDataFrame = FALSE)
+typed <- vapply(schema, function(col) col$name, "")
+
+df <- tryCatch({
+  if (!is.null(read_data)) {
+    read_data()
+  } else if (format == "json") {
+    value <- jsonlite::fromJSON(data_file)
+    if (!is.data.frame(value)) stop("JSON data must be an array of records or an object of columns")
+    value
+  } else {
+    classes <- if (length(typed) > 0) stats::setNames(rep("character", length(typed)), typed) else NA
+    utils::read.table(data_file, header = TRUE, sep = if (format == "tsv") "\t" else ",", quote = "\"",
+      colClasses = classes, na.strings = c("", "NA"), check.names = FALSE, comment.char = "",
+      stringsAsFactors = FALSE, encoding = "UTF-8")
+  }
+}, error = function(e) {
+  message("Error: failed to read ", format, " data: ", conditionMessage(e))
+  quit(save = "no", status = 1)
+})
+df <- as.data.frame(df, stringsAsFactors = FALSE)
+
+for (col in schema) {
+  if (!col$name %in% names(df)) {
+    message("Error: column not found: ", col$name)
+    quit(save = "no", status = 1)
+  }
+  x <- df[[col$name]]
+  col_format <- col$format
+  df[[col$name]] <- switch(col$type,
+    character = as.character(x),
+    integer = as.integer(x),
+    double = as.numeric(x),
+    logical = as.logical(x),
+    factor = factor(x),
+    date = if (is.null(col_format)) as.Date(x) else as.Date(x, format = col_format),
+    datetime = if (is.null(col_format)) as.POSIXct(x, tz = "UTC") else as.POSIXct(x, format = col_format, tz = "UTC")
+  )
+}
+
+saveRDS(df, rds_file)
+jsonlite::write_json(list(
+  rows = nrow(df),
+  columns = lapply(names(df), function(n) list(name = n, type = class(df[[n]])[1]))
+), output_file, auto_unbox = TRUE)
+`
+
+// UploadData stores CSV, TSV, JSON, Parquet, Feather, Arrow IPC or Excel data
+// as a data frame in DataDir so later execute_r_script and render_ggplot calls
+// can use it by name
+func UploadData(args UploadDataArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if err := checkDatasetName("name", args.Name); err != nil {
+		return nil, err
+	}
+	if args.Content == "" {
+		return nil, fmt.Errorf("content is required")
+	}
+
+	format := args.Format
+	if format == "" {
+		format = "csv"
+	}
+	extension, ok := dataFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("format must be csv, tsv, json, parquet, feather, arrow, xlsx or xls")
+	}
+	if !textDataFormats[format] && args.Encoding != "base64" {
+		return nil, fmt.Errorf("%s data must be base64 encoded", format)
+	}
+	if (args.Sheet != "" || args.Range != "") && !isExcelFormat(format) {
+		return nil, fmt.Errorf("sheet and range can only be used with xlsx and xls data")
+	}
+
+	data := []byte(args.Content)
+	switch args.Encoding {
+	case "", "text":
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(args.Content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 content: %w", err)
+		}
+		data = decoded
+	default:
+		return nil, fmt.Errorf("encoding must be text or base64")
+	}
+	if len(data) > maxUploadBytes {
+		return nil, fmt.Errorf("data is too large (%d bytes, at most %d)", len(data), maxUploadBytes)
+	}
+
+	seen := make(map[string]bool)
+	for _, column := range args.Columns {
+		if column.Name == "" {
+			return nil, fmt.Errorf("column name is required")
+		}
+		if seen[column.Name] {
+			return nil, fmt.Errorf("column %s is declared more than once", column.Name)
+		}
+		seen[column.Name] = true
+		if !dataColumnTypes[column.Type] {
+			return nil, fmt.Errorf("column %s: type must be character, integer, double, logical, factor, date or datetime", column.Name)
+		}
+		if column.Format != "" && column.Type != "date" && column.Type != "datetime" {
+			return nil, fmt.Errorf("column %s: format is only used with date and datetime columns", column.Name)
+		}
+	}
+
+	job, err := newRJob("upload-data-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	dataPath, err := job.WriteFile("data."+extension, data)
+	if err != nil {
+		return nil, err
+	}
+	columns := args.Columns
+	if columns == nil {
+		columns = []DataColumn{}
+	}
+	schema, err := json.Marshal(columns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode column types: %w", err)
+	}
+	schemaPath, err := job.WriteFile("schema.json", schema)
+	if err != nil {
+		return nil, err
+	}
+
+	readData := "NULL"
+	if !textDataFormats[format] {
+		readData = "function() " + datasetReadCode(dataset{Path: dataPath, Format: format, Sheet: args.Sheet, Range: args.Range})
+	}
+
+	scriptContent := fmt.Sprintf(`
+data_file <- %s
+schema_file <- %s
+format <- %s
+read_data <- %s
+rds_file <- %s
+output_file <- %s
+%s`, rQuote(dataPath), rQuote(schemaPath), rQuote(format), readData, rQuote(job.Path("dataset.rds")),
+		rQuote(job.Path("output.json")), uploadDataScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{})
+	if err != nil {
+		return nil, err
+	}
+
+	var summary datasetSummary
+	if err := json.Unmarshal(outputData, &summary); err != nil {
+		return nil, fmt.Errorf("failed to parse dataset summary: %w", err)
+	}
+
+	// Store the dataset in the workspace
+	rds, err := job.ReadFile("dataset.rds")
+	if err != nil {
+		return nil, err
+	}
+	path, err := storeDataset(args.Name, rds)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stored dataset %s with %d rows and %d columns. Later execute_r_script and render_ggplot calls can use it as the data frame `%s`.\n\n",
+		args.Name, summary.Rows, len(summary.Columns), args.Name)
+	b.WriteString("| Column | Type |\n| :--- | :--- |\n")
+	for _, column := range summary.Columns {
+		fmt.Fprintf(&b, "| %s | %s |\n", markdownCell(column.Name), column.Type)
+	}
+
+	// Record how the dataset is loaded so exported sessions can reproduce it
+	session.record("upload_data", fmt.Sprintf("%s <- readRDS(%s)", args.Name, rQuote(path)), nil)
+
+	return mcp.NewToolResponse(mcp.NewTextContent(b.String())), nil
+}
+
+// baseConstants are the constants of the base package that datasets must not
+// shadow, since expressions and scripts that use them would see the data
+var baseConstants = map[string]bool{
+	"T": true, "F": true, "pi": true, "letters": true, "LETTERS": true,
+	"month.name": true, "month.abb": true,
+}
+
+// isDatasetName reports whether name can be used for a dataset
+func isDatasetName(name string) bool {
+	return isRIdentifier(name) && !baseConstants[name]
+}
+
+// checkDatasetName checks that name, given as the named argument, can be used
+// for a dataset stored in DataDir
+func checkDatasetName(argument string, name string) error {
+	if baseConstants[name] {
+		return fmt.Errorf("%s cannot be %s, which would shadow the R constant", argument, name)
+	}
+	if !isRIdentifier(name) {
+		return fmt.Errorf("%s must be a valid R name: %q", argument, name)
+	}
+	d, err := catalogDataset(name)
+	if err != nil {
+		return err
+	}
+	if d != nil {
+		return fmt.Errorf("%s is used by the catalog dataset %s", argument, name)
+	}
+	return nil
+}
+
+// storeDataset saves a data frame serialized with saveRDS as a dataset in
+// DataDir, replacing an earlier dataset of the same name, and returns the
+// absolute path of its file
+func storeDataset(name string, rds []byte) (string, error) {
+	if err := os.MkdirAll(DataDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create data directory: %w", err)
+	}
+	path, err := filepath.Abs(filepath.Join(DataDir, name+".rds"))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve dataset path: %w", err)
+	}
+	if err := os.WriteFile(path, rds, 0644); err != nil {
+		return "", fmt.Errorf("failed to write dataset: %w", err)
+	}
+	return path, nil
+}
+
+// dataLoadCode returns the R expression loading the data of a tool that takes
+// either the name of a dataset or R code evaluating to a data frame, along
+// with the paths of the dataset files it reads. The code can use the datasets
+// by name.
+func dataLoadCode(dataset string, data string) (string, []string, error) {
+	if dataset == "" && data == "" {
+		return "", nil, fmt.Errorf("either dataset or data is required")
+	}
+	if dataset != "" && data != "" {
+		return "", nil, fmt.Errorf("dataset and data cannot be used together")
+	}
+
+	if dataset != "" {
+		d, err := findDataset(dataset)
+		if err != nil {
+			return "", nil, err
+		}
+		return datasetReadCode(d), []string{d.Path}, nil
+	}
+
+	datasetCode, err := datasetPreamble()
+	if err != nil {
+		return "", nil, err
+	}
+	inputs, err := datasetInputs(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("{\n%seval(parse(text = %s), envir = globalenv())\n}", datasetCode, rQuote(data)), inputs, nil
+}
+
+// datasetPreamble returns the R code that binds the catalog and uploaded
+// datasets in the global environment, or an empty string when there are none.
+// The bindings are promises, so a dataset is only read when the code uses it.
+func datasetPreamble() (string, error) {
+	datasets, err := listDatasets()
+	if err != nil {
+		return "", err
+	}
+	return datasetBindings(datasets), nil
+}
+
+// datasetBindings returns the R code that binds the given datasets in the
+// global environment, or an empty string when there are none
+func datasetBindings(datasets []dataset) string {
+	if len(datasets) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("# Bind the datasets\n")
+	for _, d := range datasets {
+		fmt.Fprintf(&b, "delayedAssign(%s, %s, assign.env = globalenv())\n", rQuote(d.Name), datasetReadCode(d))
+	}
+	return b.String()
+}
+
+// mentionedDatasets returns the datasets whose names appear in code run after
+// datasetPreamble, which are the datasets the code can read
+func mentionedDatasets(code string) ([]dataset, error) {
+	datasets, err := listDatasets()
+	if err != nil {
+		return nil, err
+	}
+
+	var mentioned []dataset
+	for _, d := range datasets {
+		pattern := regexp.MustCompile(`(^|[^A-Za-z0-9._])` + regexp.QuoteMeta(d.Name) + `($|[^A-Za-z0-9._])`)
+		if pattern.MatchString(code) {
+			mentioned = append(mentioned, d)
+		}
+	}
+	return mentioned, nil
+}
+
+// datasetInputs returns the paths of the datasets that code run after
+// datasetPreamble mentions
+func datasetInputs(code string) ([]string, error) {
+	datasets, err := mentionedDatasets(code)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []string
+	for _, d := range datasets {
+		inputs = append(inputs, d.Path)
+	}
+	return inputs, nil
+}
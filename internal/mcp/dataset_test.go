@@ -0,0 +1,179 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupDataDir points DataDir to a temporary directory for the test
+func setupDataDir(t *testing.T) string {
+	original := DataDir
+	DataDir = t.TempDir()
+	t.Cleanup(func() { DataDir = original })
+	return DataDir
+}
+
+// TestUploadData tests that the data and column types reach the script and the
+// dataset is stored in the workspace
+func TestUploadData(t *testing.T) {
+	dir := setupDataDir(t)
+	setupSession(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			jobDir := filepath.Dir(config.OutputPath)
+			data, err := os.ReadFile(filepath.Join(jobDir, "data.tsv"))
+			require.NoError(t, err)
+			assert.Equal(t, "id\tday\n007\t2024-05-01\n", string(data))
+
+			schema, err := os.ReadFile(filepath.Join(jobDir, "schema.json"))
+			require.NoError(t, err)
+			assert.JSONEq(t, `[{"name": "id", "type": "character"}, {"name": "day", "type": "date", "format": "%Y-%m-%d"}]`, string(schema))
+
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "dataset.rds"), []byte("mock-rds"), 0644))
+			return []byte(`{"rows": 1, "columns": [{"name": "id", "type": "character"}, {"name": "day", "type": "Date"}]}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := UploadData(UploadDataArgs{
+		Name:     "visits",
+		Content:  base64.StdEncoding.EncodeToString([]byte("id\tday\n007\t2024-05-01\n")),
+		Format:   "tsv",
+		Encoding: "base64",
+		Columns:  []DataColumn{{Name: "id", Type: "character"}, {Name: "day", Type: "date", Format: "%Y-%m-%d"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Stored dataset visits with 1 rows and 2 columns. Later execute_r_script and render_ggplot calls can use it as the data frame `visits`.\n\n"+
+		"| Column | Type |\n| :--- | :--- |\n| id | character |\n| day | Date |\n", response.Content[0].TextContent.Text)
+
+	data, err := os.ReadFile(filepath.Join(dir, "visits.rds"))
+	require.NoError(t, err)
+	assert.Equal(t, "mock-rds", string(data))
+	assert.Contains(t, session.snapshot()[0].Code, "visits <- readRDS(")
+
+	preamble, err := datasetPreamble()
+	require.NoError(t, err)
+	assert.Equal(t, "# Bind the datasets\ndelayedAssign(\"visits\", readRDS("+rQuote(filepath.Join(dir, "visits.rds"))+"), assign.env = globalenv())\n", preamble)
+}
+
+// TestUploadExcelData tests that binary formats are read with the dataset
+// readers and their options
+func TestUploadExcelData(t *testing.T) {
+	setupDataDir(t)
+	setupSession(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			jobDir := filepath.Dir(config.OutputPath)
+			data, err := os.ReadFile(filepath.Join(jobDir, "data.xlsx"))
+			require.NoError(t, err)
+			assert.Equal(t, "mock-xlsx", string(data))
+
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "read_data <- function() { if (!requireNamespace(\"readxl\", quietly = TRUE)) stop(")
+			assert.Contains(t, string(script), "readxl::read_excel("+rQuote(filepath.Join(jobDir, "data.xlsx"))+", sheet = 2, range = \"B3:F120\")")
+
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "dataset.rds"), []byte("mock-rds"), 0644))
+			return []byte(`{"rows": 117, "columns": [{"name": "account", "type": "character"}, {"name": "booked", "type": "POSIXct"}]}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := UploadData(UploadDataArgs{
+		Name:     "budget",
+		Content:  base64.StdEncoding.EncodeToString([]byte("mock-xlsx")),
+		Format:   "xlsx",
+		Encoding: "base64",
+		Sheet:    "2",
+		Range:    "B3:F120",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, response.Content[0].TextContent.Text, "| booked | POSIXct |")
+}
+
+// TestDatasetPreamble tests that the uploaded datasets are bound in the
+// scripts of execute_r_script and render_ggplot, and that the datasets the code
+// names are declared as inputs
+func TestDatasetPreamble(t *testing.T) {
+	dir := setupDataDir(t)
+	setupSession(t)
+
+	preamble, err := datasetPreamble()
+	require.NoError(t, err)
+	assert.Empty(t, preamble)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sales.rds"), []byte("mock-rds"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644))
+
+	var scripts []string
+	var inputs [][]string
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			scripts = append(scripts, string(script))
+			inputs = append(inputs, config.Inputs)
+			return []byte("mock-output"), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	_, err = ExecuteRScriptTool(RScriptArgs{Code: "summary(sales)"})
+	require.NoError(t, err)
+	_, err = RenderGGPlot(GGPlotRenderArgs{Code: "ggplot(sales, aes(x, y)) + geom_point()"})
+	require.NoError(t, err)
+
+	_, err = ExecuteRScriptTool(RScriptArgs{Code: "sales.total <- 1; wholesales <- 2"})
+	require.NoError(t, err)
+
+	require.Len(t, scripts, 3)
+	for _, script := range scripts {
+		assert.Contains(t, script, `delayedAssign("sales", readRDS(`)
+		assert.NotContains(t, script, "notes")
+	}
+	path, err := filepath.Abs(filepath.Join(dir, "sales.rds"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{path}, {path}, nil}, inputs)
+}
+
+// TestUploadDataValidation tests the validation of the upload arguments
+func TestUploadDataValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     UploadDataArgs
+		errorMsg string
+	}{
+		{"Bad name", UploadDataArgs{Name: "my data", Content: "a\n1"}, "name must be a valid R name"},
+		{"Reserved name", UploadDataArgs{Name: "function", Content: "a\n1"}, "name must be a valid R name"},
+		{"Constant name", UploadDataArgs{Name: "letters", Content: "a\n1"}, "name cannot be letters, which would shadow the R constant"},
+		{"Logical constant name", UploadDataArgs{Name: "T", Content: "a\n1"}, "name cannot be T, which would shadow the R constant"},
+		{"No content", UploadDataArgs{Name: "d"}, "content is required"},
+		{"Bad format", UploadDataArgs{Name: "d", Content: "a\n1", Format: "xml"}, "format must be csv, tsv, json, parquet, feather, arrow, xlsx or xls"},
+		{"Binary as text", UploadDataArgs{Name: "d", Content: "PAR1", Format: "parquet"}, "parquet data must be base64 encoded"},
+		{"Sheet of CSV", UploadDataArgs{Name: "d", Content: "a\n1", Sheet: "Budget"}, "sheet and range can only be used with xlsx and xls data"},
+		{"Bad encoding", UploadDataArgs{Name: "d", Content: "a\n1", Encoding: "gzip"}, "encoding must be text or base64"},
+		{"Bad base64", UploadDataArgs{Name: "d", Content: "not base64!", Encoding: "base64"}, "failed to decode base64 content"},
+		{"Bad type", UploadDataArgs{Name: "d", Content: "a\n1", Columns: []DataColumn{{Name: "a", Type: "number"}}}, "column a: type must be"},
+		{"Duplicate column", UploadDataArgs{Name: "d", Content: "a\n1", Columns: []DataColumn{{Name: "a", Type: "integer"}, {Name: "a", Type: "double"}}}, "column a is declared more than once"},
+		{"Format of number", UploadDataArgs{Name: "d", Content: "a\n1", Columns: []DataColumn{{Name: "a", Type: "integer", Format: "%d"}}}, "format is only used with date and datetime columns"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := UploadData(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
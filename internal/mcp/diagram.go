@@ -0,0 +1,321 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// DiagramRenderArgs represents the arguments for rendering a diagram
+type DiagramRenderArgs struct {
+	Source     string     `json:"source" jsonschema:"description=Diagram source in DOT/Graphviz or mermaid syntax"`
+	Language   string     `json:"language" jsonschema:"description=Source language (dot, mermaid); detected from the source if omitted"`
+	Edges      [][]string `json:"edges" jsonschema:"description=Edge list of [from, to] node pairs drawn with an igraph layout instead of a diagram source"`
+	Directed   bool       `json:"directed" jsonschema:"description=Whether the edge list describes a directed graph"`
+	Layout     string     `json:"layout" jsonschema:"description=igraph layout for edge lists (nicely, fr, kk, circle, tree, grid, star, random)"`
+	OutputType string     `json:"output_type" jsonschema:"description=Output format: svg or png; defaults to png for mermaid sources and svg otherwise"`
+	Width      int        `json:"width" jsonschema:"description=Width of the output image in pixels"`
+	Height     int        `json:"height" jsonschema:"description=Height of the output image in pixels"`
+	Resolution int        `json:"resolution" jsonschema:"description=Resolution of the output image in dpi"`
+
+	BundleOption
+}
+
+// igraphLayouts maps the supported layout names to igraph layout functions
+var igraphLayouts = map[string]string{
+	"nicely": "igraph::layout_nicely",
+	"fr":     "igraph::layout_with_fr",
+	"kk":     "igraph::layout_with_kk",
+	"circle": "igraph::layout_in_circle",
+	"tree":   "igraph::layout_as_tree",
+	"grid":   "igraph::layout_on_grid",
+	"star":   "igraph::layout_as_star",
+	"random": "igraph::layout_randomly",
+}
+
+// mermaidDiagramTypes lists the keywords a mermaid source may start with
+var mermaidDiagramTypes = []string{
+	"graph", "flowchart", "sequenceDiagram", "classDiagram", "stateDiagram",
+	"stateDiagram-v2", "erDiagram", "gantt", "pie", "journey", "gitGraph",
+}
+
+// dotHeaderPattern matches the graph header of a DOT source. The graph name
+// must be on the header line, so a mermaid "graph TD" whose nodes use braces
+// is not taken for DOT.
+var dotHeaderPattern = regexp.MustCompile(`^(?i:strict\s+)?(?i:graph|digraph)\b[^{\n]*\s*\{`)
+
+// RenderDiagram renders a Graphviz, mermaid or igraph edge-list diagram and
+// returns the image directly in the response
+func RenderDiagram(args DiagramRenderArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if args.Source == "" && len(args.Edges) == 0 {
+		return nil, fmt.Errorf("either source or edges is required")
+	}
+	if args.Source != "" && len(args.Edges) > 0 {
+		return nil, fmt.Errorf("source and edges cannot be used together")
+	}
+
+	outputType := args.OutputType
+	if outputType == "" {
+		outputType = "svg"
+		// Mermaid diagrams are captured from a browser, which only gives png
+		if args.Source != "" && diagramLanguage(args) == "mermaid" {
+			outputType = "png"
+		}
+	} else if outputType != "svg" && outputType != "png" {
+		return nil, fmt.Errorf("output_type must be svg or png")
+	}
+
+	width, height, resolution, err := validateImageSize(args.Width, args.Height, args.Resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newRJob("diagram-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	var body string
+	if len(args.Edges) > 0 {
+		body, err = igraphDiagramScript(job, args)
+	} else {
+		body, err = sourceDiagramScript(job, args, outputType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate the R script content
+	scriptContent := fmt.Sprintf(`
+# Set output parameters
+width <- %d
+height <- %d
+dpi <- %d
+output_type <- %s
+output_file <- %s
+
+%s
+`, width, height, resolution, rQuote(outputType), rQuote(job.Path("output."+outputType)), body)
+
+	imageData, err := job.Run(scriptContent, "output."+outputType, RExecutionConfig{
+		OutputFormat: outputType,
+		Width:        width,
+		Height:       height,
+		Resolution:   resolution,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the image content
+	imageContent := mcp.NewImageContent(
+		EncodeImageToBase64(imageData),
+		GetMimeType(outputType))
+
+	return mcp.NewToolResponse(imageContent), nil
+}
+
+// sourceDiagramScript validates a DOT or mermaid source and returns the R code
+// that renders it
+func sourceDiagramScript(job *rJob, args DiagramRenderArgs, outputType string) (string, error) {
+	language := diagramLanguage(args)
+
+	var err error
+	switch language {
+	case "dot", "graphviz":
+		err = validateDOT(args.Source)
+	case "mermaid":
+		err = validateMermaid(args.Source)
+		if err == nil && outputType != "png" {
+			err = fmt.Errorf("mermaid diagrams can only be rendered to png")
+		}
+	default:
+		err = fmt.Errorf("language must be dot or mermaid")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sourcePath, err := job.WriteFile("diagram.txt", []byte(args.Source))
+	if err != nil {
+		return "", err
+	}
+
+	if language == "mermaid" {
+		return fmt.Sprintf(`
+# Render the mermaid widget in a headless browser
+source_text <- paste(readLines(%s, warn = FALSE), collapse = "\n")
+widget <- DiagrammeR::mermaid(source_text)
+html_file <- file.path(dirname(output_file), "diagram.html")
+htmlwidgets::saveWidget(widget, html_file, selfcontained = FALSE)
+webshot2::webshot(html_file, output_file, vwidth = width, vheight = height, zoom = dpi / 96)
+`, rQuote(sourcePath)), nil
+	}
+
+	return fmt.Sprintf(`
+# Render the Graphviz source to SVG
+source_text <- paste(readLines(%s, warn = FALSE), collapse = "\n")
+svg_text <- DiagrammeRsvg::export_svg(DiagrammeR::grViz(source_text))
+if (output_type == "svg") {
+  writeLines(svg_text, output_file)
+} else {
+  rsvg::rsvg_png(charToRaw(svg_text), output_file, width = width)
+}
+`, rQuote(sourcePath)), nil
+}
+
+// igraphDiagramScript validates an edge list and returns the R code that
+// draws it with an igraph layout
+func igraphDiagramScript(job *rJob, args DiagramRenderArgs) (string, error) {
+	layout := args.Layout
+	if layout == "" {
+		layout = "nicely"
+	}
+	layoutFunc, ok := igraphLayouts[layout]
+	if !ok {
+		return "", fmt.Errorf("unsupported layout: %s", layout)
+	}
+
+	edgesPath, err := writeEdgeList(job, args.Edges)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`
+# Draw the edge list with an igraph layout
+edges <- read.csv(%s, colClasses = "character")
+g <- igraph::graph_from_data_frame(edges, directed = %s)
+coords <- %s(g)
+if (output_type == "svg") {
+  svg(output_file, width = width / dpi, height = height / dpi)
+} else {
+  png(output_file, width = width, height = height, res = dpi)
+}
+plot(g, layout = coords)
+invisible(dev.off())
+`, rQuote(edgesPath), rBool(args.Directed), layoutFunc), nil
+}
+
+// writeEdgeList validates the [from, to] pairs and writes them as a CSV file
+func writeEdgeList(job *rJob, edges [][]string) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"from", "to"})
+	for i, edge := range edges {
+		if len(edge) != 2 || edge[0] == "" || edge[1] == "" {
+			return "", fmt.Errorf("edge %d must be a [from, to] pair of node names", i)
+		}
+		w.Write(edge)
+	}
+	w.Flush()
+	return job.WriteFile("edges.csv", buf.Bytes())
+}
+
+// diagramLanguage returns the language of a diagram source, detecting it when
+// it is not given
+func diagramLanguage(args DiagramRenderArgs) string {
+	if args.Language != "" {
+		return strings.ToLower(args.Language)
+	}
+	return detectDiagramLanguage(args.Source)
+}
+
+// detectDiagramLanguage guesses whether a diagram source is DOT or mermaid
+func detectDiagramLanguage(source string) string {
+	if dotHeaderPattern.MatchString(strings.TrimSpace(source)) {
+		return "dot"
+	}
+	return "mermaid"
+}
+
+// validateDOT performs a structural check of a Graphviz source: it must have a
+// graph header and balanced braces and brackets outside of strings and comments
+func validateDOT(source string) error {
+	trimmed := strings.TrimSpace(source)
+	if !dotHeaderPattern.MatchString(trimmed) {
+		return fmt.Errorf("invalid DOT source: expected a graph or digraph header")
+	}
+
+	var stack []byte
+	inString, escaped := false, false
+	for i := 0; i < len(trimmed); i++ {
+		c := trimmed[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '/':
+			if i+1 < len(trimmed) && trimmed[i+1] == '/' {
+				i = skipLine(trimmed, i)
+			} else if i+1 < len(trimmed) && trimmed[i+1] == '*' {
+				end := strings.Index(trimmed[i+2:], "*/")
+				if end < 0 {
+					return fmt.Errorf("invalid DOT source: unterminated comment")
+				}
+				i += end + 3
+			}
+		case '#':
+			i = skipLine(trimmed, i)
+		case '{', '[':
+			stack = append(stack, c)
+		case '}', ']':
+			open := byte('{')
+			if c == ']' {
+				open = '['
+			}
+			if len(stack) == 0 || stack[len(stack)-1] != open {
+				return fmt.Errorf("invalid DOT source: unbalanced %q", c)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if inString {
+		return fmt.Errorf("invalid DOT source: unterminated string")
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("invalid DOT source: unclosed %q", stack[len(stack)-1])
+	}
+	return nil
+}
+
+// validateMermaid checks that a mermaid source starts with a known diagram type
+func validateMermaid(source string) error {
+	for _, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "%%") {
+			continue
+		}
+		keyword := strings.Fields(line)[0]
+		for _, diagramType := range mermaidDiagramTypes {
+			if keyword == diagramType {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid mermaid source: unknown diagram type %q", keyword)
+	}
+	return fmt.Errorf("invalid mermaid source: source is empty")
+}
+
+// skipLine returns the index of the end of the line containing position i
+func skipLine(s string, i int) int {
+	if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+		return i + end
+	}
+	return len(s)
+}
@@ -0,0 +1,99 @@
+package mcp
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderDiagramExecution tests that diagram sources are rendered through the executor
+func TestRenderDiagramExecution(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       DiagramRenderArgs
+		mimeType   string
+		scriptPart string
+	}{
+		{
+			name:       "DOT to SVG",
+			args:       DiagramRenderArgs{Source: "digraph { a -> b }"},
+			mimeType:   "image/svg+xml",
+			scriptPart: "DiagrammeRsvg::export_svg",
+		},
+		{
+			name:       "Mermaid to PNG",
+			args:       DiagramRenderArgs{Source: "graph TD\n  A --> B", OutputType: "png"},
+			mimeType:   "image/png",
+			scriptPart: "DiagrammeR::mermaid",
+		},
+		{
+			name:       "Mermaid decision node defaults to PNG",
+			args:       DiagramRenderArgs{Source: "graph TD\n  A --> B{Decision}\n  B --> C"},
+			mimeType:   "image/png",
+			scriptPart: "DiagrammeR::mermaid",
+		},
+		{
+			name:       "DOT with brace on the next line",
+			args:       DiagramRenderArgs{Source: "digraph G\n{\n  a -> b\n}"},
+			mimeType:   "image/svg+xml",
+			scriptPart: "DiagrammeRsvg::export_svg",
+		},
+		{
+			name:       "Edge list with layout",
+			args:       DiagramRenderArgs{Edges: [][]string{{"a", "b"}, {"b", "c"}}, Layout: "circle", Directed: true},
+			mimeType:   "image/svg+xml",
+			scriptPart: "igraph::layout_in_circle(g)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockExecutor := &MockRExecutor{
+				MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+					script, err := os.ReadFile(config.ScriptPath)
+					require.NoError(t, err)
+					assert.Contains(t, string(script), tt.scriptPart)
+					return []byte("mock-diagram"), nil
+				},
+			}
+			cleanup := SetupMockExecutor(mockExecutor)
+			defer cleanup()
+
+			response, err := RenderDiagram(tt.args)
+			require.NoError(t, err)
+			require.Len(t, response.Content, 1)
+			require.NotNil(t, response.Content[0].ImageContent)
+			assert.Equal(t, tt.mimeType, response.Content[0].ImageContent.MimeType)
+		})
+	}
+}
+
+// TestRenderDiagramValidation tests that invalid sources are rejected before execution
+func TestRenderDiagramValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     DiagramRenderArgs
+		errorMsg string
+	}{
+		{"Missing source", DiagramRenderArgs{}, "either source or edges is required"},
+		{"Source and edges", DiagramRenderArgs{Source: "graph {}", Edges: [][]string{{"a", "b"}}}, "cannot be used together"},
+		{"Bad output type", DiagramRenderArgs{Source: "graph {}", OutputType: "gif"}, "output_type must be svg or png"},
+		{"Unbalanced DOT", DiagramRenderArgs{Source: "digraph { a -> b [label=\"}\"]"}, "unclosed '{'"},
+		{"DOT without header", DiagramRenderArgs{Source: "a -> b", Language: "dot"}, "expected a graph or digraph header"},
+		{"Unknown mermaid type", DiagramRenderArgs{Source: "%% comment\nnotADiagram", OutputType: "png"}, "unknown diagram type"},
+		{"Mermaid to SVG", DiagramRenderArgs{Source: "graph TD\n A --> B", OutputType: "svg"}, "mermaid diagrams can only be rendered to png"},
+		{"Bad edge", DiagramRenderArgs{Edges: [][]string{{"a"}}}, "edge 0 must be a [from, to] pair"},
+		{"Bad layout", DiagramRenderArgs{Edges: [][]string{{"a", "b"}}, Layout: "spiral"}, "unsupported layout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := RenderDiagram(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// FontDirs are the directories whose font files are registered with
+// systemfonts and showtext before a plot is rendered
+var FontDirs []string
+
+// fontExtensions are the font file types picked up from FontDirs
+var fontExtensions = map[string]bool{".ttf": true, ".otf": true, ".ttc": true}
+
+// registerFontsScript defines register_fonts(), which groups font files by
+// family and registers the plain, bold, italic and bold italic faces with
+// systemfonts (used by the ragg and svglite devices) and showtext (used for
+// PDF output)
+const registerFontsScript = `
+register_fonts <- function(files) {
+  info <- do.call(rbind, lapply(files, function(f) {
+    i <- systemfonts::font_info(path = f)
+    data.frame(path = f, family = i$family[1], bold = i$bold[1], italic = i$italic[1])
+  }))
+  for (family in unique(info$family)) {
+    faces <- info[info$family == family, ]
+    face <- function(bold, italic) {
+      match <- faces$path[faces$bold == bold & faces$italic == italic]
+      if (length(match) > 0) match[1] else NULL
+    }
+    plain <- face(FALSE, FALSE) %||% faces$path[1]
+    bold <- face(TRUE, FALSE) %||% plain
+    italic <- face(FALSE, TRUE) %||% plain
+    bolditalic <- face(TRUE, TRUE) %||% bold
+    systemfonts::register_font(family, plain, bold, italic, bolditalic)
+    if (requireNamespace("showtext", quietly = TRUE)) {
+      sysfonts::font_add(family, regular = plain, bold = bold, italic = italic, bolditalic = bolditalic)
+    }
+  }
+}
+`
+
+// checkFontScript stops the script when font_family is neither registered
+// nor installed on the system, rather than letting the device substitute it
+const checkFontScript = `
+available_families <- unique(c(systemfonts::registry_fonts()$family, systemfonts::system_fonts()$family))
+if (!(font_family %in% available_families)) {
+  stop(sprintf("font family '%s' is not available; use the list_fonts tool to see the installed fonts", font_family), call. = FALSE)
+}
+update_geom_defaults("text", list(family = font_family))
+update_geom_defaults("label", list(family = font_family))
+`
+
+// ListFontsArgs represents the arguments for listing the available fonts
+type ListFontsArgs struct {
+	Family string `json:"family" jsonschema:"description=Only list families whose name contains this text (case insensitive)"`
+	Source string `json:"source" jsonschema:"description=Which fonts to list (registered, system, all)"`
+
+	BundleOption
+}
+
+// fontFace is a single font file reported by list_fonts
+type fontFace struct {
+	Family string `json:"family"`
+	Style  string `json:"style"`
+	Path   string `json:"path"`
+	Source string `json:"source"`
+}
+
+// fontFamily groups the faces of a family in the list_fonts result
+type fontFamily struct {
+	Family string   `json:"family"`
+	Source string   `json:"source"`
+	Styles []string `json:"styles"`
+}
+
+// ListFonts returns the font families that plots can use, starting with the
+// families registered from FontDirs
+func ListFonts(args ListFontsArgs) (*mcp.ToolResponse, error) {
+	source := args.Source
+	if source == "" {
+		source = "all"
+	} else if source != "registered" && source != "system" && source != "all" {
+		return nil, fmt.Errorf("source must be registered, system or all")
+	}
+
+	preamble, fonts, err := fontPreamble()
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newRJob("fonts-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	scriptContent := fmt.Sprintf(`
+output_file <- %s
+%s
+registered <- systemfonts::registry_fonts()
+installed <- systemfonts::system_fonts()
+fonts <- rbind(
+  data.frame(family = registered$family, style = registered$style, path = registered$path, source = rep("registered", nrow(registered))),
+  data.frame(family = installed$family, style = installed$style, path = installed$path, source = rep("system", nrow(installed)))
+)
+jsonlite::write_json(fonts, output_file)
+`, rQuote(job.Path("fonts.json")), preamble)
+
+	output, err := job.Run(scriptContent, "fonts.json", RExecutionConfig{Inputs: fonts})
+	if err != nil {
+		return nil, err
+	}
+
+	var faces []fontFace
+	if err := json.Unmarshal(output, &faces); err != nil {
+		return nil, fmt.Errorf("failed to parse font list: %w", err)
+	}
+
+	families := groupFontFaces(faces, strings.ToLower(args.Family), source)
+	data, err := json.MarshalIndent(families, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode font list: %w", err)
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(data))), nil
+}
+
+// groupFontFaces groups font faces by family and source, keeping registered
+// families first
+func groupFontFaces(faces []fontFace, filter string, source string) []fontFamily {
+	index := make(map[string]int)
+	families := []fontFamily{}
+	for _, face := range faces {
+		if source != "all" && face.Source != source {
+			continue
+		}
+		if filter != "" && !strings.Contains(strings.ToLower(face.Family), filter) {
+			continue
+		}
+		key := face.Source + "\x00" + face.Family
+		i, ok := index[key]
+		if !ok {
+			i = len(families)
+			index[key] = i
+			families = append(families, fontFamily{Family: face.Family, Source: face.Source})
+		}
+		if !slices.Contains(families[i].Styles, face.Style) {
+			families[i].Styles = append(families[i].Styles, face.Style)
+		}
+	}
+
+	sort.SliceStable(families, func(i, j int) bool {
+		if families[i].Source != families[j].Source {
+			return families[i].Source == "registered"
+		}
+		return families[i].Family < families[j].Family
+	})
+	return families
+}
+
+// fontFiles returns the font files found in FontDirs
+func fontFiles() ([]string, error) {
+	var files []string
+	for _, dir := range FontDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && fontExtensions[strings.ToLower(filepath.Ext(path))] {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font directory %s: %w", dir, err)
+		}
+	}
+	return files, nil
+}
+
+// fontPreamble returns the R code that registers the fonts found in FontDirs,
+// or an empty string when no fonts are configured, along with the font files
+func fontPreamble() (string, []string, error) {
+	files, err := fontFiles()
+	if err != nil || len(files) == 0 {
+		return "", nil, err
+	}
+
+	quoted := make([]string, len(files))
+	for i, file := range files {
+		quoted[i] = rQuote(file)
+	}
+	return fmt.Sprintf("# Register the configured fonts%s\nregister_fonts(c(%s))\n",
+		registerFontsScript, strings.Join(quoted, ", ")), files, nil
+}
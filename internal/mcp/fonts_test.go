@@ -0,0 +1,64 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderGGPlotFontFamily tests that configured fonts are registered and the family is checked
+func TestRenderGGPlotFontFamily(t *testing.T) {
+	fontDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(fontDir, "Brand-Regular.ttf"), []byte("font"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(fontDir, "README.txt"), []byte("not a font"), 0644))
+
+	originalDirs := FontDirs
+	FontDirs = []string{fontDir}
+	defer func() { FontDirs = originalDirs }()
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), `register_fonts(c("`+filepath.Join(fontDir, "Brand-Regular.ttf")+`"))`)
+			assert.NotContains(t, string(script), "README.txt")
+			assert.Contains(t, string(script), `font_family <- "Brand Sans"`)
+			assert.Contains(t, string(script), "is not available; use the list_fonts tool")
+			assert.Contains(t, string(script), "theme(text = element_text(family = font_family))")
+			return []byte("mock-image-data"), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := RenderGGPlot(GGPlotRenderArgs{
+		Code:       "ggplot(mtcars, aes(mpg, hp)) + geom_point()",
+		FontFamily: "Brand Sans",
+	})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 1)
+}
+
+// TestGroupFontFaces tests grouping, filtering and ordering of the font list
+func TestGroupFontFaces(t *testing.T) {
+	faces := []fontFace{
+		{Family: "DejaVu Sans", Style: "Book", Source: "system"},
+		{Family: "Brand Sans", Style: "Regular", Source: "registered"},
+		{Family: "Brand Sans", Style: "Bold", Source: "registered"},
+		{Family: "Brand Sans", Style: "Regular", Source: "system"},
+		{Family: "Arial", Style: "Regular", Source: "system"},
+	}
+
+	families := groupFontFaces(faces, "", "all")
+	require.Len(t, families, 4)
+	assert.Equal(t, fontFamily{Family: "Brand Sans", Source: "registered", Styles: []string{"Regular", "Bold"}}, families[0])
+	assert.Equal(t, "Arial", families[1].Family)
+	assert.Equal(t, "DejaVu Sans", families[3].Family)
+
+	families = groupFontFaces(faces, "brand", "system")
+	require.Len(t, families, 1)
+	assert.Equal(t, "system", families[0].Source)
+}
@@ -0,0 +1,435 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// ForecastArgs represents the arguments for forecasting a time series
+type ForecastArgs struct {
+	Dataset    string    `json:"dataset,omitempty" jsonschema:"description=Name of a catalog or uploaded dataset; either dataset or data is required"`
+	Data       string    `json:"data,omitempty" jsonschema:"description=R code evaluating to a data frame; datasets can be used by name"`
+	Time       string    `json:"time" jsonschema:"required,description=Column holding the dates; date-times or numbers indexing the observations"`
+	Value      string    `json:"value" jsonschema:"required,description=Numeric column to forecast"`
+	Horizon    int       `json:"horizon" jsonschema:"required,description=Number of periods to forecast (maximum 1000)"`
+	Frequency  int       `json:"frequency,omitempty" jsonschema:"description=Number of observations per seasonal cycle such as 12 for monthly or 7 for daily data; inferred from the spacing of the times if omitted"`
+	Method     string    `json:"method,omitempty" jsonschema:"description=Forecasting method (ets, arima, naive, snaive); default ets"`
+	Holdout    int       `json:"holdout,omitempty" jsonschema:"description=Number of final observations held out to measure accuracy (default horizon)"`
+	Levels     []float64 `json:"levels,omitempty" jsonschema:"description=Prediction interval levels in percent (default [80; 95]; at most 5)"`
+	RenderMode string    `json:"render_mode,omitempty" jsonschema:"description=Rendering mode of the chart (image, text, both); as for render_ggplot"`
+
+	BundleOption
+}
+
+// forecastResult is the forecast returned as JSON. The lower and upper
+// bounds of each point follow the order of Levels.
+type forecastResult struct {
+	Method       string            `json:"method"`
+	Engine       string            `json:"engine"`
+	Model        string            `json:"model"`
+	Frequency    int               `json:"frequency"`
+	Horizon      int               `json:"horizon"`
+	Observations int               `json:"observations"`
+	Levels       []float64         `json:"levels"`
+	Forecast     []forecastPoint   `json:"forecast"`
+	Accuracy     *forecastAccuracy `json:"accuracy"`
+	Warnings     []string          `json:"warnings,omitempty"`
+}
+
+// forecastPoint is a point forecast with its prediction intervals. Time is
+// an ISO 8601 string for dates and date-times and a number otherwise.
+type forecastPoint struct {
+	Time  json.RawMessage `json:"time"`
+	Mean  *float64        `json:"mean"`
+	Lower []*float64      `json:"lower"`
+	Upper []*float64      `json:"upper"`
+}
+
+// forecastAccuracy holds the errors of the forecast of the holdout
+// observations from a model fitted to the observations before them
+type forecastAccuracy struct {
+	Holdout int      `json:"holdout"`
+	MAE     *float64 `json:"mae"`
+	RMSE    *float64 `json:"rmse"`
+	MAPE    *float64 `json:"mape"`
+	MASE    *float64 `json:"mase"`
+}
+
+// forecastScript fits the model and writes the forecast as JSON, along with
+// the tail of the series for the chart and the R code of the fit. ETS and
+// ARIMA models use the forecast package when it is installed and fall back
+// to HoltWinters and arima from stats otherwise; naive forecasts only need
+// base R.
+const forecastScript = `
+fail <- function(msg) {
+  message("Error: ", msg)
+  quit(save = "no", status = 1)
+}
+warnings <- character()
+run <- function(expr) withCallingHandlers(
+  tryCatch(expr, error = function(e) fail(conditionMessage(e))),
+  warning = function(w) {
+    warnings <<- c(warnings, conditionMessage(w))
+    invokeRestart("muffleWarning")
+  }
+)
+
+df <- tryCatch(load_data(), error = function(e) fail(conditionMessage(e)))
+if (!is.data.frame(df)) fail(paste("data must evaluate to a data frame, not", class(df)[1]))
+for (col in c(time_col, value_col)) if (!col %in% names(df)) fail(paste("column not found:", col))
+
+t <- df[[time_col]]
+y <- df[[value_col]]
+if (!is.numeric(y)) fail(paste("column", value_col, "must be numeric"))
+if (is.character(t) || is.factor(t)) {
+  t <- as.character(t)
+  t <- if (any(grepl("[ T][0-9]{1,2}:", t))) {
+    as.POSIXct(t, tz = "UTC", tryFormats = c("%Y-%m-%dT%H:%M:%OS", "%Y-%m-%d %H:%M:%OS", "%Y-%m-%dT%H:%M", "%Y-%m-%d %H:%M"), optional = TRUE)
+  } else {
+    as.Date(t, optional = TRUE)
+  }
+}
+if (inherits(t, "POSIXlt")) t <- as.POSIXct(t)
+time_type <- if (inherits(t, "Date")) "date" else if (inherits(t, "POSIXct")) "datetime" else if (is.numeric(t)) "numeric" else
+  fail(paste("column", time_col, "must hold dates, date-times or numbers"))
+if (anyNA(t)) fail(paste("column", time_col, "has missing or unparseable times"))
+o <- order(t)
+t <- t[o]
+y <- as.numeric(y[o])
+if (anyDuplicated(t)) fail(paste("column", time_col, "has duplicate times"))
+if (anyNA(y)) fail(paste("column", value_col, "has", sum(is.na(y)), "missing values; fill or drop them first"))
+n <- length(y)
+if (n < 4) fail("at least 4 observations are needed")
+
+# The spacing of the observations: days for dates and seconds for date-times
+step <- stats::median(diff(as.numeric(t)))
+unit <- NULL
+if (time_type == "date") {
+  unit <- if (step == 1) "day" else if (step == 7) "week" else if (step >= 28 && step <= 31) "month" else
+    if (step >= 89 && step <= 92) "quarter" else if (step >= 365 && step <= 366) "year" else NULL
+}
+if (frequency == 0) {
+  frequency <- if (!is.null(unit)) c(day = 7, week = 52, month = 12, quarter = 4, year = 1)[[unit]] else
+    if (time_type == "datetime" && step == 3600) 24 else 1
+}
+if (method == "snaive" && (frequency < 2 || n < frequency + 2)) {
+  fail("seasonal naive forecasts need a frequency of at least 2 and more than one full cycle of observations")
+}
+
+has_forecast <- requireNamespace("forecast", quietly = TRUE)
+if (method %in% c("ets", "arima") && !has_forecast) {
+  warnings <- c(warnings, "the forecast package is not installed; the model was fitted with base R instead")
+}
+z <- stats::qnorm(0.5 + levels / 200)
+
+# fit forecasts h periods after the series x, returning the point forecasts,
+# the bounds as h x length(levels) matrices, the model and its R code
+fit <- function(x, h) {
+  s <- stats::ts(x, frequency = frequency)
+  seasonal <- frequency > 1 && length(x) >= 2 * frequency
+  level_code <- paste(levels, collapse = ", ")
+  from_se <- function(mean, se, model, code) {
+    mean <- as.numeric(mean)
+    list(mean = mean, lower = mean - outer(se, z), upper = mean + outer(se, z), engine = "base", model = model, code = code)
+  }
+
+  if (method %in% c("ets", "arima") && has_forecast) {
+    m <- if (method == "ets") forecast::ets(s) else forecast::auto.arima(s)
+    fc <- forecast::forecast(m, h = h, level = levels)
+    return(list(
+      mean = as.numeric(fc$mean),
+      lower = matrix(as.numeric(fc$lower), nrow = h),
+      upper = matrix(as.numeric(fc$upper), nrow = h),
+      engine = "forecast", model = fc$method,
+      code = sprintf("fc <- forecast::forecast(forecast::%s(y), h = %d, level = c(%s))", if (method == "ets") "ets" else "auto.arima", h, level_code)
+    ))
+  }
+
+  switch(method,
+    ets = {
+      gamma <- if (seasonal) "" else ", gamma = FALSE"
+      m <- tryCatch(stats::HoltWinters(s, gamma = if (seasonal) NULL else FALSE),
+        error = function(e) NULL)
+      beta <- ""
+      if (is.null(m)) {
+        m <- stats::HoltWinters(s, beta = FALSE, gamma = if (seasonal) NULL else FALSE)
+        beta <- ", beta = FALSE"
+      }
+      bounds <- lapply(levels, function(l) stats::predict(m, n.ahead = h, prediction.interval = TRUE, level = l / 100))
+      list(
+        mean = as.numeric(bounds[[1]][, "fit"]),
+        lower = matrix(vapply(bounds, function(b) as.numeric(b[, "lwr"]), numeric(h)), nrow = h),
+        upper = matrix(vapply(bounds, function(b) as.numeric(b[, "upr"]), numeric(h)), nrow = h),
+        engine = "base",
+        model = if (seasonal) "Holt-Winters (additive seasonality)" else if (isFALSE(m$beta)) "Holt-Winters (level only)" else "Holt-Winters (trend)",
+        code = sprintf("fc <- predict(HoltWinters(y%s%s), n.ahead = %d, prediction.interval = TRUE)", beta, gamma, h)
+      )
+    },
+    arima = {
+      if (seasonal) {
+        m <- stats::arima(s, order = c(1, 1, 1), seasonal = list(order = c(0, 1, 1), period = frequency))
+        model <- sprintf("ARIMA(1,1,1)(0,1,1)[%d]", frequency)
+        code <- sprintf("fc <- predict(arima(y, order = c(1, 1, 1), seasonal = list(order = c(0, 1, 1), period = %d)), n.ahead = %d)", frequency, h)
+      } else {
+        m <- stats::arima(s, order = c(1, 1, 1))
+        model <- "ARIMA(1,1,1)"
+        code <- sprintf("fc <- predict(arima(y, order = c(1, 1, 1)), n.ahead = %d)", h)
+      }
+      p <- stats::predict(m, n.ahead = h)
+      from_se(p$pred, as.numeric(p$se), model, code)
+    },
+    naive = {
+      sigma <- stats::sd(diff(x))
+      from_se(rep(x[length(x)], h), sigma * sqrt(seq_len(h)), "naive", sprintf("fc <- rep(tail(y, 1), %d)", h))
+    },
+    snaive = {
+      m <- frequency
+      sigma <- stats::sd(x[(m + 1):length(x)] - x[seq_len(length(x) - m)])
+      from_se(x[length(x) - m + ((seq_len(h) - 1) %% m) + 1], sigma * sqrt(floor((seq_len(h) - 1) / m) + 1),
+        "seasonal naive", sprintf("fc <- rep_len(tail(y, %d), %d)", m, h))
+    }
+  )
+}
+
+# Measure the accuracy on the holdout with a model fitted to the rest
+accuracy <- NULL
+min_train <- if (method == "snaive") frequency + 2 else 4
+holdout <- min(holdout, n - min_train)
+if (holdout >= 1) {
+  train <- y[seq_len(n - holdout)]
+  actual <- y[(n - holdout + 1):n]
+  f <- run(fit(train, holdout))
+  err <- actual - f$mean
+  lag <- if (frequency > 1 && length(train) > frequency) frequency else 1
+  accuracy <- list(
+    holdout = holdout,
+    mae = mean(abs(err)),
+    rmse = sqrt(mean(err^2)),
+    mape = if (any(actual == 0)) NULL else 100 * mean(abs(err / actual)),
+    mase = mean(abs(err)) / mean(abs(diff(train, lag = lag)))
+  )
+} else {
+  warnings <- c(warnings, "the series is too short for a holdout; accuracy was not measured")
+}
+
+f <- run(fit(y, horizon))
+last <- t[n]
+times <- if (!is.null(unit)) seq(last, by = unit, length.out = horizon + 1)[-1] else last + step * seq_len(horizon)
+format_time <- function(x) switch(time_type,
+  date = format(x),
+  datetime = format(x, "%Y-%m-%dT%H:%M:%SZ", tz = "UTC"),
+  x
+)
+shown <- max(1, n - max(4 * horizon, 100) + 1):n
+
+jsonlite::write_json(list(
+  method = method,
+  engine = f$engine,
+  model = f$model,
+  frequency = frequency,
+  horizon = horizon,
+  observations = n,
+  levels = I(levels),
+  forecast = lapply(seq_len(horizon), function(i) list(
+    time = format_time(times[i]), mean = f$mean[i], lower = I(f$lower[i, ]), upper = I(f$upper[i, ])
+  )),
+  accuracy = accuracy,
+  warnings = I(unique(warnings)),
+  time_type = time_type,
+  history = lapply(shown, function(i) list(time = format_time(t[i]), value = y[i])),
+  code = f$code
+), output_file, auto_unbox = TRUE, na = "null", null = "null", digits = NA)
+`
+
+// Forecast forecasts a time series with ETS, ARIMA or naive methods and
+// returns the point forecasts, prediction intervals and holdout accuracy as
+// JSON with a chart rendered by render_ggplot
+func Forecast(args ForecastArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	loadData, inputs, err := dataLoadCode(args.Dataset, args.Data)
+	if err != nil {
+		return nil, err
+	}
+	if args.Time == "" {
+		return nil, fmt.Errorf("time is required")
+	}
+	if args.Value == "" {
+		return nil, fmt.Errorf("value is required")
+	}
+	if args.Horizon < 1 || args.Horizon > 1000 {
+		return nil, fmt.Errorf("horizon must be between 1 and 1000")
+	}
+	if args.Frequency < 0 || args.Frequency > 1000 {
+		return nil, fmt.Errorf("frequency must be between 0 and 1000")
+	}
+
+	method := args.Method
+	if method == "" {
+		method = "ets"
+	}
+	if method != "ets" && method != "arima" && method != "naive" && method != "snaive" {
+		return nil, fmt.Errorf("method must be ets, arima, naive or snaive")
+	}
+
+	holdout := args.Holdout
+	if holdout == 0 {
+		holdout = args.Horizon
+	} else if holdout < 1 || holdout > 10000 {
+		return nil, fmt.Errorf("holdout must be between 1 and 10000")
+	}
+
+	levels := args.Levels
+	if len(levels) == 0 {
+		levels = []float64{80, 95}
+	} else if len(levels) > 5 {
+		return nil, fmt.Errorf("at most 5 levels can be given")
+	}
+	for _, level := range levels {
+		if level < 50 || level >= 100 {
+			return nil, fmt.Errorf("levels must be percentages between 50 and 100")
+		}
+	}
+	levels = append([]float64(nil), levels...)
+	sort.Float64s(levels)
+
+	renderMode := args.RenderMode
+	if renderMode == "" {
+		renderMode = DefaultRenderMode
+	}
+	if !IsRenderMode(renderMode) {
+		return nil, fmt.Errorf("render_mode must be image, text or both")
+	}
+
+	job, err := newRJob("forecast-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	scriptContent := fmt.Sprintf(`
+load_data <- function() %s
+time_col <- %s
+value_col <- %s
+horizon <- %d
+frequency <- %d
+method <- %s
+holdout <- %d
+levels <- c(%s)
+output_file <- %s
+%s`, loadData, rQuote(args.Time), rQuote(args.Value), args.Horizon, args.Frequency, rQuote(method),
+		holdout, formatRNumbers(levels), rQuote(job.Path("output.json")), forecastScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{Inputs: inputs})
+	if err != nil {
+		return nil, err
+	}
+
+	var output struct {
+		forecastResult
+		TimeType string `json:"time_type"`
+		History  []struct {
+			Time  json.RawMessage `json:"time"`
+			Value *float64        `json:"value"`
+		} `json:"history"`
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(outputData, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse forecast: %w", err)
+	}
+	result := output.forecastResult
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode forecast: %w", err)
+	}
+	content := []*mcp.Content{mcp.NewTextContent(string(data))}
+
+	// Draw the chart with the data inlined, so that its code stands alone in
+	// the session history
+	times := func(raw []json.RawMessage) string {
+		parts := make([]string, len(raw))
+		for i, r := range raw {
+			parts[i] = string(r)
+		}
+		list := "c(" + strings.Join(parts, ", ") + ")"
+		switch output.TimeType {
+		case "date":
+			return "as.Date(" + list + ")"
+		case "datetime":
+			return "as.POSIXct(" + list + ", format = \"%Y-%m-%dT%H:%M:%SZ\", tz = \"UTC\")"
+		}
+		return list
+	}
+	historyTimes := make([]json.RawMessage, len(output.History))
+	historyValues := make([]*float64, len(output.History))
+	for i, point := range output.History {
+		historyTimes[i], historyValues[i] = point.Time, point.Value
+	}
+	forecastTimes := make([]json.RawMessage, len(result.Forecast))
+	means := make([]*float64, len(result.Forecast))
+	for i, point := range result.Forecast {
+		forecastTimes[i], means[i] = point.Time, point.Mean
+	}
+
+	var chart strings.Builder
+	fmt.Fprintf(&chart, "history <- data.frame(time = %s, value = c(%s))\n", times(historyTimes), rNumbersOrNA(historyValues))
+	fmt.Fprintf(&chart, "fc <- data.frame(time = %s, mean = c(%s)", times(forecastTimes), rNumbersOrNA(means))
+	for j, level := range result.Levels {
+		lower := make([]*float64, len(result.Forecast))
+		upper := make([]*float64, len(result.Forecast))
+		for i, point := range result.Forecast {
+			if j < len(point.Lower) && j < len(point.Upper) {
+				lower[i], upper[i] = point.Lower[j], point.Upper[j]
+			}
+		}
+		fmt.Fprintf(&chart, ",\n  lower_%s = c(%s), upper_%s = c(%s)", formatRNumber(level), rNumbersOrNA(lower), formatRNumber(level), rNumbersOrNA(upper))
+	}
+	chart.WriteString(")\nggplot() +\n")
+	levelNames := make([]string, len(result.Levels))
+	for j := len(result.Levels) - 1; j >= 0; j-- {
+		level := formatRNumber(result.Levels[j])
+		levelNames[j] = level + "%"
+		fmt.Fprintf(&chart, "  geom_ribbon(data = fc, aes(x = time, ymin = lower_%s, ymax = upper_%s), fill = \"steelblue\", alpha = %s) +\n",
+			level, level, formatRNumber(0.15+0.15*float64(len(result.Levels)-1-j)))
+	}
+	fmt.Fprintf(&chart, `  geom_line(data = history, aes(x = time, y = value)) +
+  geom_line(data = fc, aes(x = time, y = mean), colour = "steelblue", linewidth = 0.8) +
+  labs(title = %s, subtitle = %s, x = %s, y = %s) +
+  theme_minimal()
+`, rQuote(fmt.Sprintf("%s forecast of %s", result.Model, args.Value)),
+		rQuote("Shaded: "+strings.Join(levelNames, ", ")+" prediction intervals"), rQuote(args.Time), rQuote(args.Value))
+
+	plot, err := RenderGGPlot(GGPlotRenderArgs{Code: chart.String(), Width: 800, Height: 500, RenderMode: renderMode})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render forecast chart: %w", err)
+	}
+	content = append(content, plot.Content...)
+
+	// Record the fit as R code working on the series
+	source := args.Dataset
+	if source == "" {
+		source = "(" + args.Data + ")"
+	}
+	code := fmt.Sprintf("y <- ts(%s$%s[order(%s$%s)], frequency = %d)\n%s",
+		source, rName(args.Value), source, rName(args.Time), result.Frequency, output.Code)
+	session.record("forecast", code, contentOutputs(content[:1]))
+
+	return mcp.NewToolResponse(content...), nil
+}
+
+// rNumbersOrNA formats numbers as a comma separated list of R numeric
+// literals, with NA for missing values
+func rNumbersOrNA(values []*float64) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = "NA"
+		if v != nil {
+			parts[i] = formatRNumber(*v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,117 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleForecast = `{
+	"method": "ets", "engine": "forecast", "model": "ETS(A,N,N)", "frequency": 12, "horizon": 2, "observations": 36,
+	"levels": [80, 95],
+	"forecast": [
+		{"time": "2024-01-01", "mean": 120.5, "lower": [110.2, 104.7], "upper": [130.8, 136.3]},
+		{"time": "2024-02-01", "mean": 120.5, "lower": [106.1, null], "upper": [134.9, null]}
+	],
+	"accuracy": {"holdout": 2, "mae": 4.1, "rmse": 4.6, "mape": 3.5, "mase": 0.82},
+	"warnings": [],
+	"time_type": "date",
+	"history": [{"time": "2023-11-01", "value": 118}, {"time": "2023-12-01", "value": 123}],
+	"code": "fc <- forecast::forecast(forecast::ets(y), h = 2, level = c(80, 95))"
+}`
+
+// TestForecast tests that the options reach the script and the forecast is
+// returned with a chart drawn by render_ggplot
+func TestForecast(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+	setupSession(t)
+
+	var chartScript string
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			if config.OutputFormat == "png" {
+				chartScript = string(script)
+				return []byte("chart-png"), nil
+			}
+			assert.Contains(t, string(script), "time_col <- \"month\"\nvalue_col <- \"sales\"\nhorizon <- 2\nfrequency <- 0\nmethod <- \"ets\"\nholdout <- 2\nlevels <- c(80, 95)\n")
+			return []byte(sampleForecast), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := Forecast(ForecastArgs{Dataset: "regions", Time: "month", Value: "sales", Horizon: 2, Levels: []float64{95, 80}})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 2)
+
+	text := response.Content[0].TextContent.Text
+	assert.NotContains(t, text, "history")
+	assert.NotContains(t, text, "fc <-")
+	var result forecastResult
+	require.NoError(t, json.Unmarshal([]byte(text), &result))
+	assert.Equal(t, "ETS(A,N,N)", result.Model)
+	assert.JSONEq(t, `"2024-02-01"`, string(result.Forecast[1].Time))
+	assert.Nil(t, result.Forecast[1].Lower[1])
+	assert.Equal(t, 0.82, *result.Accuracy.MASE)
+	assert.Equal(t, EncodeImageToBase64([]byte("chart-png")), response.Content[1].ImageContent.Data)
+
+	assert.Contains(t, chartScript, `history <- data.frame(time = as.Date(c("2023-11-01", "2023-12-01")), value = c(118, 123))`)
+	assert.Contains(t, chartScript, `fc <- data.frame(time = as.Date(c("2024-01-01", "2024-02-01")), mean = c(120.5, 120.5),
+  lower_80 = c(110.2, 106.1), upper_80 = c(130.8, 134.9),
+  lower_95 = c(104.7, NA), upper_95 = c(136.3, NA))`)
+	assert.Less(t, strings.Index(chartScript, "ymin = lower_95"), strings.Index(chartScript, "ymin = lower_80"))
+	assert.Contains(t, chartScript, `labs(title = "ETS(A,N,N) forecast of sales", subtitle = "Shaded: 80%, 95% prediction intervals"`)
+
+	entries := session.snapshot()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "render_ggplot", entries[0].Tool)
+	assert.Equal(t, "y <- ts(regions$sales[order(regions$month)], frequency = 12)\n"+
+		"fc <- forecast::forecast(forecast::ets(y), h = 2, level = c(80, 95))", entries[1].Code)
+}
+
+// TestForecastValidation tests the validation of the forecast arguments
+func TestForecastValidation(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+
+	valid := ForecastArgs{Dataset: "regions", Time: "month", Value: "sales", Horizon: 12}
+	with := func(change func(*ForecastArgs)) ForecastArgs {
+		args := valid
+		change(&args)
+		return args
+	}
+
+	tests := []struct {
+		name     string
+		args     ForecastArgs
+		errorMsg string
+	}{
+		{"No data", with(func(a *ForecastArgs) { a.Dataset = "" }), "either dataset or data is required"},
+		{"No time", with(func(a *ForecastArgs) { a.Time = "" }), "time is required"},
+		{"No value", with(func(a *ForecastArgs) { a.Value = "" }), "value is required"},
+		{"No horizon", with(func(a *ForecastArgs) { a.Horizon = 0 }), "horizon must be between 1 and 1000"},
+		{"Bad frequency", with(func(a *ForecastArgs) { a.Frequency = -7 }), "frequency must be between 0 and 1000"},
+		{"Frequency too large", with(func(a *ForecastArgs) { a.Frequency = 1001 }), "frequency must be between 0 and 1000"},
+		{"Bad method", with(func(a *ForecastArgs) { a.Method = "prophet" }), "method must be ets, arima, naive or snaive"},
+		{"Bad holdout", with(func(a *ForecastArgs) { a.Holdout = -1 }), "holdout must be between 1 and 10000"},
+		{"Bad level", with(func(a *ForecastArgs) { a.Levels = []float64{0.95} }), "levels must be percentages between 50 and 100"},
+		{"Too many levels", with(func(a *ForecastArgs) { a.Levels = []float64{50, 60, 70, 80, 90, 95} }), "at most 5 levels can be given"},
+		{"Bad render mode", with(func(a *ForecastArgs) { a.RenderMode = "svg" }), "render_mode must be image, text or both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := Forecast(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package mcp
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,6 +16,20 @@ type GGPlotRenderArgs struct {
 	Width      int    `json:"width" jsonschema:"description=Width of the output image in pixels"`
 	Height     int    `json:"height" jsonschema:"description=Height of the output image in pixels"`
 	Resolution int    `json:"resolution" jsonschema:"description=Resolution of the output image in dpi"`
+	FontFamily string `json:"font_family" jsonschema:"description=Font family for all text in the plot; must be registered or installed (see list_fonts)"`
+	RenderMode string `json:"render_mode" jsonschema:"description=Rendering mode (image, text, both); text returns a Unicode rendition of the plot for clients without image support"`
+
+	BundleOption
+}
+
+// DefaultRenderMode is the render mode used when a request does not set one.
+// MCP has no client capability for image content, so servers talking to
+// text-only clients should set it to text.
+var DefaultRenderMode = "image"
+
+// IsRenderMode reports whether mode is one of the supported render modes
+func IsRenderMode(mode string) bool {
+	return mode == "image" || mode == "text" || mode == "both"
 }
 
 // RenderGGPlot renders a ggplot2 visualization and returns the image directly in the response
@@ -30,26 +45,40 @@ func RenderGGPlot(args GGPlotRenderArgs) (*mcp.ToolResponse, error) {
 		outputType = "png"
 	}
 
-	width := args.Width
-	if width == 0 {
-		width = 800
-	} else if width < 100 || width > 5000 {
-		return nil, fmt.Errorf("width must be between 100 and 5000")
+	renderMode := args.RenderMode
+	if renderMode == "" {
+		renderMode = DefaultRenderMode
+	}
+	if !IsRenderMode(renderMode) {
+		return nil, fmt.Errorf("render_mode must be image, text or both")
 	}
 
-	height := args.Height
-	if height == 0 {
-		height = 600
-	} else if height < 100 || height > 5000 {
-		return nil, fmt.Errorf("height must be between 100 and 5000")
+	width, height, resolution, err := validateImageSize(args.Width, args.Height, args.Resolution)
+	if err != nil {
+		return nil, err
 	}
 
-	resolution := args.Resolution
-	if resolution == 0 {
-		resolution = 96
-	} else if resolution < 72 || resolution > 600 {
-		return nil, fmt.Errorf("resolution must be between 72 and 600")
+	// Register the configured fonts and check the requested family
+	fontCode, inputs, err := fontPreamble()
+	if err != nil {
+		return nil, err
+	}
+	if args.FontFamily != "" {
+		fontCode += fmt.Sprintf("font_family <- %s\n%s", rQuote(args.FontFamily), checkFontScript)
+		if outputType == "pdf" {
+			fontCode += "showtext::showtext_auto()\nshowtext::showtext_opts(dpi = dpi)\n"
+		}
+	}
+
+	datasetCode, err := datasetPreamble()
+	if err != nil {
+		return nil, err
+	}
+	datasets, err := datasetInputs(args.Code)
+	if err != nil {
+		return nil, err
 	}
+	inputs = append(inputs, datasets...)
 
 	// Create a temporary directory for the R script and output
 	tempDir, err := os.MkdirTemp("", "ggplot-")
@@ -61,6 +90,20 @@ func RenderGGPlot(args GGPlotRenderArgs) (*mcp.ToolResponse, error) {
 	// Create the R script
 	scriptPath := filepath.Join(tempDir, "script.R")
 	outputPath := filepath.Join(tempDir, fmt.Sprintf("output.%s", outputType))
+	plotDataPath := filepath.Join(tempDir, "plot_data.json")
+
+	// Choose how the last plot is saved
+	saveCode := "ggsave(output_file, width = width/dpi, height = height/dpi, dpi = dpi)\n"
+	if args.FontFamily != "" {
+		saveCode = "ggsave(output_file, plot = last_plot() + theme(text = element_text(family = font_family)), width = width/dpi, height = height/dpi, dpi = dpi)\n"
+	}
+	if renderMode != "image" {
+		saveCode += fmt.Sprintf("plot_data_file <- %s\n%s", rQuote(plotDataPath), textPlotScript)
+	}
+	if renderMode == "text" {
+		saveCode = fmt.Sprintf("plot_data_file <- %s\n%s", rQuote(plotDataPath), textPlotScript)
+		outputPath = plotDataPath
+	}
 
 	// Generate the R script content
 	scriptContent := fmt.Sprintf(`
@@ -74,13 +117,12 @@ height <- %d
 dpi <- %d
 output_file <- "%s"
 pdf(NULL)
-
+%s%s
 # Execute the provided code
 %s
 
 # Save the last plot
-ggsave(output_file, width = width/dpi, height = height/dpi, dpi = dpi)
-`, width, height, resolution, outputPath, args.Code)
+%s`, width, height, resolution, outputPath, fontCode, datasetCode, args.Code, saveCode)
 
 	// Write the R script to a file
 	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0644); err != nil {
@@ -95,17 +137,63 @@ ggsave(output_file, width = width/dpi, height = height/dpi, dpi = dpi)
 		Width:        width,
 		Height:       height,
 		Resolution:   resolution,
+		Inputs:       inputs,
 	}
 
-	imageData, err := ExecuteRScript(config)
+	outputData, err := ExecuteRScript(config)
 	if err != nil {
+		session.record("render_ggplot", args.Code, errorOutputs(err))
 		return nil, fmt.Errorf("failed to execute R script: %w", err)
 	}
 
-	// Create the image content
-	imageContent := mcp.NewImageContent(
-		EncodeImageToBase64(imageData),
-		GetMimeType(outputType))
+	var content []*mcp.Content
+	if renderMode != "text" {
+		// Create the image content
+		content = append(content, mcp.NewImageContent(
+			EncodeImageToBase64(outputData),
+			GetMimeType(outputType)))
+	}
+
+	if renderMode != "image" {
+		plotData := outputData
+		if renderMode == "both" {
+			if plotData, err = os.ReadFile(plotDataPath); err != nil {
+				return nil, fmt.Errorf("failed to read plot data: %w", err)
+			}
+		}
+
+		var plot textPlot
+		if err := json.Unmarshal(plotData, &plot); err != nil {
+			return nil, fmt.Errorf("failed to parse plot data: %w", err)
+		}
+		cols, rows := textPlotSize(width, height)
+		content = append(content, mcp.NewTextContent(renderTextPlot(plot, cols, rows)))
+	}
+
+	session.record("render_ggplot", args.Code, contentOutputs(content))
+	return mcp.NewToolResponse(content...), nil
+}
+
+// validateImageSize applies the default image dimensions and checks that the
+// requested width, height and resolution are within the supported range
+func validateImageSize(width, height, resolution int) (int, int, int, error) {
+	if width == 0 {
+		width = 800
+	} else if width < 100 || width > 5000 {
+		return 0, 0, 0, fmt.Errorf("width must be between 100 and 5000")
+	}
+
+	if height == 0 {
+		height = 600
+	} else if height < 100 || height > 5000 {
+		return 0, 0, 0, fmt.Errorf("height must be between 100 and 5000")
+	}
+
+	if resolution == 0 {
+		resolution = 96
+	} else if resolution < 72 || resolution > 600 {
+		return 0, 0, 0, fmt.Errorf("resolution must be between 72 and 600")
+	}
 
-	return mcp.NewToolResponse(imageContent), nil
+	return width, height, resolution, nil
 }
@@ -0,0 +1,607 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// testResultSchemaURI is the URI of the resource holding testResultSchema
+const testResultSchemaURI = "schema:///hypothesis_test.json"
+
+// testResultSchema is the JSON Schema of the hypothesis_test result
+const testResultSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "schema:///hypothesis_test.json",
+  "title": "hypothesis_test result",
+  "type": "object",
+  "properties": {
+    "test": {"type": "string", "enum": ["t_test", "wilcoxon", "chi_square", "correlation", "proportion"]},
+    "method": {"type": "string", "description": "Name of the test as reported by R"},
+    "alternative": {"type": "string", "enum": ["two.sided", "less", "greater"]},
+    "null_value": {"type": ["number", "null"], "description": "Value of the estimate under the null hypothesis"},
+    "statistic_name": {"type": "string", "description": "Name of the test statistic, e.g. t, W, X-squared"},
+    "statistic": {"type": ["number", "null"]},
+    "df": {"type": ["number", "null"], "description": "Degrees of freedom of the statistic"},
+    "p_value": {"type": ["number", "null"]},
+    "estimate_name": {"type": "string"},
+    "estimate": {"type": ["number", "null"]},
+    "conf_int": {
+      "type": ["object", "null"],
+      "description": "Confidence interval of the estimate; a null bound is unbounded",
+      "properties": {
+        "level": {"type": "number"},
+        "lower": {"type": ["number", "null"]},
+        "upper": {"type": ["number", "null"]}
+      },
+      "required": ["level", "lower", "upper"]
+    },
+    "effect_size": {
+      "type": ["object", "null"],
+      "properties": {
+        "name": {"type": "string", "enum": ["cohens_d", "r", "cramers_v", "cohens_w", "pearson_r", "spearman_rho", "kendall_tau", "cohens_h"]},
+        "value": {"type": ["number", "null"]},
+        "magnitude": {"type": "string", "enum": ["negligible", "small", "medium", "large"]}
+      },
+      "required": ["name", "value"]
+    },
+    "n": {"type": "integer", "description": "Number of observations used"},
+    "groups": {"type": "array", "items": {"type": "string"}, "description": "Groups compared, in order"},
+    "success": {"type": "string", "description": "Value counted as a success by proportion tests"},
+    "warnings": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["test", "method", "null_value", "statistic_name", "statistic", "df", "p_value", "estimate", "conf_int", "effect_size", "n"]
+}
+`
+
+// testResult is the result of hypothesis_test, described by testResultSchema
+type testResult struct {
+	Test          string        `json:"test"`
+	Method        string        `json:"method"`
+	Alternative   string        `json:"alternative,omitempty"`
+	NullValue     *float64      `json:"null_value"`
+	StatisticName string        `json:"statistic_name"`
+	Statistic     *float64      `json:"statistic"`
+	DF            *float64      `json:"df"`
+	PValue        *float64      `json:"p_value"`
+	EstimateName  string        `json:"estimate_name,omitempty"`
+	Estimate      *float64      `json:"estimate"`
+	ConfInt       *confInterval `json:"conf_int"`
+	EffectSize    *effectSize   `json:"effect_size"`
+	N             int           `json:"n"`
+	Groups        []string      `json:"groups,omitempty"`
+	Success       string        `json:"success,omitempty"`
+	Warnings      []string      `json:"warnings,omitempty"`
+}
+
+// confInterval is a confidence interval; a nil bound is unbounded
+type confInterval struct {
+	Level float64  `json:"level"`
+	Lower *float64 `json:"lower"`
+	Upper *float64 `json:"upper"`
+}
+
+// effectSize is a standardized effect size with its conventional magnitude
+type effectSize struct {
+	Name      string   `json:"name"`
+	Value     *float64 `json:"value"`
+	Magnitude string   `json:"magnitude,omitempty"`
+}
+
+// effectSizes holds the label of each effect size and the thresholds of a
+// small, medium and large effect following Cohen's conventions
+var effectSizes = map[string]struct {
+	label      string
+	thresholds [3]float64
+}{
+	"cohens_d":     {"Cohen's d", [3]float64{0.2, 0.5, 0.8}},
+	"cohens_h":     {"Cohen's h", [3]float64{0.2, 0.5, 0.8}},
+	"r":            {"r", [3]float64{0.1, 0.3, 0.5}},
+	"cramers_v":    {"Cramér's V", [3]float64{0.1, 0.3, 0.5}},
+	"cohens_w":     {"Cohen's w", [3]float64{0.1, 0.3, 0.5}},
+	"pearson_r":    {"Pearson's r", [3]float64{0.1, 0.3, 0.5}},
+	"spearman_rho": {"Spearman's rho", [3]float64{0.1, 0.3, 0.5}},
+	"kendall_tau":  {"Kendall's tau", [3]float64{0.1, 0.3, 0.5}},
+}
+
+// HypothesisTestArgs represents the arguments for running a hypothesis test
+type HypothesisTestArgs struct {
+	Dataset     string  `json:"dataset,omitempty" jsonschema:"description=Name of a catalog or uploaded dataset; either dataset or data is required"`
+	Data        string  `json:"data,omitempty" jsonschema:"description=R code evaluating to a data frame; datasets can be used by name"`
+	Test        string  `json:"test" jsonschema:"required,description=Test to run (t_test, wilcoxon, chi_square, correlation, proportion)"`
+	X           string  `json:"x" jsonschema:"required,description=Column tested: the measurements of t_test and wilcoxon; the first variable of chi_square and correlation; the outcome of proportion"`
+	Y           string  `json:"y,omitempty" jsonschema:"description=Second column: the paired or second sample of t_test and wilcoxon; the second variable of chi_square; required for correlation"`
+	Group       string  `json:"group,omitempty" jsonschema:"description=Column splitting x into the two groups of t_test and wilcoxon or into the groups compared by proportion"`
+	Paired      bool    `json:"paired,omitempty" jsonschema:"description=Pair x and y row by row in t_test and wilcoxon"`
+	NullValue   float64 `json:"null_value,omitempty" jsonschema:"description=Value under the null hypothesis: the mean or location (difference) of t_test and wilcoxon (default 0) or the proportion of proportion tests without groups (default 0.5)"`
+	Success     string  `json:"success,omitempty" jsonschema:"description=Value of x counted as a success by proportion tests; TRUE for logical columns"`
+	Method      string  `json:"method,omitempty" jsonschema:"description=Coefficient of correlation tests (pearson, spearman, kendall); default pearson"`
+	Alternative string  `json:"alternative,omitempty" jsonschema:"description=Alternative hypothesis (two.sided, less, greater); default two.sided"`
+	ConfLevel   float64 `json:"conf_level,omitempty" jsonschema:"description=Confidence level of the interval (default 0.95; between 0.5 and 0.999); the significance level is 1 - conf_level"`
+
+	BundleOption
+}
+
+// hypothesisTestScript runs the test and writes its result as JSON. Rows with
+// missing values in the columns used are dropped, warnings such as inexact
+// p-values are collected, and effect sizes are computed from the samples.
+const hypothesisTestScript = `
+fail <- function(msg) {
+  message("Error: ", msg)
+  quit(save = "no", status = 1)
+}
+warnings <- character()
+run <- function(expr) withCallingHandlers(
+  tryCatch(expr, error = function(e) fail(conditionMessage(e))),
+  warning = function(w) {
+    warnings <<- c(warnings, conditionMessage(w))
+    invokeRestart("muffleWarning")
+  }
+)
+
+df <- tryCatch(load_data(), error = function(e) fail(conditionMessage(e)))
+if (!is.data.frame(df)) fail(paste("data must evaluate to a data frame, not", class(df)[1]))
+
+column <- function(name) {
+  if (!name %in% names(df)) fail(paste("column not found:", name))
+  df[[name]]
+}
+numeric_column <- function(name) {
+  v <- column(name)
+  if (!is.numeric(v)) fail(paste("column", name, "must be numeric for", test))
+  v
+}
+split_groups <- function(values, min_groups, max_groups) {
+  g <- column(group_col)
+  keep <- !is.na(values) & !is.na(g)
+  g <- droplevels(as.factor(g[keep]))
+  if (nlevels(g) < min_groups || nlevels(g) > max_groups) {
+    wanted <- if (min_groups == max_groups) paste("exactly", min_groups) else paste("at least", min_groups)
+    fail(paste("column", group_col, "must have", wanted, "groups, not", nlevels(g)))
+  }
+  groups <<- levels(g)
+  split(values[keep], g)
+}
+
+groups <- NULL
+estimate <- NULL
+estimate_name <- NULL
+effect <- NULL
+
+if (test %in% c("t_test", "wilcoxon")) {
+  x <- numeric_column(x_col)
+  if (nzchar(group_col)) {
+    samples <- split_groups(x, 2, 2)
+    a <- samples[[1]]
+    b <- samples[[2]]
+    design <- "two_sample"
+  } else if (nzchar(y_col)) {
+    y <- numeric_column(y_col)
+    if (paired) {
+      keep <- !is.na(x) & !is.na(y)
+      a <- x[keep]
+      b <- y[keep]
+      design <- "paired"
+    } else {
+      a <- x[!is.na(x)]
+      b <- y[!is.na(y)]
+      design <- "two_sample"
+    }
+  } else {
+    a <- x[!is.na(x)]
+    b <- NULL
+    design <- "one_sample"
+  }
+  n <- length(a) + if (design == "two_sample") length(b) else 0
+
+  if (test == "t_test") {
+    res <- run(stats::t.test(a, b, mu = null_value, paired = design == "paired", alternative = alternative, conf.level = conf_level))
+    estimate_name <- switch(design, one_sample = "mean", paired = "mean difference", two_sample = "difference in means")
+    estimate <- if (design == "two_sample") unname(res$estimate[1] - res$estimate[2]) else unname(res$estimate[1])
+    d <- if (design == "two_sample") {
+      pooled <- sqrt(((length(a) - 1) * stats::var(a) + (length(b) - 1) * stats::var(b)) / (length(a) + length(b) - 2))
+      (mean(a) - mean(b) - null_value) / pooled
+    } else {
+      diffs <- if (design == "paired") a - b else a
+      (mean(diffs) - null_value) / stats::sd(diffs)
+    }
+    effect <- list(name = "cohens_d", value = d)
+  } else {
+    res <- run(stats::wilcox.test(a, b, mu = null_value, paired = design == "paired", alternative = alternative, conf.int = TRUE, conf.level = conf_level))
+    estimate_name <- switch(design, one_sample = "pseudomedian", paired = "pseudomedian of differences", two_sample = "difference in location")
+    if (!is.null(res$estimate)) estimate <- unname(res$estimate[1])
+    p <- if (alternative == "two.sided") res$p.value / 2 else res$p.value
+    effect <- list(name = "r", value = stats::qnorm(p, lower.tail = FALSE) / sqrt(n))
+  }
+} else if (test == "chi_square") {
+  x <- column(x_col)
+  if (nzchar(y_col)) {
+    tab <- table(x, column(y_col))
+    res <- run(stats::chisq.test(tab))
+    effect <- list(name = "cramers_v", value = sqrt(unname(res$statistic) / (sum(tab) * (min(dim(tab)) - 1))))
+  } else {
+    tab <- table(x)
+    res <- run(stats::chisq.test(tab))
+    effect <- list(name = "cohens_w", value = sqrt(unname(res$statistic) / sum(tab)))
+  }
+  n <- sum(tab)
+} else if (test == "correlation") {
+  x <- numeric_column(x_col)
+  y <- numeric_column(y_col)
+  res <- run(stats::cor.test(x, y, method = cor_method, alternative = alternative, conf.level = conf_level))
+  n <- sum(stats::complete.cases(x, y))
+  estimate_name <- names(res$estimate)
+  estimate <- unname(res$estimate[1])
+  effect <- list(name = switch(cor_method, pearson = "pearson_r", spearman = "spearman_rho", kendall = "kendall_tau"), value = estimate)
+} else if (test == "proportion") {
+  x <- column(x_col)
+  if (!nzchar(success)) {
+    if (!is.logical(x)) fail(paste("success is required unless column", x_col, "is logical"))
+    success <- "TRUE"
+  }
+  hits <- as.character(x) == success
+  if (nzchar(group_col)) {
+    samples <- split_groups(hits, 2, Inf)
+    counts <- vapply(samples, sum, numeric(1))
+    totals <- lengths(samples)
+    res <- run(stats::prop.test(counts, totals, alternative = alternative, conf.level = conf_level))
+    n <- sum(totals)
+    if (length(samples) == 2) {
+      estimate_name <- "difference in proportions"
+      estimate <- unname(res$estimate[1] - res$estimate[2])
+      effect <- list(name = "cohens_h", value = unname(2 * asin(sqrt(res$estimate[1])) - 2 * asin(sqrt(res$estimate[2]))))
+    } else {
+      effect <- list(name = "cramers_v", value = sqrt(unname(res$statistic) / n))
+    }
+  } else {
+    hits <- hits[!is.na(hits)]
+    n <- length(hits)
+    res <- run(stats::prop.test(sum(hits), n, p = null_value, alternative = alternative, conf.level = conf_level))
+    estimate_name <- "proportion"
+    estimate <- unname(res$estimate[1])
+    effect <- list(name = "cohens_h", value = 2 * asin(sqrt(estimate)) - 2 * asin(sqrt(null_value)))
+  }
+}
+
+conf_int <- NULL
+if (!is.null(res$conf.int)) {
+  conf_int <- list(level = attr(res$conf.int, "conf.level"), lower = res$conf.int[1], upper = res$conf.int[2])
+}
+jsonlite::write_json(list(
+  test = test,
+  method = trimws(res$method),
+  alternative = res$alternative,
+  null_value = if (is.null(res$null.value) || length(res$null.value) != 1) NULL else unname(res$null.value),
+  statistic_name = names(res$statistic),
+  statistic = unname(res$statistic),
+  df = if (is.null(res$parameter)) NULL else unname(res$parameter[1]),
+  p_value = res$p.value,
+  estimate_name = estimate_name,
+  estimate = estimate,
+  conf_int = conf_int,
+  effect_size = effect,
+  n = n,
+  groups = if (is.null(groups)) NULL else I(groups),
+  success = if (test == "proportion") success else NULL,
+  warnings = I(unique(warnings))
+), output_file, auto_unbox = TRUE, na = "null", null = "null", digits = NA)
+`
+
+// HypothesisTest runs a t, Wilcoxon, chi-squared, correlation or proportion
+// test on the columns of a dataset and returns the result as JSON with a
+// plain-language interpretation
+func HypothesisTest(args HypothesisTestArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	loadData, inputs, err := dataLoadCode(args.Dataset, args.Data)
+	if err != nil {
+		return nil, err
+	}
+	if args.Test == "" {
+		return nil, fmt.Errorf("test is required")
+	}
+	if args.X == "" {
+		return nil, fmt.Errorf("x is required")
+	}
+
+	alternative := args.Alternative
+	if alternative == "" {
+		alternative = "two.sided"
+	} else if alternative != "two.sided" && alternative != "less" && alternative != "greater" {
+		return nil, fmt.Errorf("alternative must be two.sided, less or greater")
+	}
+
+	confLevel := args.ConfLevel
+	if confLevel == 0 {
+		confLevel = 0.95
+	} else if confLevel < 0.5 || confLevel > 0.999 {
+		return nil, fmt.Errorf("conf_level must be between 0.5 and 0.999")
+	}
+
+	corMethod := args.Method
+	if args.Test == "correlation" && corMethod == "" {
+		corMethod = "pearson"
+	}
+	nullValue := args.NullValue
+
+	switch args.Test {
+	case "t_test", "wilcoxon":
+		if args.Group != "" && args.Y != "" {
+			return nil, fmt.Errorf("y and group cannot be used together")
+		}
+		if args.Paired && args.Y == "" {
+			return nil, fmt.Errorf("paired tests need y")
+		}
+	case "chi_square":
+		if args.Group != "" {
+			return nil, fmt.Errorf("chi_square tests take the second variable as y, not group")
+		}
+		if alternative != "two.sided" {
+			return nil, fmt.Errorf("chi_square tests only have a two.sided alternative")
+		}
+		if nullValue != 0 {
+			return nil, fmt.Errorf("null_value cannot be used with chi_square tests")
+		}
+	case "correlation":
+		if args.Y == "" {
+			return nil, fmt.Errorf("correlation tests need y")
+		}
+		if args.Group != "" {
+			return nil, fmt.Errorf("group cannot be used with correlation tests")
+		}
+		if corMethod != "pearson" && corMethod != "spearman" && corMethod != "kendall" {
+			return nil, fmt.Errorf("method must be pearson, spearman or kendall")
+		}
+		if nullValue != 0 {
+			return nil, fmt.Errorf("null_value cannot be used with correlation tests")
+		}
+	case "proportion":
+		if args.Y != "" {
+			return nil, fmt.Errorf("proportion tests compare groups given by group, not y")
+		}
+		if args.Group != "" {
+			if nullValue != 0 {
+				return nil, fmt.Errorf("null_value cannot be used with groups in proportion tests")
+			}
+		} else if nullValue == 0 {
+			nullValue = 0.5
+		} else if nullValue <= 0 || nullValue >= 1 {
+			return nil, fmt.Errorf("null_value must be a proportion between 0 and 1")
+		}
+	default:
+		return nil, fmt.Errorf("test must be t_test, wilcoxon, chi_square, correlation or proportion")
+	}
+	if args.Paired && args.Test != "t_test" && args.Test != "wilcoxon" {
+		return nil, fmt.Errorf("paired can only be used with t_test and wilcoxon")
+	}
+	if args.Success != "" && args.Test != "proportion" {
+		return nil, fmt.Errorf("success can only be used with proportion tests")
+	}
+	if args.Method != "" && args.Test != "correlation" {
+		return nil, fmt.Errorf("method can only be used with correlation tests")
+	}
+
+	job, err := newRJob("hypothesis-test-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	scriptContent := fmt.Sprintf(`
+load_data <- function() %s
+test <- %s
+x_col <- %s
+y_col <- %s
+group_col <- %s
+paired <- %s
+null_value <- %s
+success <- %s
+cor_method <- %s
+alternative <- %s
+conf_level <- %s
+output_file <- %s
+%s`, loadData, rQuote(args.Test), rQuote(args.X), rQuote(args.Y), rQuote(args.Group), rBool(args.Paired),
+		formatRNumber(nullValue), rQuote(args.Success), rQuote(corMethod), rQuote(alternative),
+		formatRNumber(confLevel), rQuote(job.Path("output.json")), hypothesisTestScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{Inputs: inputs})
+	if err != nil {
+		return nil, err
+	}
+
+	var result testResult
+	if err := json.Unmarshal(outputData, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse test result: %w", err)
+	}
+	if result.EffectSize != nil && result.EffectSize.Value != nil {
+		result.EffectSize.Magnitude = effectMagnitude(result.EffectSize.Name, *result.EffectSize.Value)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode test result: %w", err)
+	}
+	content := []*mcp.Content{
+		mcp.NewTextContent(string(data)),
+		mcp.NewTextContent(interpretTest(args, result, 1-confLevel)),
+	}
+
+	session.record("hypothesis_test", testCall(args, alternative, nullValue, confLevel, corMethod), contentOutputs(content))
+	return mcp.NewToolResponse(content...), nil
+}
+
+// effectMagnitude classifies an effect size as negligible, small, medium or
+// large
+func effectMagnitude(name string, value float64) string {
+	info, ok := effectSizes[name]
+	if !ok || math.IsNaN(value) {
+		return ""
+	}
+	magnitude := "negligible"
+	for i, label := range []string{"small", "medium", "large"} {
+		if math.Abs(value) >= info.thresholds[i] {
+			magnitude = label
+		}
+	}
+	return magnitude
+}
+
+// interpretTest describes the outcome of a test in plain language, comparing
+// its p-value with the significance level alpha
+func interpretTest(args HypothesisTestArgs, result testResult, alpha float64) string {
+	if result.PValue == nil {
+		return fmt.Sprintf("%s could not compute a p-value for these data.", result.Method)
+	}
+	p := *result.PValue
+
+	var b strings.Builder
+	pText := "p = " + formatSignificant(p)
+	if p < 0.001 {
+		pText = "p < 0.001"
+	}
+	claim := testClaim(args, result)
+	if p < alpha {
+		fmt.Fprintf(&b, "%s: %s, below the %s significance level. The data provide evidence that %s.",
+			result.Method, pText, formatSignificant(alpha), claim)
+	} else {
+		fmt.Fprintf(&b, "%s: %s, not below the %s significance level. The data do not provide evidence that %s.",
+			result.Method, pText, formatSignificant(alpha), claim)
+	}
+
+	if result.EffectSize != nil && result.EffectSize.Value != nil && result.EffectSize.Magnitude != "" {
+		fmt.Fprintf(&b, " The effect is %s (%s = %s).", result.EffectSize.Magnitude,
+			effectSizes[result.EffectSize.Name].label, formatSignificant(*result.EffectSize.Value))
+	}
+
+	if result.Estimate != nil && result.ConfInt != nil {
+		fmt.Fprintf(&b, " The estimated %s is %s with a %s%% confidence interval of [%s, %s].",
+			result.EstimateName, formatSignificant(*result.Estimate), formatSignificant(result.ConfInt.Level*100),
+			formatBound(result.ConfInt.Lower, "-Inf"), formatBound(result.ConfInt.Upper, "Inf"))
+	} else if result.Estimate != nil {
+		fmt.Fprintf(&b, " The estimated %s is %s.", result.EstimateName, formatSignificant(*result.Estimate))
+	}
+
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(&b, "\n\nWarning: %s", warning)
+	}
+	return b.String()
+}
+
+// testClaim states the alternative hypothesis of a test
+func testClaim(args HypothesisTestArgs, result testResult) string {
+	relation := map[string]string{"two.sided": "differs from", "less": "is less than", "greater": "is greater than"}[result.Alternative]
+	null := ""
+	if result.NullValue != nil {
+		null = formatSignificant(*result.NullValue)
+	}
+	groups := ""
+	if len(result.Groups) == 2 {
+		groups = fmt.Sprintf(" between %s = %s and %s = %s", args.Group, result.Groups[0], args.Group, result.Groups[1])
+	}
+
+	switch args.Test {
+	case "t_test", "wilcoxon":
+		measure, shift := "mean", "difference in means"
+		if args.Test == "wilcoxon" {
+			measure, shift = "location", "location shift"
+		}
+		switch {
+		case args.Paired:
+			return fmt.Sprintf("the %s of the differences %s - %s %s %s", measure, args.X, args.Y, relation, null)
+		case groups != "":
+			return fmt.Sprintf("the %s of %s%s %s %s", shift, args.X, groups, relation, null)
+		case args.Y != "":
+			return fmt.Sprintf("the %s between %s and %s %s %s", shift, args.X, args.Y, relation, null)
+		default:
+			return fmt.Sprintf("the %s of %s %s %s", measure, args.X, relation, null)
+		}
+	case "chi_square":
+		if args.Y == "" {
+			return fmt.Sprintf("the values of %s are not equally frequent", args.X)
+		}
+		return fmt.Sprintf("%s and %s are associated", args.X, args.Y)
+	case "correlation":
+		direction := map[string]string{"two.sided": "correlated", "less": "negatively correlated", "greater": "positively correlated"}[result.Alternative]
+		return fmt.Sprintf("%s and %s are %s", args.X, args.Y, direction)
+	case "proportion":
+		share := fmt.Sprintf("the proportion of %s = %s", args.X, result.Success)
+		switch {
+		case len(result.Groups) == 2:
+			return fmt.Sprintf("the difference in %s%s %s 0", share, groups, relation)
+		case args.Group != "":
+			return fmt.Sprintf("%s differs between the groups of %s", share, args.Group)
+		default:
+			return fmt.Sprintf("%s %s %s", share, relation, null)
+		}
+	}
+	return "the null hypothesis is false"
+}
+
+// formatSignificant formats a number with three significant digits
+func formatSignificant(f float64) string {
+	return strconv.FormatFloat(f, 'g', 3, 64)
+}
+
+// formatBound formats a confidence interval bound, which is unbounded when nil
+func formatBound(f *float64, unbounded string) string {
+	if f == nil {
+		return unbounded
+	}
+	return formatSignificant(*f)
+}
+
+// testCall returns the R call equivalent to a test, for the session history
+func testCall(args HypothesisTestArgs, alternative string, nullValue float64, confLevel float64, corMethod string) string {
+	data := args.Dataset
+	if data == "" {
+		data = "(" + args.Data + ")"
+	}
+	column := func(name string) string {
+		return data + "$" + rName(name)
+	}
+	options := fmt.Sprintf("alternative = %s, conf.level = %s", rQuote(alternative), formatRNumber(confLevel))
+
+	switch args.Test {
+	case "t_test", "wilcoxon":
+		fn := "t.test"
+		if args.Test == "wilcoxon" {
+			fn = "wilcox.test"
+			options += ", conf.int = TRUE"
+		}
+		options = fmt.Sprintf("mu = %s, %s", formatRNumber(nullValue), options)
+		switch {
+		case args.Group != "":
+			return fmt.Sprintf("%s(%s ~ %s, data = %s, %s)", fn, rName(args.X), rName(args.Group), data, options)
+		case args.Y != "":
+			return fmt.Sprintf("%s(%s, %s, paired = %s, %s)", fn, column(args.X), column(args.Y), rBool(args.Paired), options)
+		default:
+			return fmt.Sprintf("%s(%s, %s)", fn, column(args.X), options)
+		}
+	case "chi_square":
+		if args.Y != "" {
+			return fmt.Sprintf("chisq.test(table(%s, %s))", column(args.X), column(args.Y))
+		}
+		return fmt.Sprintf("chisq.test(table(%s))", column(args.X))
+	case "correlation":
+		return fmt.Sprintf("cor.test(%s, %s, method = %s, %s)", column(args.X), column(args.Y), rQuote(corMethod), options)
+	default:
+		success := rQuote(args.Success)
+		if args.Success == "" {
+			success = "\"TRUE\""
+		}
+		if args.Group != "" {
+			return fmt.Sprintf("prop.test(tapply(%s == %s, %s, sum, na.rm = TRUE), tapply(!is.na(%s), %s, sum), %s)",
+				column(args.X), success, column(args.Group), column(args.X), column(args.Group), options)
+		}
+		return fmt.Sprintf("prop.test(sum(%s == %s, na.rm = TRUE), sum(!is.na(%s)), p = %s, %s)",
+			column(args.X), success, column(args.X), formatRNumber(nullValue), options)
+	}
+}
+
+// testResultSchemaResource returns the JSON Schema of the hypothesis_test result
+func testResultSchemaResource() (*mcp.ResourceResponse, error) {
+	return mcp.NewResourceResponse(mcp.NewTextEmbeddedResource(testResultSchemaURI, testResultSchema, "application/schema+json")), nil
+}
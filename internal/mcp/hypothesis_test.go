@@ -0,0 +1,143 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleTestResult = `{
+	"test": "t_test", "method": "Welch Two Sample t-test", "alternative": "two.sided", "null_value": 0,
+	"statistic_name": "t", "statistic": -3.77, "df": 22.72, "p_value": 0.00101,
+	"estimate_name": "difference in means", "estimate": -7.24, "conf_int": {"level": 0.95, "lower": -11.28, "upper": -3.21},
+	"effect_size": {"name": "cohens_d", "value": -1.48}, "n": 32, "groups": ["0", "1"], "success": null, "warnings": []
+}`
+
+// TestHypothesisTest tests that the test options reach the script and the
+// result is returned with an interpretation
+func TestHypothesisTest(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+	setupSession(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "test <- \"t_test\"\nx_col <- \"mpg\"\ny_col <- \"\"\ngroup_col <- \"am\"\npaired <- FALSE\nnull_value <- 0\n")
+			assert.Contains(t, string(script), "alternative <- \"two.sided\"\nconf_level <- 0.95\n")
+			return []byte(sampleTestResult), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := HypothesisTest(HypothesisTestArgs{Dataset: "regions", Test: "t_test", X: "mpg", Group: "am"})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 2)
+
+	var result testResult
+	require.NoError(t, json.Unmarshal([]byte(response.Content[0].TextContent.Text), &result))
+	assert.Equal(t, 22.72, *result.DF)
+	assert.Equal(t, "large", result.EffectSize.Magnitude)
+	assert.Equal(t, []string{"0", "1"}, result.Groups)
+	assert.NotContains(t, response.Content[0].TextContent.Text, "success")
+
+	assert.Equal(t, "Welch Two Sample t-test: p = 0.00101, below the 0.05 significance level. "+
+		"The data provide evidence that the difference in means of mpg between am = 0 and am = 1 differs from 0. "+
+		"The effect is large (Cohen's d = -1.48). "+
+		"The estimated difference in means is -7.24 with a 95% confidence interval of [-11.3, -3.21].", response.Content[1].TextContent.Text)
+
+	entries := session.snapshot()
+	require.Len(t, entries, 1)
+	assert.Equal(t, `t.test(mpg ~ am, data = regions, mu = 0, alternative = "two.sided", conf.level = 0.95)`, entries[0].Code)
+}
+
+// TestInterpretTest tests the interpretation of results that are not
+// significant, one-sided or carry warnings
+func TestInterpretTest(t *testing.T) {
+	p := 0.42
+	estimate := 0.56
+	lower := 0.31
+	result := testResult{
+		Method:       "1-sample proportions test with continuity correction",
+		Alternative:  "greater",
+		NullValue:    &[]float64{0.5}[0],
+		PValue:       &p,
+		EstimateName: "proportion",
+		Estimate:     &estimate,
+		ConfInt:      &confInterval{Level: 0.9, Lower: &lower},
+		Success:      "yes",
+		Warnings:     []string{"Chi-squared approximation may be incorrect"},
+	}
+	args := HypothesisTestArgs{Test: "proportion", X: "churned"}
+	assert.Equal(t, "1-sample proportions test with continuity correction: p = 0.42, not below the 0.1 significance level. "+
+		"The data do not provide evidence that the proportion of churned = yes is greater than 0.5. "+
+		"The estimated proportion is 0.56 with a 90% confidence interval of [0.31, Inf].\n\n"+
+		"Warning: Chi-squared approximation may be incorrect", interpretTest(args, result, 0.1))
+
+	assert.Equal(t, "x and y are negatively correlated", testClaim(HypothesisTestArgs{Test: "correlation", X: "x", Y: "y"}, testResult{Alternative: "less"}))
+	assert.Equal(t, "the location of the differences before - after differs from 0",
+		testClaim(HypothesisTestArgs{Test: "wilcoxon", X: "before", Y: "after", Paired: true}, testResult{Alternative: "two.sided", NullValue: &[]float64{0}[0]}))
+	assert.Equal(t, "the values of colour are not equally frequent", testClaim(HypothesisTestArgs{Test: "chi_square", X: "colour"}, testResult{}))
+
+	assert.Equal(t, "negligible", effectMagnitude("cramers_v", 0.05))
+	assert.Equal(t, "medium", effectMagnitude("cohens_h", -0.6))
+	assert.Equal(t, "", effectMagnitude("unknown", 1))
+}
+
+// TestHypothesisTestCall tests the R calls recorded in the session history
+func TestHypothesisTestCall(t *testing.T) {
+	assert.Equal(t, "wilcox.test(sales$before, sales$`after tax`, paired = TRUE, mu = 0, alternative = \"less\", conf.level = 0.95, conf.int = TRUE)",
+		testCall(HypothesisTestArgs{Dataset: "sales", Test: "wilcoxon", X: "before", Y: "after tax", Paired: true}, "less", 0, 0.95, ""))
+	assert.Equal(t, "chisq.test(table((mtcars)$cyl, (mtcars)$gear))",
+		testCall(HypothesisTestArgs{Data: "mtcars", Test: "chi_square", X: "cyl", Y: "gear"}, "two.sided", 0, 0.95, ""))
+	assert.Equal(t, "cor.test(mtcars$wt, mtcars$mpg, method = \"kendall\", alternative = \"two.sided\", conf.level = 0.9)",
+		testCall(HypothesisTestArgs{Dataset: "mtcars", Test: "correlation", X: "wt", Y: "mpg"}, "two.sided", 0, 0.9, "kendall"))
+	assert.Equal(t, "prop.test(sum(users$churned == \"TRUE\", na.rm = TRUE), sum(!is.na(users$churned)), p = 0.2, alternative = \"two.sided\", conf.level = 0.95)",
+		testCall(HypothesisTestArgs{Dataset: "users", Test: "proportion", X: "churned"}, "two.sided", 0.2, 0.95, ""))
+}
+
+// TestHypothesisTestValidation tests the validation of the test arguments
+func TestHypothesisTestValidation(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+
+	tests := []struct {
+		name     string
+		args     HypothesisTestArgs
+		errorMsg string
+	}{
+		{"No data", HypothesisTestArgs{Test: "t_test", X: "x"}, "either dataset or data is required"},
+		{"No test", HypothesisTestArgs{Dataset: "regions", X: "x"}, "test is required"},
+		{"Unknown test", HypothesisTestArgs{Dataset: "regions", Test: "anova", X: "x"}, "test must be t_test, wilcoxon, chi_square, correlation or proportion"},
+		{"No x", HypothesisTestArgs{Dataset: "regions", Test: "t_test"}, "x is required"},
+		{"Bad alternative", HypothesisTestArgs{Dataset: "regions", Test: "t_test", X: "x", Alternative: "two-sided"}, "alternative must be two.sided, less or greater"},
+		{"Bad confidence level", HypothesisTestArgs{Dataset: "regions", Test: "t_test", X: "x", ConfLevel: 95}, "conf_level must be between 0.5 and 0.999"},
+		{"Y and group", HypothesisTestArgs{Dataset: "regions", Test: "t_test", X: "x", Y: "y", Group: "g"}, "y and group cannot be used together"},
+		{"Paired without y", HypothesisTestArgs{Dataset: "regions", Test: "wilcoxon", X: "x", Paired: true}, "paired tests need y"},
+		{"One-sided chi-square", HypothesisTestArgs{Dataset: "regions", Test: "chi_square", X: "x", Alternative: "less"}, "chi_square tests only have a two.sided alternative"},
+		{"Correlation without y", HypothesisTestArgs{Dataset: "regions", Test: "correlation", X: "x"}, "correlation tests need y"},
+		{"Bad correlation method", HypothesisTestArgs{Dataset: "regions", Test: "correlation", X: "x", Y: "y", Method: "distance"}, "method must be pearson, spearman or kendall"},
+		{"Method with t-test", HypothesisTestArgs{Dataset: "regions", Test: "t_test", X: "x", Method: "spearman"}, "method can only be used with correlation tests"},
+		{"Bad proportion", HypothesisTestArgs{Dataset: "regions", Test: "proportion", X: "x", NullValue: 1.5}, "null_value must be a proportion between 0 and 1"},
+		{"Proportion with y", HypothesisTestArgs{Dataset: "regions", Test: "proportion", X: "x", Y: "y"}, "proportion tests compare groups given by group, not y"},
+		{"Success with t-test", HypothesisTestArgs{Dataset: "regions", Test: "t_test", X: "x", Success: "yes"}, "success can only be used with proportion tests"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := HypothesisTest(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal([]byte(testResultSchema), &schema))
+	assert.Equal(t, testResultSchemaURI, schema["$id"])
+}
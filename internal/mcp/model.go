@@ -0,0 +1,264 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// modelFamilies are the error distributions of glm and gam models
+var modelFamilies = map[string]bool{
+	"gaussian": true, "binomial": true, "poisson": true, "Gamma": true,
+	"inverse.gaussian": true, "quasibinomial": true, "quasipoisson": true,
+}
+
+// modelLinks are the link functions that can be given with a family
+var modelLinks = map[string]bool{
+	"identity": true, "log": true, "logit": true, "probit": true, "cauchit": true,
+	"cloglog": true, "sqrt": true, "inverse": true, "1/mu^2": true,
+}
+
+// formulaFunctions are the functions that model formulas may call: the math
+// functions and the usual formula helpers, including the smooths of mgcv
+var formulaFunctions = map[string]bool{
+	"I": true, "factor": true, "as.factor": true, "as.numeric": true, "poly": true,
+	"scale": true, "offset": true, "interaction": true, "cbind": true, "s": true, "te": true, "ti": true,
+}
+
+func init() {
+	for name := range mathFunctions {
+		formulaFunctions[name] = true
+	}
+}
+
+// formulaDotPattern matches the dot standing for all other columns
+var formulaDotPattern = regexp.MustCompile(`(^|[^A-Za-z0-9._])\.([^A-Za-z0-9._]|$)`)
+
+// FitModelArgs represents the arguments for fitting a statistical model
+type FitModelArgs struct {
+	Dataset     string  `json:"dataset,omitempty" jsonschema:"description=Name of a catalog or uploaded dataset; either dataset or data is required"`
+	Data        string  `json:"data,omitempty" jsonschema:"description=R code evaluating to a data frame; datasets can be used by name"`
+	Formula     string  `json:"formula" jsonschema:"required,description=Model formula over the columns such as mpg ~ wt + factor(cyl)"`
+	Method      string  `json:"method,omitempty" jsonschema:"description=Model type (lm, glm, loess, gam); default lm"`
+	Family      string  `json:"family,omitempty" jsonschema:"description=Error distribution of glm and gam models (gaussian, binomial, poisson, Gamma, inverse.gaussian, quasibinomial, quasipoisson); default gaussian"`
+	Link        string  `json:"link,omitempty" jsonschema:"description=Link function of the family such as logit or log; the default link of the family if omitted"`
+	Span        float64 `json:"span,omitempty" jsonschema:"description=Smoothing span of loess models (default 0.75)"`
+	Diagnostics bool    `json:"diagnostics,omitempty" jsonschema:"description=Also return residuals vs fitted and normal Q-Q plots as images"`
+
+	BundleOption
+}
+
+// fitModelScript fits the model and writes its tidy coefficients, fit
+// statistics and ANOVA table as JSON, along with the diagnostic plots when
+// they are requested
+const fitModelScript = `
+fail <- function(msg) {
+  message("Error: ", msg)
+  quit(save = "no", status = 1)
+}
+if (!requireNamespace("broom", quietly = TRUE)) fail("the broom package is needed to fit models")
+
+df <- tryCatch(load_data(), error = function(e) fail(conditionMessage(e)))
+if (!is.data.frame(df)) fail(paste("data must evaluate to a data frame, not", class(df)[1]))
+
+f <- stats::as.formula(formula_text, env = globalenv())
+unknown <- setdiff(all.vars(f), c(".", names(df)))
+if (length(unknown) > 0) fail(paste("unknown column in formula:", paste(unknown, collapse = ", ")))
+
+fam <- NULL
+if (method %in% c("glm", "gam")) {
+  family_fun <- get(family, mode = "function", envir = asNamespace("stats"))
+  fam <- tryCatch(if (nzchar(link)) family_fun(link = link) else family_fun(), error = function(e) fail(conditionMessage(e)))
+}
+
+model <- tryCatch(switch(method,
+  lm = stats::lm(f, data = df),
+  glm = stats::glm(f, family = fam, data = df),
+  loess = stats::loess(f, data = df, span = span),
+  gam = {
+    if (!requireNamespace("mgcv", quietly = TRUE)) fail("the mgcv package is needed to fit gam models")
+    mgcv::gam(f, family = fam, data = df)
+  }
+), error = function(e) fail(conditionMessage(e)))
+
+as_table <- function(x) {
+  if (is.null(x)) return(list())
+  x <- as.data.frame(x)
+  rownames(x) <- NULL
+  x
+}
+try_table <- function(expr) tryCatch(as_table(expr), error = function(e) list())
+
+coefficients <- switch(method,
+  lm = , glm = try_table(suppressMessages(broom::tidy(model, conf.int = TRUE))),
+  gam = try_table(broom::tidy(model, parametric = TRUE, conf.int = TRUE)),
+  loess = list()
+)
+
+fit <- tryCatch(as.list(as.data.frame(broom::glance(model))), error = function(e) NULL)
+if (is.null(fit) && method == "loess") {
+  fit <- list(nobs = model$n, enp = model$enp, sigma = model$s, span = model$pars$span)
+}
+
+anova_table <- switch(method,
+  lm = try_table(broom::tidy(stats::anova(model))),
+  glm = try_table(broom::tidy(stats::anova(model, test = if (family %in% c("gaussian", "Gamma", "inverse.gaussian") || startsWith(family, "quasi")) "F" else "Chisq"))),
+  list()
+)
+
+result <- list(
+  method = method,
+  formula = paste(deparse(f, width.cutoff = 500L), collapse = " "),
+  family = if (is.null(fam)) NULL else fam$family,
+  link = if (is.null(fam)) NULL else fam$link,
+  n = tryCatch(stats::nobs(model), error = function(e) nrow(df)),
+  coefficients = coefficients,
+  fit = fit,
+  anova = anova_table
+)
+if (method == "gam") result$smooth_terms <- try_table(broom::tidy(model))
+jsonlite::write_json(result, output_file, dataframe = "rows", auto_unbox = TRUE, na = "null", null = "null", digits = NA)
+
+if (diagnostics) {
+  library(ggplot2)
+  pdf(NULL)
+  d <- data.frame(fitted = as.numeric(stats::fitted(model)), residuals = as.numeric(stats::residuals(model)))
+  p <- ggplot(d, aes(fitted, residuals)) +
+    geom_hline(yintercept = 0, linetype = "dashed", colour = "grey50") +
+    geom_point(alpha = 0.6) +
+    geom_smooth(method = "loess", formula = y ~ x, se = FALSE, colour = "firebrick") +
+    labs(title = "Residuals vs fitted", x = "Fitted values", y = "Residuals")
+  ggsave(residuals_file, p, width = 640/96, height = 480/96, dpi = 96)
+  p <- ggplot(d, aes(sample = residuals)) +
+    stat_qq_line(colour = "firebrick") +
+    stat_qq(alpha = 0.6) +
+    labs(title = "Normal Q-Q", x = "Theoretical quantiles", y = "Residual quantiles")
+  ggsave(qq_file, p, width = 640/96, height = 480/96, dpi = 96)
+}
+`
+
+// FitModel fits a linear, generalized linear, loess or gam model and returns
+// its tidy coefficients, fit statistics and ANOVA table as JSON, optionally
+// with residual diagnostic plots
+func FitModel(args FitModelArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	loadData, inputs, err := dataLoadCode(args.Dataset, args.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Formula == "" {
+		return nil, fmt.Errorf("formula is required")
+	}
+	if !strings.Contains(args.Formula, "~") {
+		return nil, fmt.Errorf("invalid formula: a formula needs a ~ between the response and the terms")
+	}
+	if err := validateRExpression(formulaDotPattern.ReplaceAllString(args.Formula, "${1}dot${2}"), nil, formulaFunctions); err != nil {
+		return nil, fmt.Errorf("invalid formula: %w", err)
+	}
+
+	method := args.Method
+	if method == "" {
+		method = "lm"
+	}
+	if method != "lm" && method != "glm" && method != "loess" && method != "gam" {
+		return nil, fmt.Errorf("method must be lm, glm, loess or gam")
+	}
+
+	family := args.Family
+	if method == "glm" || method == "gam" {
+		if family == "" {
+			family = "gaussian"
+		}
+		if !modelFamilies[family] {
+			return nil, fmt.Errorf("family must be gaussian, binomial, poisson, Gamma, inverse.gaussian, quasibinomial or quasipoisson")
+		}
+		if args.Link != "" && !modelLinks[args.Link] {
+			return nil, fmt.Errorf("link must be identity, log, logit, probit, cauchit, cloglog, sqrt, inverse or 1/mu^2")
+		}
+	} else if family != "" || args.Link != "" {
+		return nil, fmt.Errorf("family and link can only be used with glm and gam models")
+	}
+
+	span := args.Span
+	if method == "loess" {
+		if span == 0 {
+			span = 0.75
+		} else if span <= 0 || span > 5 {
+			return nil, fmt.Errorf("span must be greater than 0 and at most 5")
+		}
+	} else if span != 0 {
+		return nil, fmt.Errorf("span can only be used with loess models")
+	}
+
+	job, err := newRJob("fit-model-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	residualsPath := job.Path("residuals.png")
+	qqPath := job.Path("qq.png")
+	scriptContent := fmt.Sprintf(`
+load_data <- function() %s
+formula_text <- %s
+method <- %s
+family <- %s
+link <- %s
+span <- %s
+diagnostics <- %s
+residuals_file <- %s
+qq_file <- %s
+output_file <- %s
+%s`, loadData, rQuote(args.Formula), rQuote(method), rQuote(family), rQuote(args.Link), formatRNumber(span),
+		rBool(args.Diagnostics), rQuote(residualsPath), rQuote(qqPath), rQuote(job.Path("output.json")), fitModelScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{Inputs: inputs})
+	if err != nil {
+		return nil, err
+	}
+
+	var result bytes.Buffer
+	if err := json.Indent(&result, outputData, "", "  "); err != nil {
+		return nil, fmt.Errorf("failed to parse model results: %w", err)
+	}
+	content := []*mcp.Content{mcp.NewTextContent(result.String())}
+
+	if args.Diagnostics {
+		for _, path := range []string{residualsPath, qqPath} {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read diagnostic plot: %w", err)
+			}
+			content = append(content, mcp.NewImageContent(EncodeImageToBase64(data), GetMimeType("png")))
+		}
+	}
+
+	// Record the call that fits the model
+	data := args.Dataset
+	if data == "" {
+		data = "(" + args.Data + ")"
+	}
+	call := fmt.Sprintf("%s(%s, data = %s)", method, args.Formula, data)
+	switch method {
+	case "glm", "gam":
+		familyCall := family + "()"
+		if args.Link != "" {
+			familyCall = fmt.Sprintf("%s(link = %s)", family, rQuote(args.Link))
+		}
+		call = fmt.Sprintf("%s(%s, family = %s, data = %s)", method, args.Formula, familyCall, data)
+		if method == "gam" {
+			call = "mgcv::" + call
+		}
+	case "loess":
+		call = fmt.Sprintf("loess(%s, data = %s, span = %s)", args.Formula, data, formatRNumber(span))
+	}
+	session.record("fit_model", "model <- "+call, contentOutputs(content))
+
+	return mcp.NewToolResponse(content...), nil
+}
@@ -0,0 +1,106 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleModel = `{"method": "glm", "formula": "am ~ wt + hp", "family": "binomial", "link": "logit", "n": 32,
+	"coefficients": [
+		{"term": "(Intercept)", "estimate": 18.87, "std.error": 7.44, "statistic": 2.54, "p.value": 0.011, "conf.low": 8.18, "conf.high": 39.06},
+		{"term": "wt", "estimate": -8.08, "std.error": 3.07, "statistic": -2.63, "p.value": 0.0085, "conf.low": -16.5, "conf.high": -3.5}
+	],
+	"fit": {"null.deviance": 43.23, "df.null": 31, "logLik": -5.28, "AIC": 16.56, "BIC": 20.96, "deviance": 10.06, "df.residual": 29, "nobs": 32},
+	"anova": [
+		{"term": "NULL", "df": null, "deviance": null, "df.residual": 31, "residual.deviance": 43.23, "p.value": null},
+		{"term": "wt", "df": 1, "deviance": 24.23, "df.residual": 30, "residual.deviance": 19.18, "p.value": 8.6e-7}
+	]}`
+
+// TestFitModel tests that the model options reach the script and the results
+// are returned with the diagnostic plots
+func TestFitModel(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+	setupSession(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "load_data <- function() utils::read.csv(")
+			assert.Contains(t, string(script), "formula_text <- \"am ~ wt + hp\"\nmethod <- \"glm\"\nfamily <- \"binomial\"\nlink <- \"\"\nspan <- 0\ndiagnostics <- TRUE\n")
+
+			jobDir := filepath.Dir(config.OutputPath)
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "residuals.png"), []byte("residuals-png"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "qq.png"), []byte("qq-png"), 0644))
+			return []byte(sampleModel), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := FitModel(FitModelArgs{
+		Dataset:     "regions",
+		Formula:     "am ~ wt + hp",
+		Method:      "glm",
+		Family:      "binomial",
+		Diagnostics: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 3)
+
+	var result map[string]any
+	require.NoError(t, json.Unmarshal([]byte(response.Content[0].TextContent.Text), &result))
+	assert.Equal(t, "logit", result["link"])
+	assert.Len(t, result["coefficients"], 2)
+	assert.Contains(t, response.Content[0].TextContent.Text, "\n  \"fit\": {")
+	assert.Equal(t, EncodeImageToBase64([]byte("residuals-png")), response.Content[1].ImageContent.Data)
+	assert.Equal(t, "image/png", response.Content[2].ImageContent.MimeType)
+
+	entries := session.snapshot()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "model <- glm(am ~ wt + hp, family = binomial(), data = regions)", entries[0].Code)
+}
+
+// TestFitModelValidation tests the validation of the model arguments
+func TestFitModelValidation(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+
+	tests := []struct {
+		name     string
+		args     FitModelArgs
+		errorMsg string
+	}{
+		{"No data", FitModelArgs{Formula: "y ~ x"}, "either dataset or data is required"},
+		{"Unknown dataset", FitModelArgs{Dataset: "missing", Formula: "y ~ x"}, "dataset not found: missing"},
+		{"No formula", FitModelArgs{Dataset: "regions"}, "formula is required"},
+		{"No tilde", FitModelArgs{Dataset: "regions", Formula: "y + x"}, "a formula needs a ~"},
+		{"Code in formula", FitModelArgs{Dataset: "regions", Formula: "y ~ system(\"ls\")"}, "function not allowed in expression: system"},
+		{"Assignment in formula", FitModelArgs{Dataset: "regions", Formula: "y ~ (x <- 1)"}, "<- is not allowed"},
+		{"Bad method", FitModelArgs{Dataset: "regions", Formula: "y ~ x", Method: "rpart"}, "method must be lm, glm, loess or gam"},
+		{"Bad family", FitModelArgs{Dataset: "regions", Formula: "y ~ x", Method: "glm", Family: "tweedie"}, "family must be gaussian"},
+		{"Bad link", FitModelArgs{Dataset: "regions", Formula: "y ~ x", Method: "glm", Link: "exp"}, "link must be identity"},
+		{"Family with lm", FitModelArgs{Dataset: "regions", Formula: "y ~ x", Family: "poisson"}, "family and link can only be used with glm and gam models"},
+		{"Bad span", FitModelArgs{Dataset: "regions", Formula: "y ~ x", Method: "loess", Span: -1}, "span must be greater than 0 and at most 5"},
+		{"Span with lm", FitModelArgs{Dataset: "regions", Formula: "y ~ x", Span: 0.5}, "span can only be used with loess models"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := FitModel(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+
+	for _, formula := range []string{"y ~ .", "log(y) ~ . - id", "y ~ s(x, k = 5) + te(u, v) + factor(g)", "cbind(hits, misses) ~ (.)^2"} {
+		assert.NoError(t, validateRExpression(formulaDotPattern.ReplaceAllString(formula, "${1}dot${2}"), nil, formulaFunctions), formula)
+	}
+}
@@ -0,0 +1,248 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// NetworkNode represents a node of the graph passed to analyze_network
+type NetworkNode struct {
+	ID    string `json:"id" jsonschema:"required,description=Unique node identifier"`
+	Label string `json:"label,omitempty" jsonschema:"description=Label drawn on the plot (defaults to the id)"`
+}
+
+// NetworkEdge represents an edge of the graph passed to analyze_network
+type NetworkEdge struct {
+	From   string  `json:"from" jsonschema:"required,description=Source node id"`
+	To     string  `json:"to" jsonschema:"required,description=Target node id"`
+	Weight float64 `json:"weight,omitempty" jsonschema:"description=Optional positive edge weight"`
+}
+
+// NetworkAnalysisArgs represents the arguments for analyzing a network
+type NetworkAnalysisArgs struct {
+	Nodes      []NetworkNode `json:"nodes" jsonschema:"description=Nodes of the graph; inferred from the edges if omitted"`
+	Edges      []NetworkEdge `json:"edges" jsonschema:"required,description=Edges of the graph"`
+	Directed   bool          `json:"directed" jsonschema:"description=Whether the graph is directed"`
+	Community  string        `json:"community" jsonschema:"description=Community detection algorithm (louvain, walktrap, fast_greedy, label_prop, infomap)"`
+	Layout     string        `json:"layout" jsonschema:"description=igraph layout (nicely, fr, kk, circle, tree, grid, star, random)"`
+	VertexSize float64       `json:"vertex_size" jsonschema:"description=Vertex size on the plot; scaled by degree if omitted"`
+	OutputType string        `json:"output_type" jsonschema:"description=Output format of the plot (png, svg)"`
+	Width      int           `json:"width" jsonschema:"description=Width of the output image in pixels"`
+	Height     int           `json:"height" jsonschema:"description=Height of the output image in pixels"`
+	Resolution int           `json:"resolution" jsonschema:"description=Resolution of the output image in dpi"`
+
+	BundleOption
+}
+
+// communityAlgorithms maps the supported community detection algorithms to
+// igraph functions. Algorithms that only work on undirected graphs are
+// applied to the collapsed undirected graph.
+var communityAlgorithms = map[string]struct {
+	Func       string
+	Undirected bool
+}{
+	"louvain":     {"igraph::cluster_louvain", true},
+	"walktrap":    {"igraph::cluster_walktrap", false},
+	"fast_greedy": {"igraph::cluster_fast_greedy", true},
+	"label_prop":  {"igraph::cluster_label_prop", false},
+	"infomap":     {"igraph::cluster_infomap", false},
+}
+
+const (
+	maxNetworkNodes = 5000
+	maxNetworkEdges = 50000
+)
+
+// AnalyzeNetwork builds an igraph object from the given nodes and edges and
+// returns centrality, component and community metrics along with a plot
+func AnalyzeNetwork(args NetworkAnalysisArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if err := validateNetwork(args.Nodes, args.Edges); err != nil {
+		return nil, err
+	}
+
+	community := args.Community
+	if community == "" {
+		community = "louvain"
+	}
+	algorithm, ok := communityAlgorithms[community]
+	if !ok {
+		return nil, fmt.Errorf("unsupported community algorithm: %s", community)
+	}
+
+	layout := args.Layout
+	if layout == "" {
+		layout = "nicely"
+	}
+	layoutFunc, ok := igraphLayouts[layout]
+	if !ok {
+		return nil, fmt.Errorf("unsupported layout: %s", layout)
+	}
+
+	outputType := args.OutputType
+	if outputType == "" {
+		outputType = "png"
+	} else if outputType != "png" && outputType != "svg" {
+		return nil, fmt.Errorf("output_type must be png or svg")
+	}
+
+	if args.VertexSize < 0 {
+		return nil, fmt.Errorf("vertex_size must be positive")
+	}
+
+	width, height, resolution, err := validateImageSize(args.Width, args.Height, args.Resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newRJob("network-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	// Write the graph for R to read
+	graphData, err := json.Marshal(map[string]interface{}{
+		"nodes": args.Nodes,
+		"edges": args.Edges,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode graph: %w", err)
+	}
+	graphPath, err := job.WriteFile("graph.json", graphData)
+	if err != nil {
+		return nil, err
+	}
+
+	plotName := "network." + outputType
+	communityGraph := "g"
+	if algorithm.Undirected && args.Directed {
+		communityGraph = `igraph::as.undirected(g, mode = "collapse", edge.attr.comb = list(weight = "sum", "ignore"))`
+	}
+
+	// Generate the R script content
+	scriptContent := fmt.Sprintf(`
+library(igraph)
+
+# Set output parameters
+width <- %d
+height <- %d
+dpi <- %d
+output_file <- %s
+plot_file <- %s
+vertex_size <- %g
+
+# Build the graph
+graph <- jsonlite::read_json(%s, simplifyVector = TRUE)
+edges <- as.data.frame(graph$edges)
+nodes <- if (length(graph$nodes) > 0) as.data.frame(graph$nodes) else NULL
+g <- graph_from_data_frame(edges, directed = %s, vertices = nodes)
+
+# Compute metrics
+comps <- components(g)
+comm <- %s(%s)
+membership <- as.integer(membership(comm))
+node_metrics <- data.frame(
+  id = V(g)$name,
+  degree = as.integer(degree(g)),
+  betweenness = as.numeric(betweenness(g, normalized = TRUE)),
+  closeness = as.numeric(suppressWarnings(closeness(g, normalized = TRUE))),
+  component = as.integer(comps$membership),
+  community = membership
+)
+result <- list(
+  summary = list(
+    nodes = vcount(g),
+    edges = ecount(g),
+    directed = is_directed(g),
+    density = edge_density(g),
+    components = comps$no,
+    component_sizes = as.integer(comps$csize),
+    community_algorithm = %s,
+    communities = length(unique(membership)),
+    modularity = modularity(g, membership)
+  ),
+  nodes = node_metrics
+)
+jsonlite::write_json(result, output_file, auto_unbox = TRUE, digits = NA, na = "null", pretty = TRUE)
+
+# Draw the network coloured by community
+labels <- if (!is.null(V(g)$label)) ifelse(is.na(V(g)$label), V(g)$name, V(g)$label) else V(g)$name
+sizes <- if (vertex_size > 0) vertex_size else 5 + 10 * sqrt(node_metrics$degree / max(1, max(node_metrics$degree)))
+palette <- grDevices::hcl.colors(max(membership), "Set 2")
+if (grepl("\\.svg$", plot_file)) {
+  svg(plot_file, width = width / dpi, height = height / dpi)
+} else {
+  png(plot_file, width = width, height = height, res = dpi)
+}
+plot(g, layout = %s(g), vertex.label = labels, vertex.size = sizes,
+     vertex.color = palette[membership], edge.arrow.size = 0.4)
+invisible(dev.off())
+`, width, height, resolution, rQuote(job.Path("output.json")), rQuote(job.Path(plotName)),
+		args.VertexSize, rQuote(graphPath), rBool(args.Directed),
+		algorithm.Func, communityGraph, rQuote(community), layoutFunc)
+
+	metrics, err := job.Run(scriptContent, "output.json", RExecutionConfig{
+		OutputFormat: outputType,
+		Width:        width,
+		Height:       height,
+		Resolution:   resolution,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plotData, err := job.ReadFile(plotName)
+	if err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResponse(
+		mcp.NewTextContent(string(metrics)),
+		mcp.NewImageContent(EncodeImageToBase64(plotData), GetMimeType(outputType)),
+	), nil
+}
+
+// validateNetwork checks that node ids are unique, that every edge refers to a
+// declared node and that weights are given for all edges or none
+func validateNetwork(nodes []NetworkNode, edges []NetworkEdge) error {
+	if len(edges) == 0 {
+		return fmt.Errorf("edges are required")
+	}
+	if len(nodes) > maxNetworkNodes {
+		return fmt.Errorf("too many nodes: %d (maximum %d)", len(nodes), maxNetworkNodes)
+	}
+	if len(edges) > maxNetworkEdges {
+		return fmt.Errorf("too many edges: %d (maximum %d)", len(edges), maxNetworkEdges)
+	}
+
+	ids := make(map[string]bool, len(nodes))
+	for i, node := range nodes {
+		if node.ID == "" {
+			return fmt.Errorf("node %d has no id", i)
+		}
+		if ids[node.ID] {
+			return fmt.Errorf("duplicate node id: %s", node.ID)
+		}
+		ids[node.ID] = true
+	}
+
+	weighted := edges[0].Weight > 0
+	for i, edge := range edges {
+		if edge.From == "" || edge.To == "" {
+			return fmt.Errorf("edge %d must have from and to", i)
+		}
+		if edge.Weight < 0 {
+			return fmt.Errorf("edge %d has a negative weight", i)
+		}
+		if (edge.Weight > 0) != weighted {
+			return fmt.Errorf("either all edges or none must have a weight")
+		}
+		if len(nodes) > 0 && (!ids[edge.From] || !ids[edge.To]) {
+			return fmt.Errorf("edge %d refers to an unknown node", i)
+		}
+	}
+	return nil
+}
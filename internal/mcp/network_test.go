@@ -0,0 +1,67 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAnalyzeNetworkExecution tests that metrics and the plot are returned together
+func TestAnalyzeNetworkExecution(t *testing.T) {
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "igraph::cluster_louvain(igraph::as.undirected(g")
+			assert.Contains(t, string(script), "igraph::layout_with_kk(g)")
+
+			// Write the plot next to the metrics
+			plotPath := filepath.Join(filepath.Dir(config.OutputPath), "network.png")
+			require.NoError(t, os.WriteFile(plotPath, []byte("mock-plot"), 0644))
+			return []byte(`{"summary":{"nodes":3}}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := AnalyzeNetwork(NetworkAnalysisArgs{
+		Edges:    []NetworkEdge{{From: "a", To: "b"}, {From: "b", To: "c"}},
+		Directed: true,
+		Layout:   "kk",
+	})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 2)
+	assert.Equal(t, `{"summary":{"nodes":3}}`, response.Content[0].TextContent.Text)
+	assert.Equal(t, "image/png", response.Content[1].ImageContent.MimeType)
+	assert.Equal(t, "bW9jay1wbG90", response.Content[1].ImageContent.Data)
+}
+
+// TestAnalyzeNetworkValidation tests the validation of nodes, edges and options
+func TestAnalyzeNetworkValidation(t *testing.T) {
+	edges := []NetworkEdge{{From: "a", To: "b"}}
+	tests := []struct {
+		name     string
+		args     NetworkAnalysisArgs
+		errorMsg string
+	}{
+		{"No edges", NetworkAnalysisArgs{}, "edges are required"},
+		{"Duplicate node", NetworkAnalysisArgs{Nodes: []NetworkNode{{ID: "a"}, {ID: "a"}}, Edges: edges}, "duplicate node id: a"},
+		{"Unknown node", NetworkAnalysisArgs{Nodes: []NetworkNode{{ID: "a"}}, Edges: edges}, "edge 0 refers to an unknown node"},
+		{"Partial weights", NetworkAnalysisArgs{Edges: []NetworkEdge{{From: "a", To: "b", Weight: 2}, {From: "b", To: "c"}}}, "either all edges or none"},
+		{"Bad community", NetworkAnalysisArgs{Edges: edges, Community: "spectral"}, "unsupported community algorithm"},
+		{"Bad layout", NetworkAnalysisArgs{Edges: edges, Layout: "spiral"}, "unsupported layout"},
+		{"Bad size", NetworkAnalysisArgs{Edges: edges, Width: 10}, "width must be between 100 and 5000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := AnalyzeNetwork(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// RNotebookArgs represents the arguments for executing R code as a notebook
+type RNotebookArgs struct {
+	Code       string   `json:"code" jsonschema:"description=R code to execute; either code or chunks is required"`
+	Chunks     []string `json:"chunks" jsonschema:"description=R code chunks executed in order in a shared environment"`
+	Width      int      `json:"width" jsonschema:"description=Width of the figures in pixels"`
+	Height     int      `json:"height" jsonschema:"description=Height of the figures in pixels"`
+	Resolution int      `json:"resolution" jsonschema:"description=Resolution of the figures in dpi"`
+
+	BundleOption
+}
+
+// notebookItem is a single source, output, condition or figure recorded by
+// evaluate::evaluate
+type notebookItem struct {
+	Type  string `json:"type"`
+	Chunk int    `json:"chunk"`
+	Text  string `json:"text"`
+	File  string `json:"file"`
+}
+
+// notebookScript evaluates the chunks one after another with evaluate, which
+// splits them into top-level expressions and records what each one prints,
+// signals and draws. Figures are replayed into PNG files and everything is
+// written to output_file in the order it happened. Evaluation stops at the
+// first error, as a notebook run would. The driver runs in a local
+// environment, so the chunks cannot see or overwrite its state.
+const notebookScript = `
+chunks <- jsonlite::read_json(chunks_file, simplifyVector = TRUE)
+env <- new.env(parent = globalenv())
+items <- list()
+figures <- 0
+add_item <- function(type, text = "", file = "") {
+  items[[length(items) + 1]] <<- list(type = type, chunk = i, text = text, file = file)
+}
+
+failed <- FALSE
+for (i in seq_along(chunks)) {
+  results <- evaluate::evaluate(chunks[[i]], envir = env, stop_on_error = 1L, new_device = TRUE)
+  for (r in results) {
+    if (inherits(r, "source")) {
+      add_item("source", sub("\n$", "", r$src))
+    } else if (is.character(r)) {
+      add_item("output", r)
+    } else if (inherits(r, "error")) {
+      add_item("error", conditionMessage(r))
+      failed <- TRUE
+    } else if (inherits(r, "warning")) {
+      add_item("warning", conditionMessage(r))
+    } else if (inherits(r, "message")) {
+      add_item("message", conditionMessage(r))
+    } else if (inherits(r, "recordedplot")) {
+      figures <- figures + 1
+      file <- sprintf("figure-%d.png", figures)
+      png(file.path(figure_dir, file), width = width, height = height, res = dpi)
+      replayPlot(r)
+      dev.off()
+      add_item("figure", file = file)
+    }
+  }
+  if (failed) break
+}
+
+jsonlite::write_json(items, output_file, auto_unbox = TRUE)
+`
+
+// ExecuteRNotebook evaluates R code chunk by chunk and returns the echoed
+// source, printed output, conditions and figures in the order they happened
+func ExecuteRNotebook(args RNotebookArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	chunks := args.Chunks
+	if args.Code != "" {
+		if len(chunks) > 0 {
+			return nil, fmt.Errorf("either code or chunks is required, not both")
+		}
+		chunks = []string{args.Code}
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("either code or chunks is required")
+	}
+
+	width, height, resolution, err := validateImageSize(args.Width, args.Height, args.Resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newRJob("r-notebook-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	chunkData, err := json.Marshal(chunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chunks: %w", err)
+	}
+	chunksPath, err := job.WriteFile("chunks.json", chunkData)
+	if err != nil {
+		return nil, err
+	}
+
+	scriptContent := fmt.Sprintf(`
+local({
+# Set output parameters
+width <- %d
+height <- %d
+dpi <- %d
+chunks_file <- %s
+figure_dir <- %s
+output_file <- %s
+%s})
+`, width, height, resolution, rQuote(chunksPath), rQuote(job.Dir), rQuote(job.Path("output.json")), notebookScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{
+		OutputFormat: "png",
+		Width:        width,
+		Height:       height,
+		Resolution:   resolution,
+	})
+	if err != nil {
+		session.record("execute_r_notebook", strings.Join(chunks, "\n\n"), errorOutputs(err))
+		return nil, err
+	}
+
+	var items []notebookItem
+	if err := json.Unmarshal(outputData, &items); err != nil {
+		return nil, fmt.Errorf("failed to parse notebook output: %w", err)
+	}
+
+	// Record each evaluated chunk with its outputs in the session history
+	content := []*mcp.Content{}
+	outputs := make([][]sessionOutput, len(chunks))
+	evaluated := 0
+	for _, item := range items {
+		var output *sessionOutput
+		switch item.Type {
+		case "figure":
+			figure, err := job.ReadFile(item.File)
+			if err != nil {
+				return nil, err
+			}
+			data := EncodeImageToBase64(figure)
+			content = append(content, mcp.NewImageContent(data, GetMimeType("png")))
+			output = &sessionOutput{Type: "image", Data: data, MimeType: GetMimeType("png")}
+		case "source":
+			content = append(content, mcp.NewTextContent("```r\n"+item.Text+"\n```"))
+		case "output":
+			content = append(content, mcp.NewTextContent(strings.TrimSuffix(item.Text, "\n")))
+			output = &sessionOutput{Type: "stdout", Text: item.Text}
+		case "message":
+			content = append(content, mcp.NewTextContent(strings.TrimSuffix(item.Text, "\n")))
+			output = &sessionOutput{Type: "stderr", Text: item.Text}
+		case "warning":
+			content = append(content, mcp.NewTextContent("Warning: "+item.Text))
+			output = &sessionOutput{Type: "stderr", Text: "Warning: " + item.Text + "\n"}
+		case "error":
+			content = append(content, mcp.NewTextContent("Error: "+item.Text))
+			output = &sessionOutput{Type: "error", Text: item.Text}
+		}
+
+		if item.Chunk >= 1 && item.Chunk <= len(chunks) {
+			evaluated = max(evaluated, item.Chunk)
+			if output != nil {
+				outputs[item.Chunk-1] = append(outputs[item.Chunk-1], *output)
+			}
+		}
+	}
+	for i := 0; i < evaluated; i++ {
+		session.record("execute_r_notebook", chunks[i], outputs[i])
+	}
+	if len(content) == 0 {
+		content = append(content, mcp.NewTextContent("R notebook execution completed without output"))
+	}
+
+	return mcp.NewToolResponse(content...), nil
+}
@@ -0,0 +1,75 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExecuteRNotebook tests that the recorded items are returned in order
+func TestExecuteRNotebook(t *testing.T) {
+	setupSession(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			jobDir := filepath.Dir(config.OutputPath)
+			chunks, err := os.ReadFile(filepath.Join(jobDir, "chunks.json"))
+			require.NoError(t, err)
+			assert.JSONEq(t, `["x <- c(1, NA)", "mean(x)\nplot(x)"]`, string(chunks))
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(strings.TrimSpace(string(script)), "local({"), "the driver state is kept out of the global environment")
+
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "figure-1.png"), []byte("mock-figure"), 0644))
+			return []byte(`[
+				{"type": "source", "chunk": 1, "text": "x <- c(1, NA)", "file": ""},
+				{"type": "source", "chunk": 2, "text": "mean(x)", "file": ""},
+				{"type": "output", "chunk": 2, "text": "[1] NA\n", "file": ""},
+				{"type": "warning", "chunk": 2, "text": "NAs ignored", "file": ""},
+				{"type": "source", "chunk": 2, "text": "plot(x)", "file": ""},
+				{"type": "figure", "chunk": 2, "text": "", "file": "figure-1.png"},
+				{"type": "error", "chunk": 2, "text": "object 'y' not found", "file": ""}
+			]`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := ExecuteRNotebook(RNotebookArgs{Chunks: []string{"x <- c(1, NA)", "mean(x)\nplot(x)"}})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 7)
+	assert.Equal(t, "```r\nx <- c(1, NA)\n```", response.Content[0].TextContent.Text)
+	assert.Equal(t, "```r\nmean(x)\n```", response.Content[1].TextContent.Text)
+	assert.Equal(t, "[1] NA", response.Content[2].TextContent.Text)
+	assert.Equal(t, "Warning: NAs ignored", response.Content[3].TextContent.Text)
+	assert.Equal(t, "```r\nplot(x)\n```", response.Content[4].TextContent.Text)
+	assert.Equal(t, "image/png", response.Content[5].ImageContent.MimeType)
+	assert.Equal(t, "bW9jay1maWd1cmU=", response.Content[5].ImageContent.Data)
+	assert.Equal(t, "Error: object 'y' not found", response.Content[6].TextContent.Text)
+}
+
+// TestExecuteRNotebookValidation tests the validation of the notebook arguments
+func TestExecuteRNotebookValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     RNotebookArgs
+		errorMsg string
+	}{
+		{"No code", RNotebookArgs{}, "either code or chunks is required"},
+		{"Code and chunks", RNotebookArgs{Code: "1", Chunks: []string{"2"}}, "not both"},
+		{"Bad size", RNotebookArgs{Code: "1", Width: 10}, "width must be between 100 and 5000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := ExecuteRNotebook(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
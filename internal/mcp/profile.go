@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// ProfileDataArgs represents the arguments for profiling a dataset
+type ProfileDataArgs struct {
+	Dataset   string `json:"dataset,omitempty" jsonschema:"description=Name of a catalog or uploaded dataset; either dataset or data is required"`
+	Data      string `json:"data,omitempty" jsonschema:"description=R code evaluating to a data frame; datasets can be used by name"`
+	MaxLevels int    `json:"max_levels,omitempty" jsonschema:"description=Number of most frequent values listed for categorical and logical columns (default 5; maximum 50)"`
+	Bins      int    `json:"bins,omitempty" jsonschema:"description=Number of histogram bins of numeric and date columns (default 10; between 2 and 40)"`
+
+	BundleOption
+}
+
+// dataProfile is the profile of a data frame
+type dataProfile struct {
+	Rows    int             `json:"rows"`
+	Columns []columnProfile `json:"columns"`
+}
+
+// columnProfile holds the statistics of a column. Kind is numeric, date,
+// datetime, logical, categorical or other; min, max and the quantiles are
+// numbers for numeric columns and ISO 8601 strings for dates and datetimes.
+type columnProfile struct {
+	Name      string                     `json:"name"`
+	Type      string                     `json:"type"`
+	Kind      string                     `json:"kind"`
+	N         int                        `json:"n"`
+	Missing   int                        `json:"missing"`
+	Unique    int                        `json:"unique"`
+	Min       json.RawMessage            `json:"min,omitempty"`
+	Max       json.RawMessage            `json:"max,omitempty"`
+	Mean      *float64                   `json:"mean,omitempty"`
+	SD        *float64                   `json:"sd,omitempty"`
+	Quantiles map[string]json.RawMessage `json:"quantiles,omitempty"`
+	TopLevels []struct {
+		Value string `json:"value"`
+		Count int    `json:"count"`
+	} `json:"top_levels,omitempty"`
+	Histogram []int  `json:"histogram,omitempty"`
+	Sparkline string `json:"sparkline,omitempty"`
+}
+
+// profileDataScript computes the column statistics of df. The histogram of a
+// numeric or date column counts its values in equal width bins; categorical
+// and logical columns use the counts of their most frequent values instead.
+const profileDataScript = `
+profile_column <- function(name, x) {
+  if (inherits(x, "POSIXlt")) x <- as.POSIXct(x)
+  kind <- if (is.logical(x)) "logical" else if (inherits(x, "Date")) "date" else
+    if (inherits(x, "POSIXct")) "datetime" else if (is.numeric(x)) "numeric" else
+    if (is.factor(x) || is.character(x)) "categorical" else "other"
+  present <- x[!is.na(x)]
+  out <- list(name = name, type = class(x)[1], kind = kind, n = length(present),
+    missing = sum(is.na(x)), unique = length(unique(present)))
+
+  values <- as.numeric(present)
+  values <- values[is.finite(values)]
+  if (kind %in% c("numeric", "date", "datetime") && length(values) > 0) {
+    as_value <- switch(kind,
+      numeric = function(v) v,
+      date = function(v) format(as.Date(v, origin = "1970-01-01")),
+      datetime = function(v) format(as.POSIXct(v, origin = "1970-01-01", tz = "UTC"), "%Y-%m-%dT%H:%M:%SZ", tz = "UTC")
+    )
+    out$min <- as_value(min(values))
+    out$max <- as_value(max(values))
+    if (kind == "numeric") {
+      out$mean <- mean(values)
+      if (length(values) > 1) out$sd <- stats::sd(values)
+    }
+    q <- stats::quantile(values, c(0.05, 0.25, 0.5, 0.75, 0.95), names = FALSE)
+    out$quantiles <- stats::setNames(lapply(q, as_value), c("p05", "p25", "p50", "p75", "p95"))
+    out$histogram <- if (max(values) > min(values)) {
+      I(tabulate(cut(values, breaks = bins, labels = FALSE), bins))
+    } else {
+      I(length(values))
+    }
+  }
+  if (kind %in% c("categorical", "logical") && length(present) > 0) {
+    counts <- utils::head(sort(table(as.character(present)), decreasing = TRUE), max_levels)
+    out$top_levels <- lapply(seq_along(counts), function(i) list(value = names(counts)[i], count = as.integer(counts[[i]])))
+    out$histogram <- I(as.integer(counts))
+  }
+  out
+}
+
+df <- tryCatch(load_data(), error = function(e) {
+  message("Error: ", conditionMessage(e))
+  quit(save = "no", status = 1)
+})
+if (is.matrix(df)) df <- as.data.frame(df, stringsAsFactors = FALSE)
+if (!is.data.frame(df)) {
+  message("Error: data must evaluate to a data frame, not ", class(df)[1])
+  quit(save = "no", status = 1)
+}
+
+jsonlite::write_json(list(
+  rows = nrow(df),
+  columns = lapply(names(df), function(n) profile_column(n, df[[n]]))
+), output_file, auto_unbox = TRUE, digits = NA)
+`
+
+// ProfileData computes per column statistics of a dataset or data frame
+// expression, with a sparkline of each distribution, and returns them as JSON
+func ProfileData(args ProfileDataArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	loadData, inputs, err := dataLoadCode(args.Dataset, args.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	maxLevels := args.MaxLevels
+	if maxLevels == 0 {
+		maxLevels = 5
+	} else if maxLevels < 1 || maxLevels > 50 {
+		return nil, fmt.Errorf("max_levels must be between 1 and 50")
+	}
+
+	bins := args.Bins
+	if bins == 0 {
+		bins = 10
+	} else if bins < 2 || bins > 40 {
+		return nil, fmt.Errorf("bins must be between 2 and 40")
+	}
+
+	job, err := newRJob("profile-data-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	scriptContent := fmt.Sprintf(`
+load_data <- function() %s
+max_levels <- %d
+bins <- %d
+output_file <- %s
+%s`, loadData, maxLevels, bins, rQuote(job.Path("output.json")), profileDataScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{Inputs: inputs})
+	if err != nil {
+		return nil, err
+	}
+
+	var profile dataProfile
+	if err := json.Unmarshal(outputData, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse profile: %w", err)
+	}
+	if profile.Columns == nil {
+		profile.Columns = []columnProfile{}
+	}
+	for i := range profile.Columns {
+		profile.Columns[i].Sparkline = sparkline(profile.Columns[i].Histogram)
+	}
+
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profile: %w", err)
+	}
+	return mcp.NewToolResponse(mcp.NewTextContent(string(data))), nil
+}
+
+// sparkline draws counts as a line of block characters scaled to the largest
+// count. Empty bins get the lowest block and any other count at least the
+// second lowest, so gaps remain visible.
+func sparkline(counts []int) string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	highest := 0
+	for _, c := range counts {
+		highest = max(highest, c)
+	}
+	if highest == 0 {
+		return strings.Repeat(string(blocks[0]), len(counts))
+	}
+
+	var b strings.Builder
+	for _, c := range counts {
+		level := 0
+		if c > 0 {
+			level = max((c*(len(blocks)-1)+highest-1)/highest, 1)
+		}
+		b.WriteRune(blocks[level])
+	}
+	return b.String()
+}
@@ -0,0 +1,124 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleProfile = `{
+	"rows": 32,
+	"columns": [
+		{
+			"name": "mpg", "type": "numeric", "kind": "numeric", "n": 32, "missing": 0, "unique": 25,
+			"min": 10.4, "max": 33.9, "mean": 20.09, "sd": 6.03,
+			"quantiles": {"p05": 11.995, "p25": 15.425, "p50": 19.2, "p75": 22.8, "p95": 31.3},
+			"histogram": [2, 4, 6, 8, 5, 3, 0, 2, 1, 1]
+		},
+		{
+			"name": "day", "type": "Date", "kind": "date", "n": 30, "missing": 2, "unique": 30,
+			"min": "2024-01-01", "max": "2024-01-30", "quantiles": {"p50": "2024-01-15"},
+			"histogram": [30]
+		},
+		{
+			"name": "gear", "type": "factor", "kind": "categorical", "n": 32, "missing": 0, "unique": 3,
+			"top_levels": [{"value": "3", "count": 15}, {"value": "4", "count": 12}, {"value": "5", "count": 5}],
+			"histogram": [15, 12, 5]
+		},
+		{"name": "model", "type": "lm", "kind": "other", "n": 0, "missing": 0, "unique": 0}
+	]
+}`
+
+// TestProfileData tests that the options reach the script and sparklines are
+// added to the profile
+func TestProfileData(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "load_data <- function() utils::read.csv(")
+			assert.Contains(t, string(script), "max_levels <- 3\nbins <- 10\n")
+			return []byte(sampleProfile), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := ProfileData(ProfileDataArgs{Dataset: "regions", MaxLevels: 3})
+	require.NoError(t, err)
+
+	var profile dataProfile
+	require.NoError(t, json.Unmarshal([]byte(response.Content[0].TextContent.Text), &profile))
+	assert.Equal(t, 32, profile.Rows)
+	require.Len(t, profile.Columns, 4)
+	assert.Equal(t, "▃▅▇█▆▄▁▃▂▂", profile.Columns[0].Sparkline)
+	assert.Equal(t, 6.03, *profile.Columns[0].SD)
+	assert.JSONEq(t, `"2024-01-01"`, string(profile.Columns[1].Min))
+	assert.Equal(t, "█", profile.Columns[1].Sparkline)
+	assert.Equal(t, "█▇▄", profile.Columns[2].Sparkline)
+	assert.Equal(t, 15, profile.Columns[2].TopLevels[0].Count)
+	assert.Empty(t, profile.Columns[3].Sparkline)
+	assert.NotContains(t, response.Content[0].TextContent.Text, `"min": null`)
+}
+
+// TestProfileDataExpression tests that expressions can use the datasets
+func TestProfileDataExpression(t *testing.T) {
+	dir := setupDataDir(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sales.rds"), []byte("mock-rds"), 0644))
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "load_data <- function() {\n# Bind the datasets\ndelayedAssign(\"sales\"")
+			assert.Contains(t, string(script), `eval(parse(text = "subset(sales, revenue > 0)"), envir = globalenv())`)
+			return []byte(`{"rows": 0, "columns": []}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := ProfileData(ProfileDataArgs{Data: "subset(sales, revenue > 0)", Bins: 20})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"rows": 0, "columns": []}`, response.Content[0].TextContent.Text)
+}
+
+// TestProfileDataValidation tests the validation of the profile arguments
+func TestProfileDataValidation(t *testing.T) {
+	setupDataDir(t)
+
+	tests := []struct {
+		name     string
+		args     ProfileDataArgs
+		errorMsg string
+	}{
+		{"No data", ProfileDataArgs{}, "either dataset or data is required"},
+		{"Dataset and data", ProfileDataArgs{Dataset: "sales", Data: "mtcars"}, "cannot be used together"},
+		{"Unknown dataset", ProfileDataArgs{Dataset: "sales"}, "dataset not found: sales"},
+		{"Too many levels", ProfileDataArgs{Data: "mtcars", MaxLevels: 100}, "max_levels must be between 1 and 50"},
+		{"Too few bins", ProfileDataArgs{Data: "mtcars", Bins: 1}, "bins must be between 2 and 40"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := ProfileData(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
+
+// TestSparkline tests the scaling of the sparkline blocks
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, "", sparkline(nil))
+	assert.Equal(t, "▁▁", sparkline([]int{0, 0}))
+	assert.Equal(t, "▁▂▅█", sparkline([]int{0, 1, 50, 100}))
+}
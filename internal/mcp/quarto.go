@@ -0,0 +1,155 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// quartoFormats maps the render_quarto formats to the extension of the
+// rendered file
+var quartoFormats = map[string]string{
+	"html":     "html",
+	"pdf":      "pdf",
+	"docx":     "docx",
+	"revealjs": "html",
+}
+
+// QuartoRenderArgs represents the arguments for rendering a Quarto document
+type QuartoRenderArgs struct {
+	Content  string         `json:"content" jsonschema:"description=Quarto (.qmd) document to render; either content or filename is required"`
+	Filename string         `json:"filename" jsonschema:"description=Name of a .qmd file in the rmd directory to render, or the name of the output when content is given"`
+	Params   map[string]any `json:"params,omitempty" jsonschema:"description=Values for the parameters declared in the document"`
+	Format   string         `json:"format" jsonschema:"description=Output format (html, pdf, docx, revealjs)"`
+
+	BundleOption
+}
+
+// RenderQuarto renders a Quarto document with the quarto command line tool,
+// saves the result to the output directory and returns it as an embedded
+// resource together with the render log
+func RenderQuarto(args QuartoRenderArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	format := args.Format
+	if format == "" {
+		format = "html"
+	}
+	extension, ok := quartoFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("format must be html, pdf, docx or revealjs")
+	}
+
+	name := "document"
+	if args.Filename != "" {
+		var err error
+		if name, err = sanitizeWorkspaceFilename(args.Filename, ".qmd"); err != nil {
+			return nil, err
+		}
+	}
+
+	source := []byte(args.Content)
+	if args.Content == "" {
+		if args.Filename == "" {
+			return nil, fmt.Errorf("either content or filename is required")
+		}
+		var err error
+		if source, err = os.ReadFile(filepath.Join(RmdDir, name+".qmd")); err != nil {
+			return nil, fmt.Errorf("Quarto document not found: %s.qmd", name)
+		}
+	}
+
+	return renderQuartoSource(source, name+".qmd", name, format, extension, args.Params)
+}
+
+// renderQuartoSource renders a Quarto document with the given params, saves
+// the result as outputName in the output directory and returns it as an
+// embedded resource together with the render log. sourceName is the name of
+// the source reported to the client.
+func renderQuartoSource(source []byte, sourceName, outputName, format, extension string, params map[string]any) (*mcp.ToolResponse, error) {
+	job, err := newRJob("quarto-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	// Render a copy in the job directory so the files quarto creates along
+	// the way are cleaned up
+	documentPath, err := job.WriteFile("document.qmd", source)
+	if err != nil {
+		return nil, err
+	}
+
+	renderedName := "output." + extension
+	renderArgs := []string{"render", "document.qmd", "--to", format, "--output", renderedName}
+	if extension == "html" {
+		// Inline the supporting files so the HTML works on its own
+		renderArgs = append(renderArgs, "-M", "embed-resources:true")
+	}
+	if len(params) > 0 {
+		// JSON is valid YAML, so the parameters can be passed as they are
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode params: %w", err)
+		}
+		if _, err := job.WriteFile("params.yml", data); err != nil {
+			return nil, err
+		}
+		renderArgs = append(renderArgs, "--execute-params", "params.yml")
+	}
+
+	quoted := make([]string, len(renderArgs))
+	for i, arg := range renderArgs {
+		quoted[i] = rQuote(arg)
+	}
+
+	scriptContent := fmt.Sprintf(`
+log_file <- %s
+document <- %s
+quarto_bin <- quarto::quarto_path()
+if (is.null(quarto_bin) || !nzchar(quarto_bin)) {
+  stop("the quarto command line tool is not installed", call. = FALSE)
+}
+
+# Render the document next to its source, keeping everything quarto prints
+# as the log
+old_wd <- setwd(dirname(document))
+log <- suppressWarnings(system2(quarto_bin, shQuote(c(%s)), stdout = TRUE, stderr = TRUE))
+setwd(old_wd)
+writeLines(log, log_file)
+status <- attr(log, "status")
+if (!is.null(status) && status != 0) {
+  stop(paste(c(sprintf("quarto render failed with status %%d", status), log), collapse = "\n"), call. = FALSE)
+}
+`, rQuote(job.Path("render.log")), rQuote(documentPath), strings.Join(quoted, ", "))
+
+	outputData, err := job.Run(scriptContent, renderedName, RExecutionConfig{
+		OutputFormat: extension,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	renderLog, err := job.ReadFile("render.log")
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the rendered document next to the other outputs
+	outputFile := outputName + "." + extension
+	if err := saveRenderedOutput(outputFile, outputData); err != nil {
+		return nil, err
+	}
+
+	content := []*mcp.Content{
+		mcp.NewTextContent(fmt.Sprintf("Successfully rendered %s to %s", sourceName, outputFile)),
+		documentResourceContent("rmd-output:///"+outputFile, outputData, extension),
+	}
+	if log := strings.TrimSpace(string(renderLog)); log != "" {
+		content = append(content, mcp.NewTextContent("Render log:\n"+log))
+	}
+	return mcp.NewToolResponse(content...), nil
+}
@@ -0,0 +1,111 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderQuartoContent tests rendering inline content with parameters
+func TestRenderQuartoContent(t *testing.T) {
+	dir := setupRmdDir(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), `"--to", "revealjs", "--output", "output.html", "-M", "embed-resources:true", "--execute-params", "params.yml"`)
+
+			jobDir := filepath.Dir(config.OutputPath)
+			assert.Contains(t, string(script), "document <- "+rQuote(filepath.Join(jobDir, "document.qmd"))+"\n")
+			assert.Contains(t, string(script), "old_wd <- setwd(dirname(document))\n")
+			source, err := os.ReadFile(filepath.Join(jobDir, "document.qmd"))
+			require.NoError(t, err)
+			assert.Equal(t, "# Slides", string(source))
+			params, err := os.ReadFile(filepath.Join(jobDir, "params.yml"))
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"region":"north","year":2024}`, string(params))
+
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "render.log"), []byte("processing file: document.qmd\nOutput created: output.html\n"), 0644))
+			return []byte("<html></html>"), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := RenderQuarto(QuartoRenderArgs{
+		Content:  "# Slides",
+		Filename: "deck",
+		Params:   map[string]any{"region": "north", "year": 2024},
+		Format:   "revealjs",
+	})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 3)
+	assert.Equal(t, "Successfully rendered deck.qmd to deck.html", response.Content[0].TextContent.Text)
+	assert.Equal(t, "rmd-output:///deck.html", response.Content[1].EmbeddedResource.TextResourceContents.Uri)
+	assert.Equal(t, "<html></html>", response.Content[1].EmbeddedResource.TextResourceContents.Text)
+	assert.Equal(t, "Render log:\nprocessing file: document.qmd\nOutput created: output.html", response.Content[2].TextContent.Text)
+
+	data, err := os.ReadFile(filepath.Join(dir, "output", "deck.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "<html></html>", string(data))
+}
+
+// TestRenderQuartoWorkspaceFile tests rendering a .qmd file from the workspace
+func TestRenderQuartoWorkspaceFile(t *testing.T) {
+	dir := setupRmdDir(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "report.qmd"), []byte("# Report"), 0644))
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.NotContains(t, string(script), "embed-resources")
+			assert.NotContains(t, string(script), "--execute-params")
+
+			jobDir := filepath.Dir(config.OutputPath)
+			source, err := os.ReadFile(filepath.Join(jobDir, "document.qmd"))
+			require.NoError(t, err)
+			assert.Equal(t, "# Report", string(source))
+
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "render.log"), nil, 0644))
+			return []byte("%PDF"), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := RenderQuarto(QuartoRenderArgs{Filename: "report.qmd", Format: "pdf"})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 2)
+	assert.Equal(t, "Successfully rendered report.qmd to report.pdf", response.Content[0].TextContent.Text)
+	assert.Equal(t, "application/pdf", *response.Content[1].EmbeddedResource.BlobResourceContents.MimeType)
+}
+
+// TestRenderQuartoValidation tests the validation of the render arguments
+func TestRenderQuartoValidation(t *testing.T) {
+	setupRmdDir(t)
+
+	tests := []struct {
+		name     string
+		args     QuartoRenderArgs
+		errorMsg string
+	}{
+		{"No input", QuartoRenderArgs{}, "either content or filename is required"},
+		{"Missing file", QuartoRenderArgs{Filename: "missing"}, "Quarto document not found: missing.qmd"},
+		{"Path traversal", QuartoRenderArgs{Filename: "../secret.qmd"}, "invalid filename"},
+		{"Bad format", QuartoRenderArgs{Content: "# Hi", Format: "epub"}, "format must be html, pdf, docx or revealjs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := RenderQuarto(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
@@ -1,13 +1,20 @@
 package mcp
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 )
 
+// ExecutionTimeout limits how long a single R script may run; zero disables
+// the limit
+var ExecutionTimeout = 10 * time.Minute
+
 // RExecutionConfig represents configuration for R script execution
 type RExecutionConfig struct {
 	ScriptPath   string
@@ -16,6 +23,14 @@ type RExecutionConfig struct {
 	Width        int
 	Height       int
 	Resolution   int
+
+	// Timeout limits the run time of this script when it is shorter than
+	// ExecutionTimeout
+	Timeout time.Duration
+
+	// Inputs are the files the script reads from outside its directory, such
+	// as datasets, databases and R Markdown sources; bundles copy them
+	Inputs []string
 }
 
 // RExecutor defines the interface for executing R scripts
@@ -54,8 +69,23 @@ func (e *DefaultRExecutor) ExecuteRScript(config RExecutionConfig) ([]byte, erro
 		}
 	}()
 
-	// Execute the R script
-	cmd := exec.Command("Rscript", config.ScriptPath)
+	// Execute the R script, killing it when it exceeds the time limit
+	timeout := ExecutionTimeout
+	if config.Timeout > 0 && (timeout == 0 || config.Timeout < timeout) {
+		timeout = config.Timeout
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "Rscript", config.ScriptPath)
+	killProcessGroup(cmd)
+
+	// Don't wait for children that keep the output pipes open after they
+	// were killed
+	cmd.WaitDelay = 5 * time.Second
 
 	// Set environment variables for the R script
 	cmd.Env = append(os.Environ(),
@@ -67,6 +97,9 @@ func (e *DefaultRExecutor) ExecuteRScript(config RExecutionConfig) ([]byte, erro
 
 	// Capture stdout and stderr
 	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("R script timed out after %s\nOutput: %s", timeout, string(output))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute R script: %w\nOutput: %s", err, string(output))
 	}
@@ -107,6 +140,14 @@ func GetMimeType(outputFormat string) string {
 		return "application/pdf"
 	case "svg":
 		return "image/svg+xml"
+	case "html":
+		return "text/html"
+	case "docx":
+		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	case "csv":
+		return "text/csv"
+	case "json":
+		return "application/json"
 	default:
 		return "application/octet-stream"
 	}
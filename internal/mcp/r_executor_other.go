@@ -0,0 +1,9 @@
+//go:build !unix
+
+package mcp
+
+import "os/exec"
+
+// killProcessGroup keeps the default cancellation, which only kills the
+// command itself, on systems without process groups
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package mcp
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKillProcessGroup tests that cancelling a command also kills the
+// children it started
+func TestKillProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 30 & wait")
+	killProcessGroup(cmd)
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	require.Error(t, cmd.Run())
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// The group, including the sleep started by the shell, is gone
+	assert.Eventually(t, func() bool {
+		return syscall.Kill(-cmd.Process.Pid, 0) == syscall.ESRCH
+	}, 2*time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,185 @@
+package mcp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// mathFunctions are vectorized base R functions that user supplied
+// expressions may call
+var mathFunctions = map[string]bool{
+	"abs": true, "sqrt": true, "exp": true, "log": true, "log10": true, "log2": true, "log1p": true,
+	"round": true, "signif": true, "floor": true, "ceiling": true, "trunc": true,
+	"pmin": true, "pmax": true, "ifelse": true, "is.na": true,
+	"sin": true, "cos": true, "tan": true,
+}
+
+// rConstants are the R literals that may appear in expressions
+var rConstants = map[string]bool{
+	"TRUE": true, "FALSE": true, "T": true, "F": true,
+	"NA": true, "NULL": true, "Inf": true, "NaN": true, "pi": true,
+}
+
+// rOperators are the operators accepted in expressions, longest first so that
+// the tokenizer prefers "<=" over "<"
+var rOperators = []string{
+	"%in%", "%/%", "%%", "&&", "||", "==", "!=", "<=", ">=",
+	"+", "-", "*", "/", "^", "<", ">", "!", "&", "|", "~", ":", "(", ")", ",",
+}
+
+var (
+	rIdentifierPattern = regexp.MustCompile(`^(?:[A-Za-z]|\.[A-Za-z_.])[A-Za-z0-9._]*`)
+	rNumberPattern     = regexp.MustCompile(`^(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][+-]?[0-9]+)?L?`)
+	rReservedWords     = map[string]bool{
+		"if": true, "else": true, "repeat": true, "while": true, "function": true,
+		"for": true, "next": true, "break": true, "in": true,
+	}
+)
+
+// validateRExpression checks that expr only uses literals, the allowed
+// operators, the given names and calls to the given functions. It is used to
+// accept small R expressions from clients (formulas, filters, computed
+// columns) without allowing arbitrary code. Any name followed by a parenthesis,
+// backquoted or not and across line breaks, is a call and must be one of the
+// functions, since R looks up a function of that name even when a variable
+// hides it. Arguments of calls may be named,
+// as in mean(x, na.rm = TRUE). A nil names map accepts any name, for
+// expressions over columns that are only known once the data is loaded in R;
+// the caller must check the names there.
+func validateRExpression(expr string, names map[string]bool, functions map[string]bool) error {
+	if strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("expression is empty")
+	}
+
+	// calls records for each open parenthesis whether it starts the arguments
+	// of a call; prev is the previous token, or "" for a value
+	var calls []bool
+	call := false
+	prev := "("
+	rest := expr
+	for len(rest) > 0 {
+		c := rest[0]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			rest = rest[1:]
+			continue
+
+		case c == '"' || c == '\'':
+			end := closingQuote(rest)
+			if end < 0 {
+				return fmt.Errorf("unterminated string in expression")
+			}
+			rest = rest[end+1:]
+			prev = ""
+			continue
+
+		case c == '`':
+			end := strings.IndexByte(rest[1:], '`')
+			if end < 0 {
+				return fmt.Errorf("unterminated name in expression")
+			}
+			name := rest[1 : end+1]
+			rest = rest[end+2:]
+			if strings.HasPrefix(strings.TrimLeft(rest, " \t\r\n"), "(") {
+				if !functions[name] {
+					return fmt.Errorf("function not allowed in expression: %s", name)
+				}
+				call = true
+			} else if names != nil && !names[name] {
+				return fmt.Errorf("unknown name in expression: %s", name)
+			}
+			prev = ""
+			continue
+		}
+
+		if m := rNumberPattern.FindString(rest); m != "" {
+			rest = rest[len(m):]
+			prev = ""
+			continue
+		}
+
+		if m := rIdentifierPattern.FindString(rest); m != "" {
+			rest = rest[len(m):]
+			if rReservedWords[m] {
+				return fmt.Errorf("%s is not allowed in expressions", m)
+			}
+			next := strings.TrimLeft(rest, " \t\r\n")
+			switch {
+			case strings.HasPrefix(next, "("):
+				if !functions[m] {
+					return fmt.Errorf("function not allowed in expression: %s", m)
+				}
+				call = true
+			case len(calls) > 0 && calls[len(calls)-1] && (prev == "(" || prev == ",") &&
+				strings.HasPrefix(next, "=") && !strings.HasPrefix(next, "=="):
+				// An argument name
+				rest = next[1:]
+				prev = "="
+				continue
+			case names != nil && !names[m] && !rConstants[m]:
+				return fmt.Errorf("unknown name in expression: %s", m)
+			}
+			prev = ""
+			continue
+		}
+
+		if strings.HasPrefix(rest, "<-") || strings.HasPrefix(rest, "->") || strings.HasPrefix(rest, "::") {
+			return fmt.Errorf("%s is not allowed in expressions", rest[:2])
+		}
+
+		op := ""
+		for _, candidate := range rOperators {
+			if strings.HasPrefix(rest, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return fmt.Errorf("unexpected character in expression: %q", rest[0])
+		}
+		switch op {
+		case "(":
+			// A parenthesis after a value would call it, as in
+			// (f)(x) or "f"(x)
+			if !call && (prev == "" || prev == ")") {
+				return fmt.Errorf("only calls to named functions are allowed in expressions")
+			}
+			calls = append(calls, call)
+		case ")":
+			if len(calls) == 0 {
+				return fmt.Errorf("unbalanced parentheses in expression")
+			}
+			calls = calls[:len(calls)-1]
+		}
+		call = false
+		prev = op
+		rest = rest[len(op):]
+	}
+
+	if len(calls) != 0 {
+		return fmt.Errorf("unbalanced parentheses in expression")
+	}
+	return nil
+}
+
+// closingQuote returns the index of the quote that closes the string literal
+// at the start of s, or -1 if the string is not terminated
+func closingQuote(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// isRIdentifier reports whether name can be used as a syntactic R name
+func isRIdentifier(name string) bool {
+	return rIdentifierPattern.FindString(name) == name &&
+		!rReservedWords[name] && !rConstants[name]
+}
@@ -0,0 +1,61 @@
+package mcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateRExpression tests that only whitelisted names and functions are accepted
+func TestValidateRExpression(t *testing.T) {
+	names := map[string]bool{"design": true, "build": true, "region name": true}
+
+	tests := []struct {
+		expr     string
+		errorMsg string
+	}{
+		{expr: "design + build * 1.2"},
+		{expr: "pmax(design, build) / 2e3"},
+		{expr: "ifelse(design > 10 & !is.na(build), design, 0)"},
+		{expr: "`region name` %in% c", errorMsg: "unknown name in expression: c"},
+		{expr: "design == 'EU' | build <= -1"},
+		{expr: "", errorMsg: "expression is empty"},
+		{expr: "system('rm -rf /')", errorMsg: "function not allowed in expression: system"},
+		{expr: "design<-1", errorMsg: "<- is not allowed"},
+		{expr: "base::system", errorMsg: "unknown name in expression: base"},
+		{expr: "design; build", errorMsg: "unexpected character"},
+		{expr: "design[1]", errorMsg: "unexpected character"},
+		{expr: "(design + build", errorMsg: "unbalanced parentheses"},
+		{expr: "round(design / build, digits = 2) == 0.5"},
+		{expr: "pmax(design == 1, build)"},
+		{expr: "(design = 1)", errorMsg: "unexpected character"},
+		{expr: "round(design, (digits = 2))", errorMsg: "unknown name in expression: digits"},
+		{expr: "round(digits = system('ls'))", errorMsg: "function not allowed in expression: system"},
+		{expr: "function(x) x", errorMsg: "function is not allowed"},
+		{expr: "'unterminated", errorMsg: "unterminated string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			err := validateRExpression(tt.expr, names, mathFunctions)
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.errorMsg)
+			}
+		})
+	}
+
+	// Without a names map any name is accepted but calls are still checked
+	assert.NoError(t, validateRExpression("mpg > 25 & `gear count` == 4", nil, mathFunctions))
+	assert.EqualError(t, validateRExpression("system(cmd)", nil, mathFunctions), "function not allowed in expression: system")
+
+	// Calls hidden behind backquotes, line breaks or parentheses are checked too
+	assert.EqualError(t, validateRExpression("`system`('id')", nil, mathFunctions), "function not allowed in expression: system")
+	assert.EqualError(t, validateRExpression("`system` ('id')", names, mathFunctions), "function not allowed in expression: system")
+	assert.EqualError(t, validateRExpression("system\n('id')", nil, mathFunctions), "function not allowed in expression: system")
+	assert.EqualError(t, validateRExpression("design +\n  system\r\n\t('id')", nil, mathFunctions), "function not allowed in expression: system")
+	assert.EqualError(t, validateRExpression("(system)('id')", nil, mathFunctions), "only calls to named functions are allowed in expressions")
+	assert.EqualError(t, validateRExpression("\"system\"('id')", nil, mathFunctions), "only calls to named functions are allowed in expressions")
+	assert.NoError(t, validateRExpression("`round`(design)\n+ abs\n(build)", names, mathFunctions))
+}
@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rJob is the working directory of a single tool invocation. Tools write their
+// inputs into it, run a generated R script against it and read back any
+// auxiliary outputs before the directory is wiped.
+type rJob struct {
+	Dir string
+}
+
+// newRJob creates a new job directory with the given prefix
+func newRJob(prefix string) (*rJob, error) {
+	dir, err := os.MkdirTemp("", prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	return &rJob{Dir: dir}, nil
+}
+
+// Path returns the path of a file inside the job directory
+func (j *rJob) Path(name string) string {
+	return filepath.Join(j.Dir, name)
+}
+
+// WriteFile writes an input file into the job directory and returns its path
+func (j *rJob) WriteFile(name string, data []byte) (string, error) {
+	path := j.Path(name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return path, nil
+}
+
+// ReadFile reads an auxiliary output file written by the R script
+func (j *rJob) ReadFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(j.Path(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// Run writes the script into the job directory and executes it, returning the
+// contents of the named output file. ScriptPath and OutputPath of the config
+// are filled in by Run.
+func (j *rJob) Run(script string, outputName string, config RExecutionConfig) ([]byte, error) {
+	config.ScriptPath = j.Path("script.R")
+	config.OutputPath = j.Path(outputName)
+
+	if err := os.WriteFile(config.ScriptPath, []byte(script), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write R script: %w", err)
+	}
+
+	outputData, err := ExecuteRScript(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute R script: %w", err)
+	}
+	return outputData, nil
+}
+
+// Close removes the job directory
+func (j *rJob) Close() {
+	os.RemoveAll(j.Dir)
+}
+
+// rQuote returns s as a double-quoted R string literal. Go's escape sequences
+// (\n, \t, \", \\, \xhh, \uhhhh, \Uhhhhhhhh) are all understood by R.
+func rQuote(s string) string {
+	return strconv.Quote(s)
+}
+
+// rName returns name as an R symbol, backquoted unless it is a syntactic name
+func rName(name string) string {
+	if isRIdentifier(name) {
+		return name
+	}
+	return "`" + strings.ReplaceAll(name, "`", "\\`") + "`"
+}
+
+// rBool formats a Go bool as an R logical literal
+func rBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// formatRNumber formats a float as an R numeric literal without losing precision
+func formatRNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatRNumbers formats floats as a comma separated list of R numeric literals
+func formatRNumbers(values []float64) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = formatRNumber(v)
+	}
+	return strings.Join(parts, ", ")
+}
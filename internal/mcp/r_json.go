@@ -0,0 +1,223 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// RJSONArgs represents the arguments for evaluating R code to JSON
+type RJSONArgs struct {
+	Code  string `json:"code" jsonschema:"required,description=R code whose last value is returned as JSON"`
+	Unbox bool   `json:"unbox,omitempty" jsonschema:"description=Return vectors of length one as scalars instead of one-element arrays"`
+
+	BundleOption
+}
+
+// maxRJSONBytes bounds the size of the JSON returned by evaluate_r_json
+const maxRJSONBytes = 5 << 20
+
+// rJSONSchemaURI is the URI of the resource holding rJSONSchema
+const rJSONSchemaURI = "schema:///evaluate_r_json.json"
+
+// rJSONSchema is the JSON Schema of the evaluate_r_json result
+const rJSONSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "schema:///evaluate_r_json.json",
+  "title": "evaluate_r_json result",
+  "type": "object",
+  "properties": {
+    "type": {
+      "type": "string",
+      "description": "typeof() of the value, e.g. double, character, list"
+    },
+    "class": {
+      "type": "array",
+      "items": {"type": "string"},
+      "description": "class() of the value"
+    },
+    "value": {
+      "description": "The value converted with the R to JSON mapping"
+    },
+    "output": {
+      "type": "string",
+      "description": "Text printed while evaluating the code"
+    },
+    "warnings": {
+      "type": "array",
+      "items": {"type": "string"},
+      "description": "Warnings signalled while evaluating the code"
+    }
+  },
+  "required": ["type", "class", "value", "output", "warnings"],
+  "additionalProperties": false
+}
+`
+
+// rJSONResult is the envelope returned by evaluate_r_json, described by
+// rJSONSchema
+type rJSONResult struct {
+	Type     string          `json:"type"`
+	Class    []string        `json:"class"`
+	Value    json.RawMessage `json:"value"`
+	Output   string          `json:"output"`
+	Warnings []string        `json:"warnings"`
+}
+
+// rJSONScript converts a value to JSON. The mapping is:
+//
+//   - NULL is null and NA, NaN and infinite values are null
+//   - logical, integer, double and character vectors are arrays, or scalars
+//     with unbox for length one
+//   - named vectors are objects of scalars
+//   - factors are their labels, Dates are "YYYY-MM-DD" strings, date-times
+//     are ISO 8601 strings in UTC and complex numbers are strings
+//   - matrices are arrays of rows
+//   - data frames are arrays of row objects
+//   - named lists are objects and unnamed lists arrays; missing names are
+//     replaced by the position
+//   - other S3 objects are converted as their underlying list or vector
+//
+// The value is wrapped in an envelope with its type, class, printed output and
+// warnings.
+//
+// Functions, environments, language objects and S4 objects cannot be
+// converted and stop with an error. The script runs in the local environment
+// of the driver, which provides code_file, output_file and unbox.
+const rJSONScript = `
+convert_atomic <- function(x) {
+  dims <- dim(x)
+  dim_names <- dimnames(x)
+  vector_names <- names(x)
+  if (is.factor(x)) {
+    x <- as.character(x)
+  } else if (inherits(x, "Date")) {
+    x <- format(x, "%Y-%m-%d")
+  } else if (inherits(x, "POSIXt")) {
+    x <- format(as.POSIXct(x), "%Y-%m-%dT%H:%M:%SZ", tz = "UTC")
+  } else if (is.complex(x)) {
+    x <- as.character(x)
+  } else if (is.raw(x)) {
+    x <- as.integer(x)
+  }
+  x <- as.vector(unclass(x))
+  if (length(dims) == 2) {
+    dim(x) <- dims
+    dimnames(x) <- dim_names
+  } else if (!is.null(vector_names)) {
+    names(x) <- vector_names
+  }
+  x
+}
+
+position_names <- function(x) {
+  n <- names(x)
+  ifelse(is.na(n) | !nzchar(n), as.character(seq_along(x)), n)
+}
+
+to_json_value <- function(x) {
+  if (is.null(x)) return(NULL)
+  if (inherits(x, "POSIXlt")) x <- as.POSIXct(x)
+  if (isS4(x)) stop("cannot convert S4 object of class ", class(x)[1], " to JSON")
+  if (is.function(x) || is.environment(x) || is.language(x)) stop("cannot convert ", typeof(x), " to JSON")
+  if (is.data.frame(x)) {
+    x[] <- lapply(x, function(col) if (is.list(col)) lapply(col, to_json_value) else unname(convert_atomic(col)))
+    rownames(x) <- NULL
+    return(x)
+  }
+  if (is.list(x)) {
+    out <- lapply(unclass(x), to_json_value)
+    names(out) <- if (is.null(names(x))) NULL else position_names(x)
+    return(out)
+  }
+  x <- convert_atomic(x)
+  if (is.matrix(x) || is.null(names(x))) return(x)
+  out <- lapply(unname(x), jsonlite::unbox)
+  names(out) <- position_names(x)
+  out
+}
+
+warnings <- character()
+output <- tryCatch(utils::capture.output({
+  value <- withCallingHandlers(
+    eval(parse(file = code_file, keep.source = FALSE, encoding = "UTF-8"), globalenv()),
+    warning = function(w) {
+      warnings <<- c(warnings, conditionMessage(w))
+      invokeRestart("muffleWarning")
+    }
+  )
+}), error = function(e) {
+  message("Error: ", conditionMessage(e))
+  quit(save = "no", status = 1)
+})
+
+result <- list(
+  type = jsonlite::unbox(typeof(value)),
+  class = I(class(value)),
+  value = to_json_value(value),
+  output = jsonlite::unbox(paste(output, collapse = "\n")),
+  warnings = I(warnings)
+)
+json <- jsonlite::toJSON(result, dataframe = "rows", matrix = "rowmajor", na = "null", null = "null",
+  digits = NA, auto_unbox = unbox)
+writeLines(json, output_file, useBytes = TRUE)
+`
+
+// EvaluateRJSON evaluates R code and returns its last value as JSON in an
+// envelope described by rJSONSchema
+func EvaluateRJSON(args RJSONArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if args.Code == "" {
+		return nil, fmt.Errorf("code is required")
+	}
+
+	job, err := newRJob("r-json-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	codePath, err := job.WriteFile("code.R", []byte(args.Code))
+	if err != nil {
+		return nil, err
+	}
+
+	// The code runs in the global environment while the driver keeps its own
+	// state in a local environment, so the code can neither see nor remove it
+	scriptContent := fmt.Sprintf(`
+local({
+code_file <- %s
+output_file <- %s
+unbox <- %s
+%s})
+`, rQuote(codePath), rQuote(job.Path("output.json")), rBool(args.Unbox), rJSONScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{})
+	if err != nil {
+		session.record("evaluate_r_json", args.Code, errorOutputs(err))
+		return nil, err
+	}
+
+	if len(outputData) > maxRJSONBytes {
+		return nil, fmt.Errorf("value is too large to return as JSON (%d bytes, at most %d)", len(outputData), maxRJSONBytes)
+	}
+	var result rJSONResult
+	if err := json.Unmarshal(outputData, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON value: %w", err)
+	}
+	if result.Class == nil || result.Warnings == nil || result.Value == nil {
+		return nil, fmt.Errorf("JSON value does not match the evaluate_r_json schema")
+	}
+
+	session.record("evaluate_r_json", args.Code, []sessionOutput{{Type: "stdout", Text: string(outputData)}})
+
+	return mcp.NewToolResponse(
+		mcp.NewTextResourceContent("result:///value.json", string(outputData), GetMimeType("json")),
+	), nil
+}
+
+// rJSONSchemaResource returns the JSON Schema of the evaluate_r_json result
+func rJSONSchemaResource() (*mcp.ResourceResponse, error) {
+	return mcp.NewResourceResponse(mcp.NewTextEmbeddedResource(rJSONSchemaURI, rJSONSchema, "application/schema+json")), nil
+}
@@ -0,0 +1,64 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvaluateRJSON tests that the JSON value is returned as an embedded resource
+func TestEvaluateRJSON(t *testing.T) {
+	setupSession(t)
+
+	value := `{"type":"list","class":["list"],"value":{"n":[32],"when":["2024-05-01"],"m":[[1,3],[2,4]]},"output":"","warnings":["NAs introduced by coercion"]}`
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			code, err := os.ReadFile(filepath.Join(filepath.Dir(config.OutputPath), "code.R"))
+			require.NoError(t, err)
+			assert.Equal(t, "list(n = 32L)", string(code))
+
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "unbox <- TRUE\n")
+			assert.True(t, strings.HasPrefix(strings.TrimSpace(string(script)), "local({"), "the driver state is kept out of the global environment")
+			return []byte(value), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := EvaluateRJSON(RJSONArgs{Code: "list(n = 32L)", Unbox: true})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 1)
+	resource := response.Content[0].EmbeddedResource.TextResourceContents
+	assert.Equal(t, "result:///value.json", resource.Uri)
+	assert.Equal(t, "application/json", *resource.MimeType)
+	assert.JSONEq(t, value, resource.Text)
+	assert.Equal(t, "list(n = 32L)", session.snapshot()[0].Code)
+}
+
+// TestEvaluateRJSONSchema tests that values outside the result schema are rejected
+func TestEvaluateRJSONSchema(t *testing.T) {
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal([]byte(rJSONSchema), &schema))
+	assert.Equal(t, rJSONSchemaURI, schema["$id"])
+
+	for _, output := range []string{`{"type":"double","class":["numeric"],"output":"","warnings":[]}`, `[1, 2]`} {
+		cleanup := SetupMockExecutor(&MockRExecutor{
+			MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+				return []byte(output), nil
+			},
+		})
+		_, err := EvaluateRJSON(RJSONArgs{Code: "1"})
+		assert.Error(t, err, output)
+		cleanup()
+	}
+
+	_, err := EvaluateRJSON(RJSONArgs{})
+	assert.EqualError(t, err, "code is required")
+}
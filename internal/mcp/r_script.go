@@ -1,44 +1,248 @@
 package mcp
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	mcp "github.com/metoro-io/mcp-golang"
 )
 
 // RScriptArgs represents the arguments for executing an R script
 type RScriptArgs struct {
-	Code string `json:"code" jsonschema:"required,description=R code to execute"`
+	Code       string   `json:"code" jsonschema:"required,description=R code to execute"`
+	Results    []string `json:"results,omitempty" jsonschema:"description=Names of objects to return serialized by type in addition to the last value"`
+	MaxRows    int      `json:"max_rows,omitempty" jsonschema:"description=Maximum number of data frame rows shown as markdown (default 20, maximum 1000)"`
+	DataFormat string   `json:"data_format,omitempty" jsonschema:"description=Format of the full data frame resources (csv, json)"`
+
+	BundleOption
+}
+
+// scriptResult is a value of the script serialized by type. Data frames and
+// models come with a preview table and a file holding all rows, lists with a
+// JSON file and anything else as printed text.
+type scriptResult struct {
+	Name    string         `json:"name"`
+	Type    string         `json:"type"`
+	Class   string         `json:"class"`
+	Rows    int            `json:"rows"`
+	Columns int            `json:"columns"`
+	File    string         `json:"file"`
+	Text    string         `json:"text"`
+	Table   *renderedTable `json:"table"`
+}
+
+// tablePreviewScript defines table_preview, which formats the first rows of a
+// data frame as a renderedTable
+const tablePreviewScript = `
+list_cells <- function(x) vapply(x, function(v) paste(format(v), collapse = ", "), "")
+
+table_preview <- function(df, max_rows) {
+  shown <- utils::head(df, max_rows)
+  cells <- lapply(shown, function(x) {
+    out <- if (is.list(x)) list_cells(x) else format(x, trim = TRUE)
+    out[is.na(x)] <- "NA"
+    out
+  })
+  list(
+    total_rows = nrow(df),
+    columns = lapply(names(df), function(n) list(label = n, align = if (is.numeric(df[[n]])) "right" else "left")),
+    rows = lapply(seq_len(nrow(shown)), function(r) list(
+      group = "",
+      cells = I(vapply(cells, function(x) x[r], "")),
+      highlighted = I(rep(FALSE, ncol(df)))
+    ))
+  )
+}
+`
+
+// scriptResultScript defines the functions serializing the results of a
+// script. It is included in the local environment of the script driver, which
+// provides job_dir, data_format and max_rows.
+const scriptResultScript = tablePreviewScript + `
+model_classes <- c("lm", "glm", "nls", "aov", "Arima", "lmerMod", "glmerMod", "coxph", "gam", "polr", "multinom")
+
+# Tidy coefficient table of a model: broom when it knows the model, the
+# coefficient matrix of its summary otherwise
+tidy_model <- function(m) {
+  if (requireNamespace("broom", quietly = TRUE)) {
+    tidy <- tryCatch(as.data.frame(broom::tidy(m)), error = function(e) NULL)
+    if (!is.null(tidy)) return(tidy)
+  }
+  coefs <- tryCatch(stats::coef(summary(m)), error = function(e) NULL)
+  if (!is.matrix(coefs)) return(NULL)
+  df <- data.frame(term = rownames(coefs), unname(coefs), stringsAsFactors = FALSE)
+  names(df) <- c("term", c("estimate", "std.error", "statistic", "p.value")[seq_len(ncol(coefs))])
+  df
+}
+
+# Preview table and full file of a data frame
+table_result <- function(result, df, stem) {
+  df <- as.data.frame(df, stringsAsFactors = FALSE)
+  if (.row_names_info(df) > 0) df <- cbind(data.frame(rowname = rownames(df), stringsAsFactors = FALSE), df)
+  rownames(df) <- NULL
+
+  result$rows <- nrow(df)
+  result$columns <- ncol(df)
+  result$file <- paste0(stem, ".", data_format)
+  if (data_format == "csv") {
+    # List columns, such as nested tibbles, are written as their preview text
+    csv <- df
+    csv[] <- lapply(csv, function(x) if (is.list(x)) list_cells(x) else x)
+    utils::write.csv(csv, file.path(job_dir, result$file), row.names = FALSE, na = "")
+  } else {
+    jsonlite::write_json(df, file.path(job_dir, result$file), dataframe = "rows", na = "null", digits = NA, pretty = TRUE)
+  }
+
+  result$table <- table_preview(df, max_rows)
+  result
+}
+
+# Serialize a value by type, or return NULL when it is best printed or cannot
+# be serialized, so a value the writers reject is printed instead
+serialize_result <- function(name, value, stem) {
+  tryCatch(serialize_value(name, value, stem), error = function(e) NULL)
+}
+
+serialize_value <- function(name, value, stem) {
+  result <- list(name = name, class = class(value)[1])
+  if (inherits(value, model_classes)) {
+    tidy <- tidy_model(value)
+    if (is.null(tidy)) return(NULL)
+    result$type <- "model"
+    return(table_result(result, tidy, stem))
+  }
+  if (is.data.frame(value) || (is.matrix(value) && (is.numeric(value) || is.character(value) || is.logical(value)))) {
+    result$type <- "data_frame"
+    return(table_result(result, value, stem))
+  }
+  if (is.list(value) && !is.object(value)) {
+    result$type <- "list"
+    result$file <- paste0(stem, ".json")
+    jsonlite::write_json(value, file.path(job_dir, result$file), auto_unbox = TRUE, null = "null", na = "null", digits = NA, force = TRUE, pretty = TRUE)
+    return(result)
+  }
+  NULL
 }
+`
 
-// ExecuteRScriptTool executes an R script and returns the result as text
+// ExecuteRScriptTool executes an R script and returns its console output. The
+// last value of the script, when visible, and the named result objects are
+// returned serialized by type: data frames as markdown with the full data as a
+// CSV or JSON resource, lists as JSON and models as tidy coefficient tables.
 func ExecuteRScriptTool(args RScriptArgs) (*mcp.ToolResponse, error) {
 	// Validate arguments
 	if args.Code == "" {
 		return nil, fmt.Errorf("code is required")
 	}
 
-	// Create a temporary directory for the R script and output
-	tempDir, err := os.MkdirTemp("", "r-script-")
+	for _, name := range args.Results {
+		if !isRIdentifier(name) {
+			return nil, fmt.Errorf("invalid result name: %q", name)
+		}
+	}
+
+	maxRows := args.MaxRows
+	if maxRows == 0 {
+		maxRows = 20
+	} else if maxRows < 1 || maxRows > maxTableRows {
+		return nil, fmt.Errorf("max_rows must be between 1 and %d", maxTableRows)
+	}
+
+	dataFormat := args.DataFormat
+	if dataFormat == "" {
+		dataFormat = "csv"
+	} else if dataFormat != "csv" && dataFormat != "json" {
+		return nil, fmt.Errorf("data_format must be csv or json")
+	}
+
+	datasetCode, err := datasetPreamble()
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := datasetInputs(args.Code)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		return nil, err
 	}
-	defer os.RemoveAll(tempDir)
 
-	// Create the R script
-	scriptPath := filepath.Join(tempDir, "script.R")
-	outputPath := filepath.Join(tempDir, "output.txt")
+	job, err := newRJob("r-script-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
 
-	// Generate the R script content with output capture
+	codePath, err := job.WriteFile("code.R", []byte(args.Code))
+	if err != nil {
+		return nil, err
+	}
+
+	resultNames := make([]string, len(args.Results))
+	for i, name := range args.Results {
+		resultNames[i] = rQuote(name)
+	}
+
+	// Generate the R script content with output capture. The code runs in
+	// the global environment one expression at a time so that visible values
+	// are printed as on the console, while the driver keeps its own state in
+	// a local environment.
+	outputPath := job.Path("output.txt")
 	scriptContent := fmt.Sprintf(`
 # Redirect output to a file
-sink("%s")
-
+sink(%s)
+%s
 # Execute the provided code
+local({
+  job_dir <- %s
+  data_format <- %s
+  max_rows <- %d
 %s
 
+  # Stop with an error message like the console does
+  fail <- function(msg, call = NULL) {
+    sink()
+    message(if (is.null(call)) "Error: " else paste0("Error in ", call, " : "), msg)
+    quit(save = "no", status = 1)
+  }
+
+  exprs <- parse(file = %s, keep.source = FALSE, encoding = "UTF-8")
+  last <- list(value = NULL, visible = FALSE)
+  for (i in seq_along(exprs)) {
+    last <- tryCatch(withVisible(eval(exprs[[i]], globalenv())), error = function(err) {
+      call <- conditionCall(err)
+      if (is.null(call) || identical(call[[1]], quote(eval))) fail(conditionMessage(err))
+      fail(conditionMessage(err), paste(deparse(call, nlines = 1), collapse = ""))
+    })
+    if (last$visible && i < length(exprs)) {
+      if (isS4(last$value)) methods::show(last$value) else print(last$value)
+    }
+  }
+
+  # Serialize the last visible value and the named results
+  results <- list()
+  if (last$visible) {
+    result <- serialize_result("", last$value, "result")
+    if (is.null(result)) {
+      if (isS4(last$value)) methods::show(last$value) else print(last$value)
+    } else {
+      results[[length(results) + 1]] <- result
+    }
+  }
+  for (name in c(%s)) {
+    if (!exists(name, envir = globalenv(), inherits = FALSE)) fail(paste("result object not found:", name))
+    value <- get(name, envir = globalenv(), inherits = FALSE)
+    result <- serialize_result(name, value, name)
+    if (is.null(result)) {
+      result <- list(name = name, type = "text", class = class(value)[1], text = paste(utils::capture.output(print(value)), collapse = "\n"))
+    }
+    results[[length(results) + 1]] <- result
+  }
+  jsonlite::write_json(results, file.path(job_dir, "results.json"), auto_unbox = TRUE, digits = NA, pretty = TRUE)
+})
+
 # Make sure the output file is created
 cat("Output file path: %s\n")
 
@@ -46,29 +250,109 @@ cat("Output file path: %s\n")
 sink()
 
 # Write directly to the output file as a fallback
-cat("R script execution completed successfully!\n", file="%s", append=TRUE)
-`, outputPath, args.Code, outputPath, outputPath)
+cat("R script execution completed successfully!\n", file = %s, append = TRUE)
+`, rQuote(outputPath), datasetCode, rQuote(job.Dir), rQuote(dataFormat), maxRows, scriptResultScript,
+		rQuote(codePath), strings.Join(resultNames, ", "), outputPath, rQuote(outputPath))
 
 	// Write the R script to a file
+	scriptPath := job.Path("script.R")
 	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0644); err != nil {
 		return nil, fmt.Errorf("failed to write R script: %w", err)
 	}
 
 	// Execute the R script
-	config := RExecutionConfig{
+	outputData, err := ExecuteRScript(RExecutionConfig{
 		ScriptPath: scriptPath,
 		OutputPath: outputPath,
+		Inputs:     inputs,
+	})
+	if err != nil {
+		session.record("execute_r_script", args.Code, errorOutputs(err))
+		return nil, fmt.Errorf("failed to execute R script: %w", err)
 	}
 
-	// Execute the R script using the existing ExecuteRScript function
-	// This will return the output data directly
-	outputData, err := ExecuteRScript(config)
+	results, err := readScriptResults(job)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute R script: %w", err)
+		return nil, err
 	}
 
-	// Create the text content
-	textContent := mcp.NewTextContent(string(outputData))
+	// Create the text content followed by the results
+	content := []*mcp.Content{mcp.NewTextContent(string(outputData))}
+	for _, result := range results {
+		resultContent, err := scriptResultContent(job, result)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, resultContent...)
+	}
 
-	return mcp.NewToolResponse(textContent), nil
+	// Record the snippet without the lines added by the script wrapper
+	output, _, _ := strings.Cut(string(outputData), "Output file path: ")
+	outputs := []sessionOutput{{Type: "stdout", Text: output}}
+	for _, c := range content[1:] {
+		if c.TextContent != nil {
+			outputs = append(outputs, sessionOutput{Type: "stdout", Text: c.TextContent.Text})
+		}
+	}
+	session.record("execute_r_script", args.Code, outputs)
+
+	return mcp.NewToolResponse(content...), nil
+}
+
+// readScriptResults reads the serialized results of a script; scripts that
+// stopped before writing them have none
+func readScriptResults(job *rJob) ([]scriptResult, error) {
+	data, err := os.ReadFile(job.Path("results.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+
+	var results []scriptResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse results: %w", err)
+	}
+	return results, nil
+}
+
+// scriptResultContent formats a serialized result for the tool response
+func scriptResultContent(job *rJob, result scriptResult) ([]*mcp.Content, error) {
+	label := "Result"
+	if result.Name != "" {
+		label = result.Name
+	}
+
+	switch result.Type {
+	case "data_frame", "model":
+		if result.Table == nil {
+			return nil, fmt.Errorf("result %s has no table", label)
+		}
+		description := fmt.Sprintf("data frame with %d rows and %d columns", result.Rows, result.Columns)
+		if result.Type == "model" {
+			description = result.Class + " model coefficients"
+		}
+		file := filepath.Base(result.File)
+		data, err := job.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return []*mcp.Content{
+			mcp.NewTextContent(fmt.Sprintf("**%s** (%s)\n\n%s", label, description, markdownTable(*result.Table, "", ""))),
+			mcp.NewTextResourceContent("result:///"+file, string(data), GetMimeType(strings.TrimPrefix(filepath.Ext(file), "."))),
+		}, nil
+	case "list":
+		data, err := job.ReadFile(filepath.Base(result.File))
+		if err != nil {
+			return nil, err
+		}
+		return []*mcp.Content{
+			mcp.NewTextContent(fmt.Sprintf("**%s** (list)\n\n```json\n%s\n```", label, strings.TrimRight(string(data), "\n"))),
+		}, nil
+	default:
+		return []*mcp.Content{
+			mcp.NewTextContent(fmt.Sprintf("**%s** (%s)\n\n```\n%s\n```", label, result.Class, result.Text)),
+		}, nil
+	}
 }
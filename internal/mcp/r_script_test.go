@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleScriptResults = `[
+	{
+		"name": "", "type": "data_frame", "class": "data.frame", "rows": 32, "columns": 2, "file": "result.csv",
+		"table": {
+			"total_rows": 32,
+			"columns": [{"label": "rowname", "align": "left"}, {"label": "mpg", "align": "right"}],
+			"rows": [
+				{"group": "", "cells": ["Mazda RX4", "21.0"], "highlighted": [false, false]},
+				{"group": "", "cells": ["Datsun 710", "22.8"], "highlighted": [false, false]}
+			]
+		}
+	},
+	{
+		"name": "fit", "type": "model", "class": "lm", "rows": 2, "columns": 5, "file": "fit.csv",
+		"table": {
+			"total_rows": 2,
+			"columns": [{"label": "term", "align": "left"}, {"label": "estimate", "align": "right"}],
+			"rows": [
+				{"group": "", "cells": ["(Intercept)", "37.285"], "highlighted": [false, false]},
+				{"group": "", "cells": ["wt", "-5.344"], "highlighted": [false, false]}
+			]
+		}
+	},
+	{"name": "info", "type": "list", "class": "list", "file": "info.json"},
+	{"name": "x", "type": "text", "class": "factor", "text": "[1] a b\nLevels: a b"}
+]`
+
+// TestExecuteRScriptResults tests that the last value and the named results
+// are returned serialized by type
+func TestExecuteRScriptResults(t *testing.T) {
+	setupSession(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			jobDir := filepath.Dir(config.OutputPath)
+			code, err := os.ReadFile(filepath.Join(jobDir, "code.R"))
+			require.NoError(t, err)
+			assert.Equal(t, "fit <- lm(mpg ~ wt, mtcars)\nmtcars[, 'mpg', drop = FALSE]", string(code))
+
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), `for (name in c("fit", "info", "x"))`)
+			assert.Contains(t, string(script), "max_rows <- 2\n")
+			assert.Contains(t, string(script), "csv[] <- lapply(csv, function(x) if (is.list(x)) list_cells(x) else x)")
+			assert.Contains(t, string(script), "tryCatch(serialize_value(name, value, stem), error = function(e) NULL)")
+
+			for name, data := range map[string]string{
+				"results.json": sampleScriptResults,
+				"result.csv":   "\"rowname\",\"mpg\"\n\"Mazda RX4\",21\n",
+				"fit.csv":      "\"term\",\"estimate\"\n",
+				"info.json":    "{\n  \"n\": 32\n}\n",
+			} {
+				require.NoError(t, os.WriteFile(filepath.Join(jobDir, name), []byte(data), 0644))
+			}
+			return []byte("Output file path: " + config.OutputPath + "\nR script execution completed successfully!\n"), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := ExecuteRScriptTool(RScriptArgs{
+		Code:    "fit <- lm(mpg ~ wt, mtcars)\nmtcars[, 'mpg', drop = FALSE]",
+		Results: []string{"fit", "info", "x"},
+		MaxRows: 2,
+	})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 7)
+	assert.Contains(t, response.Content[0].TextContent.Text, "R script execution completed successfully!")
+
+	assert.Equal(t, "**Result** (data frame with 32 rows and 2 columns)\n\n"+
+		"| rowname | mpg |\n| :--- | ---: |\n| Mazda RX4 | 21.0 |\n| Datsun 710 | 22.8 |\n\n_Showing 2 of 32 rows_\n",
+		response.Content[1].TextContent.Text)
+	resource := response.Content[2].EmbeddedResource.TextResourceContents
+	assert.Equal(t, "result:///result.csv", resource.Uri)
+	assert.Equal(t, "text/csv", *resource.MimeType)
+	assert.Equal(t, "\"rowname\",\"mpg\"\n\"Mazda RX4\",21\n", resource.Text)
+
+	assert.Contains(t, response.Content[3].TextContent.Text, "**fit** (lm model coefficients)\n\n| term | estimate |")
+	assert.Equal(t, "result:///fit.csv", response.Content[4].EmbeddedResource.TextResourceContents.Uri)
+	assert.Equal(t, "**info** (list)\n\n```json\n{\n  \"n\": 32\n}\n```", response.Content[5].TextContent.Text)
+	assert.Equal(t, "**x** (factor)\n\n```\n[1] a b\nLevels: a b\n```", response.Content[6].TextContent.Text)
+
+	entries := session.snapshot()
+	require.Len(t, entries, 1)
+	assert.Len(t, entries[0].Outputs, 5)
+}
+
+// TestExecuteRScriptValidation tests the validation of the script arguments
+func TestExecuteRScriptValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     RScriptArgs
+		errorMsg string
+	}{
+		{"No code", RScriptArgs{}, "code is required"},
+		{"Bad result name", RScriptArgs{Code: "1", Results: []string{"x); system('ls'"}}, "invalid result name"},
+		{"Too many rows", RScriptArgs{Code: "1", MaxRows: 5000}, "max_rows must be between 1 and 1000"},
+		{"Bad data format", RScriptArgs{Code: "1", DataFormat: "xlsx"}, "data_format must be csv or json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := ExecuteRScriptTool(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package mcp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"gopkg.in/yaml.v3"
+)
+
+// rmdOutputExtensions are the rendered formats exposed as rmd-output resources
+var rmdOutputExtensions = map[string]bool{"html": true, "pdf": true, "docx": true}
+
+// workspaceResource describes a file of the R Markdown workspace exposed as an
+// MCP resource
+type workspaceResource struct {
+	URI         string
+	Name        string
+	Description string
+	MimeType    string
+	Path        string
+	ModTime     time.Time
+
+	// Read returns the content of a resource that is generated rather than
+	// read from Path
+	Read func() ([]byte, error)
+}
+
+// listRmdResources returns the R Markdown and Quarto sources in RmdDir and the
+// rendered outputs in its output directory, ordered by URI
+func listRmdResources() ([]workspaceResource, error) {
+	var resources []workspaceResource
+
+	sources, err := readDirFiles(RmdDir)
+	if err != nil {
+		return nil, err
+	}
+	for name, modTime := range sources {
+		ext := filepath.Ext(name)
+		if !strings.EqualFold(ext, ".Rmd") && !strings.EqualFold(ext, ".qmd") {
+			continue
+		}
+		path := filepath.Join(RmdDir, name)
+		title := name
+		if data, err := os.ReadFile(path); err == nil {
+			if t := rmdTitle(string(data)); t != "" {
+				title = t
+			}
+		}
+		resources = append(resources, workspaceResource{
+			URI:         "rmd:///" + name,
+			Name:        title,
+			Description: sourceDescription(ext) + title,
+			MimeType:    "text/markdown",
+			Path:        path,
+			ModTime:     modTime,
+		})
+	}
+
+	outputs, err := readDirFiles(rmdOutputDir())
+	if err != nil {
+		return nil, err
+	}
+	for name, modTime := range outputs {
+		ext := strings.TrimPrefix(filepath.Ext(name), ".")
+		if !rmdOutputExtensions[ext] {
+			continue
+		}
+		resources = append(resources, workspaceResource{
+			URI:         "rmd-output:///" + name,
+			Name:        "Rendered: " + name,
+			Description: "Rendered output: " + name,
+			MimeType:    GetMimeType(ext),
+			Path:        filepath.Join(rmdOutputDir(), name),
+			ModTime:     modTime,
+		})
+	}
+
+	sort.Slice(resources, func(i, j int) bool { return resources[i].URI < resources[j].URI })
+	return resources, nil
+}
+
+// sourceDescription returns the description prefix of a source document
+func sourceDescription(ext string) string {
+	if strings.EqualFold(ext, ".qmd") {
+		return "Quarto document: "
+	}
+	return "R Markdown file: "
+}
+
+// readDirFiles returns the modification times of the regular files in a
+// directory by name, or nothing when the directory does not exist yet
+func readDirFiles(dir string) (map[string]time.Time, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+
+	files := make(map[string]time.Time)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files[entry.Name()] = info.ModTime()
+	}
+	return files, nil
+}
+
+// rmdTitle returns the title from the YAML front matter of an R Markdown
+// document, or an empty string if there is none
+func rmdTitle(content string) string {
+	block, ok := frontMatterBlock(content)
+	if !ok {
+		return ""
+	}
+
+	var frontMatter struct {
+		Title any `yaml:"title"`
+	}
+	if err := yaml.Unmarshal([]byte(block), &frontMatter); err != nil {
+		return ""
+	}
+	if title, ok := frontMatter.Title.(string); ok {
+		return strings.TrimSpace(title)
+	}
+	return ""
+}
+
+// handler returns a function that reads a workspace file when the client
+// requests it
+func (r workspaceResource) handler() func() (*mcp.ResourceResponse, error) {
+	return func() (*mcp.ResourceResponse, error) {
+		if r.Read != nil {
+			data, err := r.Read()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read resource %s: %w", r.URI, err)
+			}
+			return mcp.NewResourceResponse(mcp.NewTextEmbeddedResource(r.URI, string(data), r.MimeType)), nil
+		}
+
+		data, err := os.ReadFile(r.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read resource %s: %w", r.URI, err)
+		}
+		if strings.HasPrefix(r.MimeType, "text/") {
+			return mcp.NewResourceResponse(mcp.NewTextEmbeddedResource(r.URI, string(data), r.MimeType)), nil
+		}
+		return mcp.NewResourceResponse(mcp.NewBlobEmbeddedResource(r.URI, EncodeImageToBase64(data), r.MimeType)), nil
+	}
+}
+
+// syncResources registers the workspace files that are new or were modified
+// and deregisters the ones that were removed; each change notifies running
+// clients that the resource list changed
+func (s *MCPServer) syncResources() error {
+	s.resourcesMu.Lock()
+	defer s.resourcesMu.Unlock()
+
+	resources, err := listRmdResources()
+	if err != nil {
+		return err
+	}
+	bundles, err := listBundleResources()
+	if err != nil {
+		return err
+	}
+	resources = append(resources, bundles...)
+	datasets, err := listDatasetResources()
+	if err != nil {
+		return err
+	}
+	resources = append(resources, datasets...)
+
+	current := make(map[string]workspaceResource, len(resources))
+	for _, r := range resources {
+		current[r.URI] = r
+		if registered, ok := s.resources[r.URI]; ok && registered.Name == r.Name && registered.ModTime.Equal(r.ModTime) {
+			continue
+		}
+		if err := s.RegisterResource(r.URI, r.Name, r.Description, r.MimeType, r.handler()); err != nil {
+			return fmt.Errorf("failed to register resource %s: %w", r.URI, err)
+		}
+	}
+
+	for uri := range s.resources {
+		if _, ok := current[uri]; ok {
+			continue
+		}
+		if err := s.DeregisterResource(uri); err != nil {
+			return fmt.Errorf("failed to deregister resource %s: %w", uri, err)
+		}
+	}
+
+	s.resources = current
+	return nil
+}
+
+// syncing wraps a tool handler that changes the workspace so the resource list
+// is refreshed after every successful call
+func syncing[T any](s *MCPServer, handler func(T) (*mcp.ToolResponse, error)) func(T) (*mcp.ToolResponse, error) {
+	return func(args T) (*mcp.ToolResponse, error) {
+		response, err := handler(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.syncResources(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating resources: %v\n", err)
+		}
+		return response, nil
+	}
+}
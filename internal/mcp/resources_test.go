@@ -0,0 +1,89 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRmdTitle tests the title extraction from the front matter
+func TestRmdTitle(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"Plain title", "---\ntitle: Sales Report\noutput: html_document\n---\n\nBody", "Sales Report"},
+		{"Quoted title", "---\ntitle: \"Q1: Sales\"\n---\n", "Q1: Sales"},
+		{"CRLF", "---\r\ntitle: Windows\r\n---\r\n", "Windows"},
+		{"No front matter", "# Heading\n\ntitle: no", ""},
+		{"Unterminated", "---\ntitle: Open\n", ""},
+		{"Non-string title", "---\ntitle:\n  - a\n---\n", ""},
+		{"Invalid YAML", "---\ntitle: [\n---\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rmdTitle(tt.content))
+		})
+	}
+}
+
+// TestSyncResources tests that workspace files are registered, updated and removed
+func TestSyncResources(t *testing.T) {
+	dir := setupRmdDir(t)
+	server := &MCPServer{Server: mcp.NewServer(nil)}
+
+	// An empty or missing workspace registers nothing
+	require.NoError(t, server.syncResources())
+	assert.Empty(t, server.resources)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "output"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "report.Rmd"), []byte("---\ntitle: Report\n---\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "output", "report.pdf"), []byte("%PDF"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "output", "report.log"), []byte("ignored"), 0644))
+
+	require.NoError(t, server.syncResources())
+	require.Len(t, server.resources, 2)
+	assert.True(t, server.CheckResourceRegistered("rmd:///report.Rmd"))
+	assert.True(t, server.CheckResourceRegistered("rmd-output:///report.pdf"))
+
+	source := server.resources["rmd:///report.Rmd"]
+	assert.Equal(t, "Report", source.Name)
+	assert.Equal(t, "R Markdown file: Report", source.Description)
+	assert.Equal(t, "text/markdown", source.MimeType)
+	output := server.resources["rmd-output:///report.pdf"]
+	assert.Equal(t, "Rendered: report.pdf", output.Name)
+	assert.Equal(t, "application/pdf", output.MimeType)
+
+	// Removed files are deregistered
+	require.NoError(t, os.Remove(filepath.Join(dir, "output", "report.pdf")))
+	require.NoError(t, server.syncResources())
+	assert.False(t, server.CheckResourceRegistered("rmd-output:///report.pdf"))
+	assert.Len(t, server.resources, 1)
+}
+
+// TestWorkspaceResourceHandler tests that text and binary files are read on demand
+func TestWorkspaceResourceHandler(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.html")
+	require.NoError(t, os.WriteFile(path, []byte("<p>hi</p>"), 0644))
+
+	response, err := workspaceResource{URI: "rmd-output:///report.html", MimeType: "text/html", Path: path}.handler()()
+	require.NoError(t, err)
+	require.Len(t, response.Contents, 1)
+	assert.Equal(t, "<p>hi</p>", response.Contents[0].TextResourceContents.Text)
+
+	require.NoError(t, os.WriteFile(path, []byte("PK"), 0644))
+	response, err = workspaceResource{URI: "rmd-output:///report.docx", MimeType: GetMimeType("docx"), Path: path}.handler()()
+	require.NoError(t, err)
+	assert.Equal(t, "UEs=", response.Contents[0].BlobResourceContents.Blob)
+
+	_, err = workspaceResource{URI: "rmd:///missing.Rmd", Path: filepath.Join(dir, "missing.Rmd")}.handler()()
+	assert.Error(t, err)
+}
@@ -0,0 +1,237 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// RmdDir is the directory holding R Markdown sources; rendered outputs are
+// written to its output subdirectory
+var RmdDir = "rmd"
+
+// rmdOutputDir returns the directory holding rendered R Markdown outputs
+func rmdOutputDir() string {
+	return filepath.Join(RmdDir, "output")
+}
+
+// rmdFormats maps the render_rmd formats to rmarkdown output formats and
+// file extensions
+var rmdFormats = map[string]struct {
+	OutputFormat string
+	Extension    string
+}{
+	"html": {"html_document", "html"},
+	"pdf":  {"pdf_document", "pdf"},
+	"word": {"word_document", "docx"},
+}
+
+var rmdFilenamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// CreateRmdArgs represents the arguments for creating an R Markdown file
+type CreateRmdArgs struct {
+	Filename string `json:"filename" jsonschema:"required,description=Filename for the R Markdown file (without extension)"`
+	Title    string `json:"title" jsonschema:"required,description=Title for the R Markdown document"`
+	Content  string `json:"content" jsonschema:"required,description=Content of the R Markdown file"`
+
+	BundleOption
+}
+
+// RenderRmdArgs represents the arguments for rendering an R Markdown file
+type RenderRmdArgs struct {
+	Filename string `json:"filename" jsonschema:"required,description=Filename of the R Markdown file to render"`
+	Format   string `json:"format" jsonschema:"description=Output format (html, pdf, word)"`
+
+	BundleOption
+}
+
+// CreateRmd writes an R Markdown file to RmdDir, adding YAML front matter with
+// the given title when the content has none
+func CreateRmd(args CreateRmdArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	name, err := sanitizeRmdFilename(args.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if args.Content == "" {
+		return nil, fmt.Errorf("content is required")
+	}
+
+	content := args.Content
+	if !hasFrontMatter(content) {
+		content = fmt.Sprintf("---\ntitle: %s\noutput: html_document\n---\n\n%s", strconv.Quote(args.Title), content)
+	}
+
+	if err := os.MkdirAll(RmdDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create rmd directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(RmdDir, name+".Rmd"), []byte(content), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write R Markdown file: %w", err)
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(fmt.Sprintf("Created R Markdown file: %s.Rmd", name))), nil
+}
+
+// RenderRmd renders an R Markdown file from RmdDir with rmarkdown::render,
+// saves the result to the output directory and returns it as an embedded
+// resource
+func RenderRmd(args RenderRmdArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	name, err := sanitizeRmdFilename(args.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	format := args.Format
+	if format == "" {
+		format = "html"
+	}
+	rmdFormat, ok := rmdFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("format must be html, pdf or word")
+	}
+
+	inputPath, err := filepath.Abs(filepath.Join(RmdDir, name+".Rmd"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve R Markdown file: %w", err)
+	}
+	if _, err := os.Stat(inputPath); err != nil {
+		return nil, fmt.Errorf("R Markdown file not found: %s.Rmd", name)
+	}
+
+	return renderRmdFile(inputPath, name+".Rmd", name, rmdFormat.OutputFormat, rmdFormat.Extension, nil)
+}
+
+// renderRmdFile renders an R Markdown file with the given params, saves the
+// result as outputName in the output directory and returns it as an embedded
+// resource. sourceName is the name of the source reported to the client.
+func renderRmdFile(inputPath, sourceName, outputName, outputFormat, extension string, params map[string]any) (*mcp.ToolResponse, error) {
+	job, err := newRJob("rmd-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	paramsCode := "NULL"
+	if len(params) > 0 {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode params: %w", err)
+		}
+		paramsPath, err := job.WriteFile("params.json", data)
+		if err != nil {
+			return nil, err
+		}
+		paramsCode = fmt.Sprintf("jsonlite::read_json(%s, simplifyVector = TRUE)", rQuote(paramsPath))
+	}
+
+	renderedName := "output." + extension
+
+	// Render in the job directory so intermediates and files written by
+	// chunks do not end up next to the sources
+	scriptContent := fmt.Sprintf(`
+rmarkdown::render(
+  %s,
+  output_format = %s,
+  output_file = %s,
+  output_dir = %s,
+  intermediates_dir = %s,
+  knit_root_dir = %s,
+  params = %s,
+  envir = new.env(),
+  quiet = TRUE
+)
+`, rQuote(inputPath), rQuote(outputFormat), rQuote(renderedName),
+		rQuote(job.Dir), rQuote(job.Dir), rQuote(job.Dir), paramsCode)
+
+	outputData, err := job.Run(scriptContent, renderedName, RExecutionConfig{
+		OutputFormat: extension,
+		Inputs:       []string{inputPath},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the rendered document next to the other outputs
+	outputFile := outputName + "." + extension
+	if err := saveRenderedOutput(outputFile, outputData); err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResponse(
+		mcp.NewTextContent(fmt.Sprintf("Successfully rendered %s to %s", sourceName, outputFile)),
+		documentResourceContent("rmd-output:///"+outputFile, outputData, extension),
+	), nil
+}
+
+// saveRenderedOutput writes a rendered document to the output directory
+func saveRenderedOutput(outputFile string, data []byte) error {
+	if err := os.MkdirAll(rmdOutputDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(rmdOutputDir(), outputFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write rendered output: %w", err)
+	}
+	return nil
+}
+
+// documentResourceContent returns a rendered document as an embedded
+// resource, as text for HTML and as a base64 blob otherwise
+func documentResourceContent(uri string, data []byte, extension string) *mcp.Content {
+	if extension == "html" {
+		return mcp.NewTextResourceContent(uri, string(data), GetMimeType(extension))
+	}
+	return mcp.NewBlobResourceContent(uri, EncodeImageToBase64(data), GetMimeType(extension))
+}
+
+// sanitizeRmdFilename strips the .Rmd extension from a filename and rejects
+// names that could escape RmdDir
+func sanitizeRmdFilename(filename string) (string, error) {
+	return sanitizeWorkspaceFilename(filename, ".Rmd")
+}
+
+// sanitizeWorkspaceFilename strips the given extension from a filename and
+// rejects names that could escape RmdDir
+func sanitizeWorkspaceFilename(filename string, extension string) (string, error) {
+	if filename == "" {
+		return "", fmt.Errorf("filename is required")
+	}
+
+	name := filename
+	if ext := filepath.Ext(name); strings.EqualFold(ext, extension) {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if !rmdFilenamePattern.MatchString(name) || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid filename: %q (use letters, digits, '.', '_' and '-' only)", filename)
+	}
+	return name, nil
+}
+
+// hasFrontMatter reports whether an R Markdown document starts with a YAML
+// front matter block
+func hasFrontMatter(content string) bool {
+	content = strings.TrimLeft(content, "\ufeff \t\r\n")
+	return strings.HasPrefix(content, "---\n") || strings.HasPrefix(content, "---\r\n")
+}
+
+// frontMatterBlock returns the YAML between the front matter delimiters of a
+// document
+func frontMatterBlock(content string) (string, bool) {
+	if !hasFrontMatter(content) {
+		return "", false
+	}
+
+	content = strings.ReplaceAll(strings.TrimLeft(content, "\ufeff \t\r\n"), "\r\n", "\n")
+	body := strings.TrimPrefix(content, "---\n")
+	end := strings.Index(body, "\n---")
+	if end < 0 {
+		return "", false
+	}
+	return body[:end], true
+}
@@ -0,0 +1,95 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupRmdDir points RmdDir at a temporary directory for the test
+func setupRmdDir(t *testing.T) string {
+	original := RmdDir
+	RmdDir = t.TempDir()
+	t.Cleanup(func() { RmdDir = original })
+	return RmdDir
+}
+
+// TestCreateRmd tests that front matter is added only when missing
+func TestCreateRmd(t *testing.T) {
+	dir := setupRmdDir(t)
+
+	response, err := CreateRmd(CreateRmdArgs{Filename: "example", Title: `Sales "Q1"`, Content: "Body"})
+	require.NoError(t, err)
+	assert.Equal(t, "Created R Markdown file: example.Rmd", response.Content[0].TextContent.Text)
+	data, err := os.ReadFile(filepath.Join(dir, "example.Rmd"))
+	require.NoError(t, err)
+	assert.Equal(t, "---\ntitle: \"Sales \\\"Q1\\\"\"\noutput: html_document\n---\n\nBody", string(data))
+
+	content := "---\ntitle: Own\n---\n\nBody"
+	_, err = CreateRmd(CreateRmdArgs{Filename: "own.Rmd", Title: "Ignored", Content: content})
+	require.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(dir, "own.Rmd"))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+// TestSanitizeRmdFilename tests that filenames cannot escape the rmd directory
+func TestSanitizeRmdFilename(t *testing.T) {
+	valid := map[string]string{"report": "report", "report.Rmd": "report", "q1_2024-v2.rmd": "q1_2024-v2"}
+	for input, expected := range valid {
+		name, err := sanitizeRmdFilename(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, name)
+	}
+
+	for _, input := range []string{"", "../secret", "a/b", `a\b`, "/etc/passwd", ".hidden", "a..b", "name with space"} {
+		_, err := sanitizeRmdFilename(input)
+		assert.Error(t, err, input)
+	}
+}
+
+// TestRenderRmd tests that the rendered document is saved and embedded
+func TestRenderRmd(t *testing.T) {
+	dir := setupRmdDir(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.Rmd"), []byte("# Hi"), 0644))
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), `output_format = "word_document"`)
+			assert.Contains(t, string(script), filepath.Join(dir, "example.Rmd"))
+			assert.Equal(t, []string{filepath.Join(dir, "example.Rmd")}, config.Inputs)
+			return []byte("mock-docx"), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := RenderRmd(RenderRmdArgs{Filename: "example", Format: "word"})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 2)
+	assert.Equal(t, "Successfully rendered example.Rmd to example.docx", response.Content[0].TextContent.Text)
+	assert.Equal(t, "rmd-output:///example.docx", response.Content[1].EmbeddedResource.BlobResourceContents.Uri)
+
+	data, err := os.ReadFile(filepath.Join(dir, "output", "example.docx"))
+	require.NoError(t, err)
+	assert.Equal(t, "mock-docx", string(data))
+}
+
+// TestRenderRmdValidation tests the validation of the render arguments
+func TestRenderRmdValidation(t *testing.T) {
+	setupRmdDir(t)
+
+	_, err := RenderRmd(RenderRmdArgs{Filename: "missing"})
+	assert.EqualError(t, err, "R Markdown file not found: missing.Rmd")
+
+	_, err = RenderRmd(RenderRmdArgs{Filename: "example", Format: "odt"})
+	assert.EqualError(t, err, "format must be html, pdf or word")
+
+	_, err = RenderRmd(RenderRmdArgs{Filename: "../example"})
+	assert.Error(t, err)
+}
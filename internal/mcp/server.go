@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sync"
 
 	mcp "github.com/metoro-io/mcp-golang"
 	"github.com/metoro-io/mcp-golang/transport"
@@ -12,6 +13,13 @@ import (
 // MCPServer represents the MCP server for ggplot
 type MCPServer struct {
 	*mcp.Server
+
+	// resources holds the registered workspace resources by URI
+	resources   map[string]workspaceResource
+	resourcesMu sync.Mutex
+
+	// bundleMu makes bundled tool calls, which swap the executor, run alone
+	bundleMu sync.RWMutex
 }
 
 // NewMCPServer creates a new MCP server with the given transport
@@ -22,15 +30,145 @@ func NewMCPServer(transport transport.Transport) (*MCPServer, error) {
 	}
 
 	// Register the render_ggplot tool
-	if err := server.RegisterTool("render_ggplot", "Render a ggplot2 visualization", RenderGGPlot); err != nil {
+	if err := server.RegisterTool("render_ggplot", "Render a ggplot2 visualization", bundling(server, "render_ggplot", RenderGGPlot)); err != nil {
 		return nil, fmt.Errorf("failed to register render_ggplot tool: %w", err)
 	}
 
 	// Register the execute_r_script tool
-	if err := server.RegisterTool("execute_r_script", "Execute an R script and return the result", ExecuteRScriptTool); err != nil {
+	if err := server.RegisterTool("execute_r_script", "Execute an R script and return the result", bundling(server, "execute_r_script", ExecuteRScriptTool)); err != nil {
 		return nil, fmt.Errorf("failed to register execute_r_script tool: %w", err)
 	}
 
+	// Register the upload_data tool
+	if err := server.RegisterTool("upload_data", "Upload CSV, TSV, JSON, Parquet, Feather, Arrow IPC or Excel data as a named data frame for later execute_r_script and render_ggplot calls", bundling(server, "upload_data", syncing(server, UploadData))); err != nil {
+		return nil, fmt.Errorf("failed to register upload_data tool: %w", err)
+	}
+
+	// Register the list_datasets tool
+	if err := server.RegisterTool("list_datasets", "List the catalog and uploaded datasets that R code can use by name", bundling(server, "list_datasets", ListDatasets)); err != nil {
+		return nil, fmt.Errorf("failed to register list_datasets tool: %w", err)
+	}
+
+	// Register the describe_dataset tool
+	if err := server.RegisterTool("describe_dataset", "Describe a dataset with its documentation and the type and missing values of each column", bundling(server, "describe_dataset", DescribeDataset)); err != nil {
+		return nil, fmt.Errorf("failed to register describe_dataset tool: %w", err)
+	}
+
+	// Register the profile_data tool
+	if err := server.RegisterTool("profile_data", "Profile a dataset with the type and missing values and range and distribution of each column as JSON", bundling(server, "profile_data", ProfileData)); err != nil {
+		return nil, fmt.Errorf("failed to register profile_data tool: %w", err)
+	}
+
+	// Register the query_database tool
+	if err := server.RegisterTool("query_database", "Run a read-only SQL query on a configured SQLite or DuckDB database and optionally store the result as a dataset", bundling(server, "query_database", syncing(server, QueryDatabase))); err != nil {
+		return nil, fmt.Errorf("failed to register query_database tool: %w", err)
+	}
+
+	// Register the fit_model tool
+	if err := server.RegisterTool("fit_model", "Fit an lm, glm, loess or gam model to a dataset and return tidy coefficients, fit statistics and ANOVA tables as JSON", bundling(server, "fit_model", FitModel)); err != nil {
+		return nil, fmt.Errorf("failed to register fit_model tool: %w", err)
+	}
+
+	// Register the hypothesis_test tool
+	if err := server.RegisterTool("hypothesis_test", "Run a t, Wilcoxon, chi-squared, correlation or proportion test on dataset columns and return a standard JSON result with an interpretation", bundling(server, "hypothesis_test", HypothesisTest)); err != nil {
+		return nil, fmt.Errorf("failed to register hypothesis_test tool: %w", err)
+	}
+
+	// Register the forecast tool
+	if err := server.RegisterTool("forecast", "Forecast a time series with ETS, ARIMA or naive methods and return prediction intervals, holdout accuracy and a chart", bundling(server, "forecast", Forecast)); err != nil {
+		return nil, fmt.Errorf("failed to register forecast tool: %w", err)
+	}
+
+	// Register the transform_data tool
+	if err := server.RegisterTool("transform_data", "Apply declarative filter, select, mutate, summarise, arrange, join and pivot steps to a dataset and store the result as a new dataset", bundling(server, "transform_data", syncing(server, TransformData))); err != nil {
+		return nil, fmt.Errorf("failed to register transform_data tool: %w", err)
+	}
+
+	// Register the compare_datasets tool
+	if err := server.RegisterTool("compare_datasets", "Compare two versions of a dataset by key columns and report schema changes, added and removed rows and changed cells as JSON with a markdown summary", bundling(server, "compare_datasets", CompareDatasets)); err != nil {
+		return nil, fmt.Errorf("failed to register compare_datasets tool: %w", err)
+	}
+
+	// Register the evaluate_r_json tool
+	if err := server.RegisterTool("evaluate_r_json", "Evaluate R code and return its value as JSON with a documented R to JSON mapping", bundling(server, "evaluate_r_json", EvaluateRJSON)); err != nil {
+		return nil, fmt.Errorf("failed to register evaluate_r_json tool: %w", err)
+	}
+
+	// Register the execute_r_notebook tool
+	if err := server.RegisterTool("execute_r_notebook", "Execute R code chunk by chunk and return the source, output, warnings and figures in order", bundling(server, "execute_r_notebook", ExecuteRNotebook)); err != nil {
+		return nil, fmt.Errorf("failed to register execute_r_notebook tool: %w", err)
+	}
+
+	// Register the export_session tool
+	if err := server.RegisterTool("export_session", "Export the R code executed in this session as an R script, R Markdown document or Jupyter notebook", bundling(server, "export_session", syncing(server, ExportSession))); err != nil {
+		return nil, fmt.Errorf("failed to register export_session tool: %w", err)
+	}
+
+	// Register the render_diagram tool
+	if err := server.RegisterTool("render_diagram", "Render a Graphviz, mermaid or igraph edge-list diagram", bundling(server, "render_diagram", RenderDiagram)); err != nil {
+		return nil, fmt.Errorf("failed to register render_diagram tool: %w", err)
+	}
+
+	// Register the analyze_network tool
+	if err := server.RegisterTool("analyze_network", "Compute centrality, components and communities of a network and plot it", bundling(server, "analyze_network", AnalyzeNetwork)); err != nil {
+		return nil, fmt.Errorf("failed to register analyze_network tool: %w", err)
+	}
+
+	// Register the run_simulation tool
+	if err := server.RegisterTool("run_simulation", "Run a Monte Carlo simulation from distribution specs and a formula", bundling(server, "run_simulation", RunSimulation)); err != nil {
+		return nil, fmt.Errorf("failed to register run_simulation tool: %w", err)
+	}
+
+	// Register the render_table tool
+	if err := server.RegisterTool("render_table", "Render a data frame or JSON records as a formatted table in markdown, HTML or PNG", bundling(server, "render_table", RenderTable)); err != nil {
+		return nil, fmt.Errorf("failed to register render_table tool: %w", err)
+	}
+
+	// Register the list_fonts tool
+	if err := server.RegisterTool("list_fonts", "List the font families available for plot rendering", bundling(server, "list_fonts", ListFonts)); err != nil {
+		return nil, fmt.Errorf("failed to register list_fonts tool: %w", err)
+	}
+
+	// Register the create_rmd tool
+	if err := server.RegisterTool("create_rmd", "Create an R Markdown file", bundling(server, "create_rmd", syncing(server, CreateRmd))); err != nil {
+		return nil, fmt.Errorf("failed to register create_rmd tool: %w", err)
+	}
+
+	// Register the render_rmd tool
+	if err := server.RegisterTool("render_rmd", "Render an R Markdown file to HTML, PDF or Word", bundling(server, "render_rmd", syncing(server, RenderRmd))); err != nil {
+		return nil, fmt.Errorf("failed to register render_rmd tool: %w", err)
+	}
+
+	// Register the render_quarto tool
+	if err := server.RegisterTool("render_quarto", "Render a Quarto document to HTML, PDF, Word or reveal.js slides", bundling(server, "render_quarto", syncing(server, RenderQuarto))); err != nil {
+		return nil, fmt.Errorf("failed to register render_quarto tool: %w", err)
+	}
+
+	// Register the list_report_templates tool
+	if err := server.RegisterTool("list_report_templates", "List the report templates and the parameters they accept", bundling(server, "list_report_templates", ListReportTemplates)); err != nil {
+		return nil, fmt.Errorf("failed to register list_report_templates tool: %w", err)
+	}
+
+	// Register the generate_report tool
+	if err := server.RegisterTool("generate_report", "Render a report template with the given parameters", bundling(server, "generate_report", syncing(server, GenerateReport))); err != nil {
+		return nil, fmt.Errorf("failed to register generate_report tool: %w", err)
+	}
+
+	// Register the schema of the evaluate_r_json result
+	if err := server.RegisterResource(rJSONSchemaURI, "evaluate_r_json result schema", "JSON Schema of the evaluate_r_json result", "application/schema+json", rJSONSchemaResource); err != nil {
+		return nil, fmt.Errorf("failed to register evaluate_r_json schema resource: %w", err)
+	}
+
+	// Register the schema of the hypothesis_test result
+	if err := server.RegisterResource(testResultSchemaURI, "hypothesis_test result schema", "JSON Schema of the hypothesis_test result", "application/schema+json", testResultSchemaResource); err != nil {
+		return nil, fmt.Errorf("failed to register hypothesis_test schema resource: %w", err)
+	}
+
+	// Register the R Markdown workspace, bundle and dataset resources
+	if err := server.syncResources(); err != nil {
+		return nil, fmt.Errorf("failed to register resources: %w", err)
+	}
+
 	return server, nil
 }
 
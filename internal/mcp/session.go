@@ -0,0 +1,359 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// maxSessionEntries bounds the session history; the oldest snippets are
+// dropped first
+const maxSessionEntries = 500
+
+// sessionEntry is a snippet of R code executed by a tool and what it produced
+type sessionEntry struct {
+	Tool    string
+	Code    string
+	Time    time.Time
+	Outputs []sessionOutput
+}
+
+// sessionOutput is a single output of a snippet. Type is stdout, stderr,
+// image or error; Data holds base64 encoded images.
+type sessionOutput struct {
+	Type     string
+	Text     string
+	Data     string
+	MimeType string
+}
+
+// sessionHistory records the snippets executed since the server started
+type sessionHistory struct {
+	mu      sync.Mutex
+	entries []sessionEntry
+}
+
+// session is the history of the running server
+var session = &sessionHistory{}
+
+// record appends a snippet to the history
+func (h *sessionHistory) record(tool string, code string, outputs []sessionOutput) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = append(h.entries, sessionEntry{Tool: tool, Code: code, Time: time.Now(), Outputs: outputs})
+	if len(h.entries) > maxSessionEntries {
+		h.entries = h.entries[len(h.entries)-maxSessionEntries:]
+	}
+}
+
+// snapshot returns a copy of the recorded snippets
+func (h *sessionHistory) snapshot() []sessionEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]sessionEntry(nil), h.entries...)
+}
+
+// clear removes all recorded snippets
+func (h *sessionHistory) clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = nil
+}
+
+// contentOutputs converts the content of a tool response to session outputs
+func contentOutputs(content []*mcp.Content) []sessionOutput {
+	var outputs []sessionOutput
+	for _, c := range content {
+		switch {
+		case c.TextContent != nil:
+			outputs = append(outputs, sessionOutput{Type: "stdout", Text: c.TextContent.Text})
+		case c.ImageContent != nil:
+			outputs = append(outputs, sessionOutput{Type: "image", Data: c.ImageContent.Data, MimeType: c.ImageContent.MimeType})
+		}
+	}
+	return outputs
+}
+
+// errorOutputs returns the session outputs of a snippet that failed
+func errorOutputs(err error) []sessionOutput {
+	return []sessionOutput{{Type: "error", Text: err.Error()}}
+}
+
+// sessionFormats maps the export_session formats to file extensions and MIME
+// types
+var sessionFormats = map[string]struct {
+	Extension string
+	MimeType  string
+}{
+	"r":     {"R", "text/x-r"},
+	"rmd":   {"Rmd", "text/markdown"},
+	"ipynb": {"ipynb", "application/x-ipynb+json"},
+}
+
+// ExportSessionArgs represents the arguments for exporting the session history
+type ExportSessionArgs struct {
+	Format   string `json:"format" jsonschema:"description=Export format (r, rmd, ipynb)"`
+	Title    string `json:"title" jsonschema:"description=Title of the exported document"`
+	Filename string `json:"filename" jsonschema:"description=Also save the export in the rmd directory under this name (without extension)"`
+	Clear    bool   `json:"clear" jsonschema:"description=Clear the history after exporting it"`
+
+	BundleOption
+}
+
+// ExportSession returns the snippets executed in this session as an R script,
+// an R Markdown document or a Jupyter notebook for the IR kernel
+func ExportSession(args ExportSessionArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	format := strings.ToLower(args.Format)
+	if format == "" {
+		format = "r"
+	}
+	sessionFormat, ok := sessionFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("format must be r, rmd or ipynb")
+	}
+
+	name := "session"
+	if args.Filename != "" {
+		var err error
+		if name, err = sanitizeWorkspaceFilename(args.Filename, "."+sessionFormat.Extension); err != nil {
+			return nil, err
+		}
+	}
+
+	title := args.Title
+	if title == "" {
+		title = "R session"
+	}
+
+	entries := session.snapshot()
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no R code has been executed in this session yet")
+	}
+
+	setup, err := sessionSetupCode(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	var export string
+	switch format {
+	case "r":
+		export = exportSessionScript(entries, title, setup)
+	case "rmd":
+		export = exportSessionRmd(entries, title, setup)
+	case "ipynb":
+		if export, err = exportSessionNotebook(entries, title, setup); err != nil {
+			return nil, err
+		}
+	}
+
+	file := name + "." + sessionFormat.Extension
+	message := fmt.Sprintf("Exported %d snippets as %s", len(entries), file)
+	if args.Filename != "" {
+		if err := os.MkdirAll(RmdDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create rmd directory: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(RmdDir, file), []byte(export), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write export: %w", err)
+		}
+		message += fmt.Sprintf(" and saved it to the %s directory", RmdDir)
+	}
+	if args.Clear {
+		session.clear()
+	}
+
+	return mcp.NewToolResponse(
+		mcp.NewTextContent(message),
+		mcp.NewTextResourceContent("session:///"+file, export, sessionFormat.MimeType),
+	), nil
+}
+
+// exportSessionScript formats the history, after the setup code, as an R
+// script with the text outputs as #> comments
+func exportSessionScript(entries []sessionEntry, title string, setup string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n# Exported %s\n", title, time.Now().Format(time.RFC3339))
+	if setup != "" {
+		fmt.Fprintf(&b, "\n%s\n", setup)
+	}
+	for i, entry := range entries {
+		fmt.Fprintf(&b, "\n# ---- [%d] %s (%s) ----\n", i+1, entry.Tool, entry.Time.Format(time.RFC3339))
+		b.WriteString(strings.TrimRight(entry.Code, "\n"))
+		b.WriteString("\n")
+		for _, output := range entry.Outputs {
+			switch output.Type {
+			case "image":
+				fmt.Fprintf(&b, "#> [%s figure]\n", output.MimeType)
+			case "error":
+				writeCommented(&b, "Error: "+output.Text)
+			default:
+				writeCommented(&b, output.Text)
+			}
+		}
+	}
+	return b.String()
+}
+
+// sessionSetupCode returns the code that the tools ran before the recorded
+// snippets and that the export needs to reproduce them: the plotting packages
+// of render_ggplot and the bindings of the datasets the snippets use by name
+func sessionSetupCode(entries []sessionEntry) (string, error) {
+	var parts []string
+	codes := make([]string, len(entries))
+	for i, entry := range entries {
+		codes[i] = entry.Code
+		if entry.Tool == "render_ggplot" && len(parts) == 0 {
+			parts = append(parts, "library(ggplot2)\nlibrary(cowplot)")
+		}
+	}
+
+	datasets, err := mentionedDatasets(strings.Join(codes, "\n"))
+	if err != nil {
+		return "", err
+	}
+	if bindings := datasetBindings(datasets); bindings != "" {
+		parts = append(parts, strings.TrimRight(bindings, "\n"))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// writeCommented writes text as #> comment lines
+func writeCommented(b *strings.Builder, text string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		b.WriteString(strings.TrimRight("#> "+line, " "))
+		b.WriteString("\n")
+	}
+}
+
+// exportSessionRmd formats the history as an R Markdown document with a setup
+// chunk and one chunk per snippet. The outputs are left out as they are recreated when the
+// document is rendered; snippets that failed get error = TRUE so the document
+// still renders.
+func exportSessionRmd(entries []sessionEntry, title string, setup string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "---\ntitle: %s\noutput: html_document\n---\n", rQuote(title))
+	if setup != "" {
+		fmt.Fprintf(&b, "\n```{r setup, include = FALSE}\n%s\n```\n", setup)
+	}
+	for i, entry := range entries {
+		options := ""
+		for _, output := range entry.Outputs {
+			if output.Type == "error" {
+				options = ", error = TRUE"
+				break
+			}
+		}
+		fmt.Fprintf(&b, "\n```{r snippet-%d%s}\n%s\n```\n", i+1, options, strings.TrimRight(entry.Code, "\n"))
+	}
+	return b.String()
+}
+
+// notebookOutputData returns the data of a recorded figure as nbformat stores
+// it: base64 for binary images and the decoded text for SVG and other text
+// MIME types
+func notebookOutputData(output sessionOutput) any {
+	binary := strings.HasPrefix(output.MimeType, "image/") && output.MimeType != "image/svg+xml"
+	if binary {
+		return output.Data
+	}
+	text, err := base64.StdEncoding.DecodeString(output.Data)
+	if err != nil {
+		return output.Data
+	}
+	return notebookLines(string(text))
+}
+
+// exportSessionNotebook formats the history as a Jupyter notebook for the IR
+// kernel with a setup cell and the recorded outputs
+func exportSessionNotebook(entries []sessionEntry, title string, setup string) (string, error) {
+	cells := []map[string]any{{
+		"cell_type": "markdown",
+		"metadata":  map[string]any{},
+		"source":    notebookLines("# " + title),
+	}}
+	if setup != "" {
+		cells = append(cells, map[string]any{
+			"cell_type":       "code",
+			"execution_count": nil,
+			"metadata":        map[string]any{},
+			"source":          notebookLines(setup),
+			"outputs":         []any{},
+		})
+	}
+	for i, entry := range entries {
+		outputs := []map[string]any{}
+		for _, output := range entry.Outputs {
+			switch output.Type {
+			case "image":
+				outputs = append(outputs, map[string]any{
+					"output_type": "display_data",
+					"data":        map[string]any{output.MimeType: notebookOutputData(output), "text/plain": notebookLines("plot without title")},
+					"metadata":    map[string]any{},
+				})
+			case "error":
+				outputs = append(outputs, map[string]any{
+					"output_type": "error",
+					"ename":       "Error",
+					"evalue":      output.Text,
+					"traceback":   []string{output.Text},
+				})
+			default:
+				outputs = append(outputs, map[string]any{
+					"output_type": "stream",
+					"name":        output.Type,
+					"text":        notebookLines(output.Text),
+				})
+			}
+		}
+		cells = append(cells, map[string]any{
+			"cell_type":       "code",
+			"execution_count": i + 1,
+			"metadata":        map[string]any{},
+			"source":          notebookLines(strings.TrimRight(entry.Code, "\n")),
+			"outputs":         outputs,
+		})
+	}
+
+	notebook := map[string]any{
+		"nbformat":       4,
+		"nbformat_minor": 4,
+		"metadata": map[string]any{
+			"kernelspec": map[string]any{"display_name": "R", "language": "R", "name": "ir"},
+			"language_info": map[string]any{
+				"name":            "R",
+				"codemirror_mode": "r",
+				"file_extension":  ".r",
+				"mimetype":        "text/x-r-source",
+				"pygments_lexer":  "r",
+			},
+		},
+		"cells": cells,
+	}
+	data, err := json.MarshalIndent(notebook, "", " ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode notebook: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// notebookLines splits text into the list of lines used by the notebook
+// format, keeping the line endings
+func notebookLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,201 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSession replaces the session history with an empty one for the test
+func setupSession(t *testing.T) {
+	original := session
+	session = &sessionHistory{}
+	t.Cleanup(func() { session = original })
+}
+
+// TestSessionRecording tests that the execution tools record their snippets
+func TestSessionRecording(t *testing.T) {
+	setupSession(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			if filepath.Base(config.OutputPath) == "output.txt" {
+				return []byte("[1] 2\nOutput file path: /tmp/x/output.txt\nR script execution completed successfully!\n"), nil
+			}
+			return []byte(`[
+				{"type": "source", "chunk": 1, "text": "x <- 1", "file": ""},
+				{"type": "source", "chunk": 2, "text": "warning('careful')", "file": ""},
+				{"type": "warning", "chunk": 2, "text": "careful", "file": ""},
+				{"type": "source", "chunk": 3, "text": "stop('boom')", "file": ""},
+				{"type": "error", "chunk": 3, "text": "boom", "file": ""}
+			]`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	_, err := ExecuteRScriptTool(RScriptArgs{Code: "1 + 1"})
+	require.NoError(t, err)
+	_, err = ExecuteRNotebook(RNotebookArgs{Chunks: []string{"x <- 1", "warning('careful')", "stop('boom')", "never <- TRUE"}})
+	require.NoError(t, err)
+
+	entries := session.snapshot()
+	require.Len(t, entries, 4)
+	assert.Equal(t, "execute_r_script", entries[0].Tool)
+	assert.Equal(t, "1 + 1", entries[0].Code)
+	assert.Equal(t, []sessionOutput{{Type: "stdout", Text: "[1] 2\n"}}, entries[0].Outputs)
+	assert.Equal(t, "x <- 1", entries[1].Code)
+	assert.Empty(t, entries[1].Outputs)
+	assert.Equal(t, []sessionOutput{{Type: "stderr", Text: "Warning: careful\n"}}, entries[2].Outputs)
+	assert.Equal(t, []sessionOutput{{Type: "error", Text: "boom"}}, entries[3].Outputs)
+
+	// Failed executions are recorded too
+	cleanup()
+	cleanup = SetupMockExecutor(&MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			return nil, errors.New("object 'y' not found")
+		},
+	})
+	_, err = ExecuteRScriptTool(RScriptArgs{Code: "y"})
+	require.Error(t, err)
+	entries = session.snapshot()
+	require.Len(t, entries, 5)
+	assert.Equal(t, []sessionOutput{{Type: "error", Text: "object 'y' not found"}}, entries[4].Outputs)
+}
+
+// sampleSession records a small session for the export tests
+func sampleSession() {
+	session.entries = []sessionEntry{
+		{Tool: "execute_r_script", Code: "x <- 1:3\nprint(x)\n", Time: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), Outputs: []sessionOutput{{Type: "stdout", Text: "[1] 1 2 3\n"}}},
+		{Tool: "render_ggplot", Code: "ggplot(mtcars, aes(wt, mpg)) + geom_point()", Time: time.Date(2024, 5, 1, 9, 1, 0, 0, time.UTC), Outputs: []sessionOutput{{Type: "image", Data: "cG5n", MimeType: "image/png"}}},
+		{Tool: "execute_r_script", Code: "stop('boom')", Time: time.Date(2024, 5, 1, 9, 2, 0, 0, time.UTC), Outputs: []sessionOutput{{Type: "error", Text: "boom"}}},
+	}
+}
+
+// TestExportSessionScript tests the export as an R script
+func TestExportSessionScript(t *testing.T) {
+	setupSession(t)
+	sampleSession()
+
+	response, err := ExportSession(ExportSessionArgs{Title: "Analysis"})
+	require.NoError(t, err)
+	assert.Equal(t, "Exported 3 snippets as session.R", response.Content[0].TextContent.Text)
+
+	resource := response.Content[1].EmbeddedResource.TextResourceContents
+	assert.Equal(t, "session:///session.R", resource.Uri)
+	assert.Contains(t, resource.Text, "# Analysis\n")
+	assert.Contains(t, resource.Text, "\nlibrary(ggplot2)\nlibrary(cowplot)\n")
+	assert.Contains(t, resource.Text, "# ---- [1] execute_r_script (2024-05-01T09:00:00Z) ----\nx <- 1:3\nprint(x)\n#> [1] 1 2 3\n")
+	assert.Contains(t, resource.Text, "geom_point()\n#> [image/png figure]\n")
+	assert.Contains(t, resource.Text, "stop('boom')\n#> Error: boom\n")
+}
+
+// TestExportSessionDatasets tests that the export binds the datasets the
+// snippets use by name, as the tools did when they ran them
+func TestExportSessionDatasets(t *testing.T) {
+	dir := setupCatalog(t)
+	setupDataDir(t)
+	setupSession(t)
+	session.entries = []sessionEntry{
+		{Tool: "execute_r_script", Code: "summary(sales)", Time: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)},
+	}
+
+	response, err := ExportSession(ExportSessionArgs{})
+	require.NoError(t, err)
+	text := response.Content[1].EmbeddedResource.TextResourceContents.Text
+	assert.Contains(t, text, "\n# Bind the datasets\ndelayedAssign(\"sales\", { if (!requireNamespace(\"arrow\"")
+	assert.Contains(t, text, rQuote(filepath.Join(dir, "extracts", "sales_2024.parquet")))
+	assert.NotContains(t, text, "regions")
+	assert.NotContains(t, text, "library(ggplot2)")
+	assert.Less(t, strings.Index(text, "delayedAssign"), strings.Index(text, "summary(sales)"))
+}
+
+// TestExportSessionRmd tests the export as an R Markdown document saved to the workspace
+func TestExportSessionRmd(t *testing.T) {
+	setupSession(t)
+	dir := setupRmdDir(t)
+	sampleSession()
+
+	response, err := ExportSession(ExportSessionArgs{Format: "rmd", Filename: "analysis", Clear: true})
+	require.NoError(t, err)
+	assert.Contains(t, response.Content[0].TextContent.Text, "Exported 3 snippets as analysis.Rmd and saved it")
+
+	data, err := os.ReadFile(filepath.Join(dir, "analysis.Rmd"))
+	require.NoError(t, err)
+	assert.Equal(t, "---\ntitle: \"R session\"\noutput: html_document\n---\n\n"+
+		"```{r setup, include = FALSE}\nlibrary(ggplot2)\nlibrary(cowplot)\n```\n\n"+
+		"```{r snippet-1}\nx <- 1:3\nprint(x)\n```\n\n"+
+		"```{r snippet-2}\nggplot(mtcars, aes(wt, mpg)) + geom_point()\n```\n\n"+
+		"```{r snippet-3, error = TRUE}\nstop('boom')\n```\n", string(data))
+	assert.Empty(t, session.snapshot())
+
+	_, err = ExportSession(ExportSessionArgs{})
+	assert.EqualError(t, err, "no R code has been executed in this session yet")
+}
+
+// TestExportSessionNotebook tests the export as a Jupyter notebook for the IR kernel
+func TestExportSessionNotebook(t *testing.T) {
+	setupSession(t)
+	sampleSession()
+
+	response, err := ExportSession(ExportSessionArgs{Format: "ipynb"})
+	require.NoError(t, err)
+	resource := response.Content[1].EmbeddedResource.TextResourceContents
+	assert.Equal(t, "application/x-ipynb+json", *resource.MimeType)
+
+	var notebook struct {
+		NBFormat int `json:"nbformat"`
+		Metadata struct {
+			KernelSpec map[string]string `json:"kernelspec"`
+		} `json:"metadata"`
+		Cells []struct {
+			CellType       string           `json:"cell_type"`
+			ExecutionCount *int             `json:"execution_count"`
+			Source         []string         `json:"source"`
+			Outputs        []map[string]any `json:"outputs"`
+		} `json:"cells"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(resource.Text), &notebook))
+	assert.Equal(t, 4, notebook.NBFormat)
+	assert.Equal(t, "ir", notebook.Metadata.KernelSpec["name"])
+	require.Len(t, notebook.Cells, 5)
+
+	assert.Equal(t, "markdown", notebook.Cells[0].CellType)
+	assert.Equal(t, []string{"library(ggplot2)\n", "library(cowplot)"}, notebook.Cells[1].Source)
+	assert.Nil(t, notebook.Cells[1].ExecutionCount)
+
+	cell := notebook.Cells[2]
+	assert.Equal(t, 1, *cell.ExecutionCount)
+	assert.Equal(t, []string{"x <- 1:3\n", "print(x)"}, cell.Source)
+	assert.Equal(t, map[string]any{"output_type": "stream", "name": "stdout", "text": []any{"[1] 1 2 3\n"}}, cell.Outputs[0])
+
+	assert.Equal(t, "display_data", notebook.Cells[3].Outputs[0]["output_type"])
+	assert.Equal(t, "cG5n", notebook.Cells[3].Outputs[0]["data"].(map[string]any)["image/png"])
+	assert.Equal(t, "error", notebook.Cells[4].Outputs[0]["output_type"])
+	assert.Equal(t, "boom", notebook.Cells[4].Outputs[0]["evalue"])
+
+	// SVG figures are stored as text, binary images as base64
+	svg := "<svg xmlns=\"http://www.w3.org/2000/svg\">\n<rect/>\n</svg>"
+	assert.Equal(t, []string{"<svg xmlns=\"http://www.w3.org/2000/svg\">\n", "<rect/>\n", "</svg>"},
+		notebookOutputData(sessionOutput{Type: "image", MimeType: "image/svg+xml", Data: EncodeImageToBase64([]byte(svg))}))
+	assert.Equal(t, "cG5n", notebookOutputData(sessionOutput{Type: "image", MimeType: "image/jpeg", Data: "cG5n"}))
+}
+
+// TestExportSessionValidation tests the validation of the export arguments
+func TestExportSessionValidation(t *testing.T) {
+	setupSession(t)
+	sampleSession()
+
+	_, err := ExportSession(ExportSessionArgs{Format: "html"})
+	assert.EqualError(t, err, "format must be r, rmd or ipynb")
+
+	_, err = ExportSession(ExportSessionArgs{Filename: "../outside"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,222 @@
+package mcp
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// SimulationVariable describes a random variable of a Monte Carlo simulation
+type SimulationVariable struct {
+	Name         string    `json:"name" jsonschema:"required,description=Variable name used in the formula"`
+	Distribution string    `json:"distribution" jsonschema:"required,description=Distribution (triangle, normal, uniform, lognormal, empirical)"`
+	Min          float64   `json:"min,omitempty" jsonschema:"description=Lower bound (triangle, uniform)"`
+	Mode         float64   `json:"mode,omitempty" jsonschema:"description=Most likely value (triangle)"`
+	Max          float64   `json:"max,omitempty" jsonschema:"description=Upper bound (triangle, uniform)"`
+	Mean         float64   `json:"mean,omitempty" jsonschema:"description=Mean (normal)"`
+	SD           float64   `json:"sd,omitempty" jsonschema:"description=Standard deviation (normal)"`
+	MeanLog      float64   `json:"meanlog,omitempty" jsonschema:"description=Mean on the log scale (lognormal)"`
+	SDLog        float64   `json:"sdlog,omitempty" jsonschema:"description=Standard deviation on the log scale (lognormal)"`
+	Values       []float64 `json:"values,omitempty" jsonschema:"description=Observed values resampled with replacement (empirical)"`
+}
+
+// SimulationArgs represents the arguments for running a Monte Carlo simulation
+type SimulationArgs struct {
+	Variables   []SimulationVariable `json:"variables" jsonschema:"required,description=Random variables of the simulation"`
+	Formula     string               `json:"formula" jsonschema:"required,description=R expression combining the variables, e.g. design + build * 1.2"`
+	Iterations  int                  `json:"iterations" jsonschema:"description=Number of iterations (default 10000, maximum 1000000)"`
+	Seed        *int64               `json:"seed,omitempty" jsonschema:"description=Random seed; a seed is chosen and reported if omitted"`
+	Percentiles []float64            `json:"percentiles" jsonschema:"description=Percentiles to report between 0 and 100 (default 5, 10, 25, 50, 75, 90, 95)"`
+	Width       int                  `json:"width" jsonschema:"description=Width of the chart in pixels"`
+	Height      int                  `json:"height" jsonschema:"description=Height of the chart in pixels"`
+	Resolution  int                  `json:"resolution" jsonschema:"description=Resolution of the chart in dpi"`
+
+	BundleOption
+}
+
+const maxSimulationIterations = 1000000
+
+var defaultPercentiles = []float64{5, 10, 25, 50, 75, 90, 95}
+
+// RunSimulation draws the given random variables, combines them with the
+// formula and returns summary statistics along with a histogram/CDF chart
+func RunSimulation(args SimulationArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if len(args.Variables) == 0 {
+		return nil, fmt.Errorf("at least one variable is required")
+	}
+
+	iterations := args.Iterations
+	if iterations == 0 {
+		iterations = 10000
+	} else if iterations < 1 || iterations > maxSimulationIterations {
+		return nil, fmt.Errorf("iterations must be between 1 and %d", maxSimulationIterations)
+	}
+
+	percentiles := args.Percentiles
+	if len(percentiles) == 0 {
+		percentiles = defaultPercentiles
+	}
+	for _, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("percentiles must be between 0 and 100")
+		}
+	}
+
+	names := make(map[string]bool, len(args.Variables))
+	var draws []string
+	for _, v := range args.Variables {
+		if !isRIdentifier(v.Name) {
+			return nil, fmt.Errorf("invalid variable name: %q", v.Name)
+		}
+		if names[v.Name] {
+			return nil, fmt.Errorf("duplicate variable name: %s", v.Name)
+		}
+		names[v.Name] = true
+
+		draw, err := distributionDraw(v)
+		if err != nil {
+			return nil, err
+		}
+		draws = append(draws, fmt.Sprintf("  %s = %s", v.Name, draw))
+	}
+
+	if err := validateRExpression(args.Formula, names, mathFunctions); err != nil {
+		return nil, fmt.Errorf("invalid formula: %w", err)
+	}
+
+	var seed int64
+	if args.Seed != nil {
+		seed = *args.Seed
+	} else {
+		seed = rand.Int63n(1 << 31)
+	}
+	if seed < 0 || seed >= 1<<31 {
+		return nil, fmt.Errorf("seed must be between 0 and 2147483647")
+	}
+
+	width, height, resolution, err := validateImageSize(args.Width, args.Height, args.Resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newRJob("simulation-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	// Generate the R script content
+	scriptContent := fmt.Sprintf(`
+library(ggplot2)
+library(cowplot)
+
+# Set output parameters
+width <- %d
+height <- %d
+dpi <- %d
+output_file <- %s
+plot_file <- %s
+pdf(NULL)
+
+# Draw the variables
+set.seed(%d)
+n <- %d
+draws <- list(
+%s
+)
+
+# Combine the variables with the formula
+values <- eval(parse(text = %s), envir = draws, enclos = baseenv())
+if (!is.numeric(values)) stop("formula must evaluate to a number")
+values <- rep_len(values, n)
+
+probs <- c(%s) / 100
+result <- list(
+  iterations = n,
+  seed = %d,
+  formula = %s,
+  mean = mean(values, na.rm = TRUE),
+  sd = sd(values, na.rm = TRUE),
+  min = min(values, na.rm = TRUE),
+  max = max(values, na.rm = TRUE),
+  missing = sum(is.na(values)),
+  percentiles = as.list(setNames(quantile(values, probs, na.rm = TRUE, names = FALSE), paste0("p", probs * 100))),
+  variables = lapply(draws, function(x) list(mean = mean(x), sd = sd(x), min = min(x), max = max(x)))
+)
+jsonlite::write_json(result, output_file, auto_unbox = TRUE, digits = NA, pretty = TRUE)
+
+# Draw the histogram and the empirical CDF
+df <- data.frame(value = values[!is.na(values)])
+histogram <- ggplot(df, aes(x = value)) +
+  geom_histogram(bins = 50, fill = "steelblue", colour = "white") +
+  geom_vline(xintercept = result$mean, linetype = "dashed") +
+  labs(title = "Distribution", x = %s, y = "Count") +
+  theme_minimal()
+cdf <- ggplot(df, aes(x = value)) +
+  stat_ecdf(geom = "step", colour = "steelblue") +
+  geom_hline(yintercept = probs, linetype = "dotted", colour = "grey50") +
+  labs(title = "Cumulative probability", x = %s, y = "P(X <= x)") +
+  theme_minimal()
+ggsave(plot_file, plot_grid(histogram, cdf, ncol = 2), width = width/dpi, height = height/dpi, dpi = dpi)
+`, width, height, resolution, rQuote(job.Path("output.json")), rQuote(job.Path("chart.png")),
+		seed, iterations, strings.Join(draws, ",\n"), rQuote(args.Formula),
+		formatRNumbers(percentiles), seed, rQuote(args.Formula), rQuote(args.Formula), rQuote(args.Formula))
+
+	summary, err := job.Run(scriptContent, "output.json", RExecutionConfig{
+		OutputFormat: "png",
+		Width:        width,
+		Height:       height,
+		Resolution:   resolution,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chartData, err := job.ReadFile("chart.png")
+	if err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResponse(
+		mcp.NewTextContent(string(summary)),
+		mcp.NewImageContent(EncodeImageToBase64(chartData), GetMimeType("png")),
+	), nil
+}
+
+// distributionDraw validates the parameters of a variable and returns the R
+// call that draws n values from its distribution
+func distributionDraw(v SimulationVariable) (string, error) {
+	switch v.Distribution {
+	case "triangle":
+		if v.Min >= v.Max || v.Mode < v.Min || v.Mode > v.Max {
+			return "", fmt.Errorf("variable %s: triangle requires min <= mode <= max and min < max", v.Name)
+		}
+		return fmt.Sprintf("triangle::rtriangle(n, a = %s, b = %s, c = %s)",
+			formatRNumber(v.Min), formatRNumber(v.Max), formatRNumber(v.Mode)), nil
+	case "normal":
+		if v.SD <= 0 {
+			return "", fmt.Errorf("variable %s: normal requires a positive sd", v.Name)
+		}
+		return fmt.Sprintf("rnorm(n, mean = %s, sd = %s)", formatRNumber(v.Mean), formatRNumber(v.SD)), nil
+	case "uniform":
+		if v.Min >= v.Max {
+			return "", fmt.Errorf("variable %s: uniform requires min < max", v.Name)
+		}
+		return fmt.Sprintf("runif(n, min = %s, max = %s)", formatRNumber(v.Min), formatRNumber(v.Max)), nil
+	case "lognormal":
+		if v.SDLog <= 0 {
+			return "", fmt.Errorf("variable %s: lognormal requires a positive sdlog", v.Name)
+		}
+		return fmt.Sprintf("rlnorm(n, meanlog = %s, sdlog = %s)", formatRNumber(v.MeanLog), formatRNumber(v.SDLog)), nil
+	case "empirical":
+		if len(v.Values) == 0 {
+			return "", fmt.Errorf("variable %s: empirical requires values", v.Name)
+		}
+		return fmt.Sprintf("c(%s)[sample.int(%d, n, replace = TRUE)]", formatRNumbers(v.Values), len(v.Values)), nil
+	default:
+		return "", fmt.Errorf("variable %s: unsupported distribution %q", v.Name, v.Distribution)
+	}
+}
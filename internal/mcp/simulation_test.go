@@ -0,0 +1,73 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunSimulationExecution tests that the variables are drawn with the requested distributions
+func TestRunSimulationExecution(t *testing.T) {
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "set.seed(42)")
+			assert.Contains(t, string(script), "design = triangle::rtriangle(n, a = 10, b = 30, c = 15)")
+			assert.Contains(t, string(script), "risk = c(0, 5, 20)[sample.int(3, n, replace = TRUE)]")
+			assert.Contains(t, string(script), "probs <- c(50, 90) / 100")
+
+			chartPath := filepath.Join(filepath.Dir(config.OutputPath), "chart.png")
+			require.NoError(t, os.WriteFile(chartPath, []byte("mock-chart"), 0644))
+			return []byte(`{"mean":25}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	seed := int64(42)
+	response, err := RunSimulation(SimulationArgs{
+		Variables: []SimulationVariable{
+			{Name: "design", Distribution: "triangle", Min: 10, Mode: 15, Max: 30},
+			{Name: "risk", Distribution: "empirical", Values: []float64{0, 5, 20}},
+		},
+		Formula:     "design + risk",
+		Seed:        &seed,
+		Percentiles: []float64{50, 90},
+	})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 2)
+	assert.Equal(t, `{"mean":25}`, response.Content[0].TextContent.Text)
+	assert.Equal(t, "image/png", response.Content[1].ImageContent.MimeType)
+}
+
+// TestRunSimulationValidation tests the validation of variables and the formula
+func TestRunSimulationValidation(t *testing.T) {
+	normal := SimulationVariable{Name: "x", Distribution: "normal", Mean: 1, SD: 1}
+	tests := []struct {
+		name     string
+		args     SimulationArgs
+		errorMsg string
+	}{
+		{"No variables", SimulationArgs{Formula: "x"}, "at least one variable is required"},
+		{"Bad name", SimulationArgs{Variables: []SimulationVariable{{Name: "1x", Distribution: "normal", SD: 1}}, Formula: "1"}, "invalid variable name"},
+		{"Duplicate name", SimulationArgs{Variables: []SimulationVariable{normal, normal}, Formula: "x"}, "duplicate variable name"},
+		{"Bad triangle", SimulationArgs{Variables: []SimulationVariable{{Name: "x", Distribution: "triangle", Min: 5, Mode: 1, Max: 10}}, Formula: "x"}, "triangle requires"},
+		{"Unknown distribution", SimulationArgs{Variables: []SimulationVariable{{Name: "x", Distribution: "beta"}}, Formula: "x"}, "unsupported distribution"},
+		{"Unknown formula name", SimulationArgs{Variables: []SimulationVariable{normal}, Formula: "x + y"}, "invalid formula: unknown name in expression: y"},
+		{"Too many iterations", SimulationArgs{Variables: []SimulationVariable{normal}, Formula: "x", Iterations: 2000000}, "iterations must be between"},
+		{"Bad percentile", SimulationArgs{Variables: []SimulationVariable{normal}, Formula: "x", Percentiles: []float64{101}}, "percentiles must be between 0 and 100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := RunSimulation(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// TableColumn describes how a column of a table is labelled and formatted
+type TableColumn struct {
+	Name     string `json:"name" jsonschema:"required,description=Column name in the data"`
+	Label    string `json:"label,omitempty" jsonschema:"description=Column header; defaults to the column name"`
+	Format   string `json:"format,omitempty" jsonschema:"description=Value format (number, integer, percent, currency, scientific, date)"`
+	Decimals *int   `json:"decimals,omitempty" jsonschema:"description=Number of decimal places for number, percent, currency and scientific formats"`
+	Prefix   string `json:"prefix,omitempty" jsonschema:"description=Text put before every value; currency defaults to $"`
+	Suffix   string `json:"suffix,omitempty" jsonschema:"description=Text put after every value"`
+	Align    string `json:"align,omitempty" jsonschema:"description=Alignment (left, center, right); numbers are right aligned by default"`
+}
+
+// TableHighlight highlights the cells of the rows matching a condition
+type TableHighlight struct {
+	Condition string   `json:"condition" jsonschema:"required,description=R expression over the columns selecting the rows to highlight, e.g. mpg > 25 & cyl == 4"`
+	Columns   []string `json:"columns,omitempty" jsonschema:"description=Columns to highlight; the whole row if omitted"`
+	Color     string   `json:"color,omitempty" jsonschema:"description=Background colour as a CSS colour name or hex code (default #fff3b0)"`
+	Bold      bool     `json:"bold,omitempty" jsonschema:"description=Also show the highlighted cells in bold"`
+}
+
+// TableRenderArgs represents the arguments for rendering a table
+type TableRenderArgs struct {
+	Data       string           `json:"data,omitempty" jsonschema:"description=R code evaluating to a data frame, e.g. head(mtcars); either data or records is required"`
+	Records    []map[string]any `json:"records,omitempty" jsonschema:"description=Rows of the table as JSON objects with scalar values"`
+	Columns    []TableColumn    `json:"columns,omitempty" jsonschema:"description=Columns to show in this order with their labels and formats; all columns if omitted"`
+	GroupBy    string           `json:"group_by,omitempty" jsonschema:"description=Column whose values group the rows under headings"`
+	Highlights []TableHighlight `json:"highlights,omitempty" jsonschema:"description=Cells to highlight by condition"`
+	Title      string           `json:"title,omitempty" jsonschema:"description=Title shown above the table"`
+	Caption    string           `json:"caption,omitempty" jsonschema:"description=Note shown below the table"`
+	MaxRows    int              `json:"max_rows,omitempty" jsonschema:"description=Maximum number of rows to show (default 100, maximum 1000)"`
+	OutputType string           `json:"output_type,omitempty" jsonschema:"description=Output format (markdown, html, png); markdown is always included"`
+	Filename   string           `json:"filename,omitempty" jsonschema:"description=Also save the table in the rmd directory under this name (without extension) so reports can include it"`
+
+	BundleOption
+}
+
+const maxTableRows = 1000
+
+// tableFormats are the supported column formats
+var tableFormats = map[string]bool{
+	"": true, "number": true, "integer": true, "percent": true, "currency": true, "scientific": true, "date": true,
+}
+
+var cssColorPattern = regexp.MustCompile(`^(?:#[0-9A-Fa-f]{3}|#[0-9A-Fa-f]{6}|#[0-9A-Fa-f]{8}|[A-Za-z]+)$`)
+
+// renderedTable is the formatted table written by the R script
+type renderedTable struct {
+	TotalRows int `json:"total_rows"`
+	Columns   []struct {
+		Label string `json:"label"`
+		Align string `json:"align"`
+	} `json:"columns"`
+	Rows []struct {
+		Group       string   `json:"group"`
+		Cells       []string `json:"cells"`
+		Highlighted []bool   `json:"highlighted"`
+	} `json:"rows"`
+}
+
+// RenderTable formats a data frame or JSON records as a table and returns it
+// as markdown, along with HTML or a PNG image when asked for
+func RenderTable(args TableRenderArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if args.Data == "" && len(args.Records) == 0 {
+		return nil, fmt.Errorf("either data or records is required")
+	}
+	if args.Data != "" && len(args.Records) > 0 {
+		return nil, fmt.Errorf("data and records cannot be used together")
+	}
+
+	// Column names are only known up front for records; the names used by
+	// the highlight conditions are checked in R otherwise
+	var names map[string]bool
+	if len(args.Records) > 0 {
+		if len(args.Records) > maxTableRows {
+			return nil, fmt.Errorf("at most %d records can be rendered", maxTableRows)
+		}
+		names = make(map[string]bool)
+		for i, record := range args.Records {
+			for name, value := range record {
+				switch value.(type) {
+				case nil, string, float64, bool:
+				default:
+					return nil, fmt.Errorf("record %d: value of %q must be a string, number, boolean or null", i+1, name)
+				}
+				names[name] = true
+			}
+		}
+	}
+
+	for _, column := range args.Columns {
+		if column.Name == "" {
+			return nil, fmt.Errorf("column name is required")
+		}
+		if !tableFormats[column.Format] {
+			return nil, fmt.Errorf("column %s: format must be number, integer, percent, currency, scientific or date", column.Name)
+		}
+		if column.Decimals != nil && (*column.Decimals < 0 || *column.Decimals > 10) {
+			return nil, fmt.Errorf("column %s: decimals must be between 0 and 10", column.Name)
+		}
+		if column.Align != "" && column.Align != "left" && column.Align != "center" && column.Align != "right" {
+			return nil, fmt.Errorf("column %s: align must be left, center or right", column.Name)
+		}
+	}
+
+	for _, highlight := range args.Highlights {
+		if err := validateRExpression(highlight.Condition, names, mathFunctions); err != nil {
+			return nil, fmt.Errorf("invalid highlight condition: %w", err)
+		}
+		if highlight.Color != "" && !cssColorPattern.MatchString(highlight.Color) {
+			return nil, fmt.Errorf("invalid highlight color: %q", highlight.Color)
+		}
+	}
+
+	maxRows := args.MaxRows
+	if maxRows == 0 {
+		maxRows = 100
+	} else if maxRows < 1 || maxRows > maxTableRows {
+		return nil, fmt.Errorf("max_rows must be between 1 and %d", maxTableRows)
+	}
+
+	outputType := args.OutputType
+	if outputType == "" {
+		outputType = "markdown"
+	} else if outputType != "markdown" && outputType != "html" && outputType != "png" {
+		return nil, fmt.Errorf("output_type must be markdown, html or png")
+	}
+
+	extension := outputType
+	if outputType == "markdown" {
+		extension = "md"
+	}
+	name := "table"
+	if args.Filename != "" {
+		var err error
+		if name, err = sanitizeWorkspaceFilename(args.Filename, "."+extension); err != nil {
+			return nil, err
+		}
+	}
+
+	job, err := newRJob("table-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	// Pass the table options as JSON so that labels and conditions never
+	// need quoting in the script
+	columns := append([]TableColumn(nil), args.Columns...)
+	for i := range columns {
+		if columns[i].Format == "currency" && columns[i].Prefix == "" {
+			columns[i].Prefix = "$"
+		}
+	}
+	spec, err := json.Marshal(map[string]any{
+		"columns":    columns,
+		"group_by":   args.GroupBy,
+		"highlights": args.Highlights,
+		"title":      args.Title,
+		"caption":    args.Caption,
+		"max_rows":   maxRows,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode table options: %w", err)
+	}
+	specPath, err := job.WriteFile("spec.json", spec)
+	if err != nil {
+		return nil, err
+	}
+
+	loadData := fmt.Sprintf("eval(parse(text = %s), envir = new.env())", rQuote(args.Data))
+	if len(args.Records) > 0 {
+		records, err := json.Marshal(args.Records)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode records: %w", err)
+		}
+		recordsPath, err := job.WriteFile("records.json", records)
+		if err != nil {
+			return nil, err
+		}
+		loadData = fmt.Sprintf("jsonlite::fromJSON(%s, simplifyVector = TRUE)", rQuote(recordsPath))
+	}
+
+	// Generate the R script content
+	scriptContent := fmt.Sprintf(`
+output_file <- %s
+output_type <- %s
+html_file <- %s
+png_file <- %s
+spec <- jsonlite::read_json(%s, simplifyVector = FALSE)
+
+# Load the data
+df <- %s
+if (is.matrix(df)) df <- as.data.frame(df)
+if (!is.data.frame(df)) stop("data must evaluate to a data frame")
+df <- as.data.frame(df, stringsAsFactors = FALSE)
+
+columns <- spec$columns
+group_by <- if (nzchar(spec$group_by)) spec$group_by else NULL
+if (length(columns) == 0) columns <- lapply(setdiff(names(df), group_by), function(n) list(name = n))
+column_names <- vapply(columns, function(col) col$name, "")
+unknown <- setdiff(c(column_names, group_by, unlist(lapply(spec$highlights, function(h) h$columns))), names(df))
+if (length(unknown) > 0) {
+  stop("unknown column: ", paste(unknown, collapse = ", "), " (columns: ", paste(names(df), collapse = ", "), ")")
+}
+
+# Evaluate the highlight conditions on the rows
+marks <- lapply(spec$highlights, function(h) {
+  expr <- parse(text = h$condition)
+  unknown <- setdiff(all.vars(expr), c(names(df), "pi", "T", "F"))
+  if (length(unknown) > 0) stop("unknown column in highlight condition: ", paste(unknown, collapse = ", "))
+  rows <- eval(expr[[1]], envir = df, enclos = baseenv())
+  rep_len(as.logical(rows), nrow(df)) %%in%% TRUE
+})
+
+# Keep the groups together in order of appearance and cut to max_rows
+total_rows <- nrow(df)
+order_rows <- seq_len(total_rows)
+if (!is.null(group_by)) order_rows <- order(match(df[[group_by]], unique(df[[group_by]])))
+order_rows <- head(order_rows, spec$max_rows)
+df <- df[order_rows, , drop = FALSE]
+marks <- lapply(marks, function(m) m[order_rows])
+
+# Format the columns
+numeric_formats <- c("number", "integer", "percent", "currency", "scientific")
+format_column <- function(x, col) {
+  fmt <- if (is.null(col$format)) "" else col$format
+  digits <- function(default) if (is.null(col$decimals)) default else col$decimals
+  if (fmt %%in%% numeric_formats && !is.numeric(x)) stop("column ", col$name, " is not numeric")
+  out <- switch(fmt,
+    number = formatC(x, format = "f", digits = digits(2), big.mark = ","),
+    integer = formatC(round(x), format = "d", big.mark = ","),
+    percent = paste0(formatC(100 * x, format = "f", digits = digits(1), big.mark = ","), "%%"),
+    currency = formatC(x, format = "f", digits = digits(2), big.mark = ","),
+    scientific = formatC(x, format = "e", digits = digits(2)),
+    date = format(as.Date(x), "%%Y-%%m-%%d"),
+    if (is.numeric(x)) format(x, trim = TRUE) else as.character(x))
+  out <- paste0(if (is.null(col$prefix)) "" else col$prefix, out, if (is.null(col$suffix)) "" else col$suffix)
+  out[is.na(x)] <- ""
+  out
+}
+cells <- lapply(columns, function(col) format_column(df[[col$name]], col))
+labels <- vapply(columns, function(col) if (is.null(col$label)) col$name else col$label, "")
+aligns <- vapply(columns, function(col) {
+  if (!is.null(col$align)) col$align
+  else if (is.numeric(df[[col$name]])) "right"
+  else "left"
+}, "")
+groups <- if (is.null(group_by)) rep("", nrow(df)) else as.character(df[[group_by]])
+
+# Mark the highlighted cells
+highlighted <- matrix(FALSE, nrow(df), length(columns))
+for (i in seq_along(spec$highlights)) {
+  h <- spec$highlights[[i]]
+  cols <- if (length(h$columns) == 0) seq_along(columns) else which(column_names %%in%% unlist(h$columns))
+  highlighted[marks[[i]], cols] <- TRUE
+}
+
+result <- list(
+  total_rows = total_rows,
+  columns = lapply(seq_along(columns), function(j) list(label = labels[j], align = aligns[j])),
+  rows = lapply(seq_len(nrow(df)), function(r) list(
+    group = groups[r],
+    cells = I(vapply(cells, function(x) x[r], "")),
+    highlighted = I(highlighted[r, ])
+  ))
+)
+jsonlite::write_json(result, output_file, auto_unbox = TRUE, pretty = TRUE)
+
+# Render the table with gt for HTML and PNG
+if (output_type != "markdown") {
+  display <- as.data.frame(setNames(cells, paste0("column_", seq_along(cells))), stringsAsFactors = FALSE)
+  if (!is.null(group_by)) display$group <- groups
+  tbl <- gt::gt(display, groupname_col = if (is.null(group_by)) NULL else "group")
+  tbl <- gt::cols_label(tbl, .list = setNames(as.list(labels), paste0("column_", seq_along(columns))))
+  for (j in seq_along(columns)) tbl <- gt::cols_align(tbl, align = aligns[j], columns = j)
+  if (nzchar(spec$title)) tbl <- gt::tab_header(tbl, title = spec$title)
+  if (nzchar(spec$caption)) tbl <- gt::tab_source_note(tbl, spec$caption)
+  if (total_rows > nrow(df)) tbl <- gt::tab_source_note(tbl, sprintf("Showing %%d of %%d rows", nrow(df), total_rows))
+  for (i in seq_along(spec$highlights)) {
+    h <- spec$highlights[[i]]
+    rows <- which(marks[[i]])
+    if (length(rows) == 0) next
+    cols <- if (length(h$columns) == 0) seq_along(columns) else which(column_names %%in%% unlist(h$columns))
+    style <- list(gt::cell_fill(color = if (is.null(h$color)) "#fff3b0" else h$color))
+    if (isTRUE(h$bold)) style <- c(style, list(gt::cell_text(weight = "bold")))
+    tbl <- gt::tab_style(tbl, style = style, locations = gt::cells_body(columns = cols, rows = rows))
+  }
+  if (output_type == "html") {
+    writeLines(as.character(gt::as_raw_html(tbl, inline_css = FALSE)), html_file)
+  } else {
+    gt::gtsave(tbl, png_file, zoom = 2, expand = 10)
+  }
+}
+`, rQuote(job.Path("output.json")), rQuote(outputType), rQuote(job.Path("table.html")), rQuote(job.Path("table.png")),
+		rQuote(specPath), loadData)
+
+	output, err := job.Run(scriptContent, "output.json", RExecutionConfig{})
+	if err != nil {
+		return nil, err
+	}
+
+	var table renderedTable
+	if err := json.Unmarshal(output, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse table: %w", err)
+	}
+	markdown := markdownTable(table, args.Title, args.Caption)
+
+	file := name + "." + extension
+	content := []*mcp.Content{mcp.NewTextContent(markdown)}
+	data := []byte(markdown)
+	switch outputType {
+	case "html":
+		if data, err = job.ReadFile("table.html"); err != nil {
+			return nil, err
+		}
+		content = append(content, mcp.NewTextResourceContent("table:///"+file, string(data), GetMimeType("html")))
+	case "png":
+		if data, err = job.ReadFile("table.png"); err != nil {
+			return nil, err
+		}
+		content = append(content, mcp.NewImageContent(EncodeImageToBase64(data), GetMimeType("png")))
+	}
+
+	if args.Filename != "" {
+		if err := os.MkdirAll(RmdDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create rmd directory: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(RmdDir, file), data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write table: %w", err)
+		}
+		content = append(content, mcp.NewTextContent(fmt.Sprintf("Saved the table as %s in the %s directory", file, RmdDir)))
+	}
+
+	return mcp.NewToolResponse(content...), nil
+}
+
+// markdownTable formats a rendered table as a markdown pipe table. Group
+// headings become bold rows and highlighted cells are shown in bold, as
+// markdown has no colours.
+func markdownTable(table renderedTable, title string, caption string) string {
+	var b strings.Builder
+	if title != "" {
+		fmt.Fprintf(&b, "**%s**\n\n", title)
+	}
+
+	b.WriteString("|")
+	for _, column := range table.Columns {
+		fmt.Fprintf(&b, " %s |", markdownCell(column.Label))
+	}
+	b.WriteString("\n|")
+	for _, column := range table.Columns {
+		switch column.Align {
+		case "right":
+			b.WriteString(" ---: |")
+		case "center":
+			b.WriteString(" :---: |")
+		default:
+			b.WriteString(" :--- |")
+		}
+	}
+	b.WriteString("\n")
+
+	group := ""
+	for i, row := range table.Rows {
+		if row.Group != "" && (i == 0 || row.Group != group) {
+			fmt.Fprintf(&b, "| **%s** |%s\n", markdownCell(row.Group), strings.Repeat("  |", max(len(table.Columns)-1, 0)))
+		}
+		group = row.Group
+
+		b.WriteString("|")
+		for j, cell := range row.Cells {
+			cell = markdownCell(cell)
+			if j < len(row.Highlighted) && row.Highlighted[j] && cell != "" {
+				cell = "**" + cell + "**"
+			}
+			fmt.Fprintf(&b, " %s |", cell)
+		}
+		b.WriteString("\n")
+	}
+
+	if caption != "" {
+		fmt.Fprintf(&b, "\n%s\n", caption)
+	}
+	if table.TotalRows > len(table.Rows) {
+		fmt.Fprintf(&b, "\n_Showing %d of %d rows_\n", len(table.Rows), table.TotalRows)
+	}
+	return b.String()
+}
+
+// markdownCell escapes text for a markdown table cell
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(text, "|", `\|`)
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleRenderedTable = `{
+	"total_rows": 5,
+	"columns": [{"label": "Model", "align": "left"}, {"label": "MPG", "align": "right"}],
+	"rows": [
+		{"group": "4", "cells": ["Datsun 710", "22.80"], "highlighted": [false, false]},
+		{"group": "4", "cells": ["Fiat | 128", "32.40"], "highlighted": [false, true]},
+		{"group": "6", "cells": ["Valiant", ""], "highlighted": [true, true]}
+	]
+}`
+
+// TestRenderTable tests that the options reach the script and the formatted
+// table comes back as markdown
+func TestRenderTable(t *testing.T) {
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), `df <- eval(parse(text = "mtcars"), envir = new.env())`)
+
+			spec, err := os.ReadFile(filepath.Join(filepath.Dir(config.OutputPath), "spec.json"))
+			require.NoError(t, err)
+			assert.JSONEq(t, `{
+				"columns": [{"name": "model", "label": "Model"}, {"name": "mpg", "label": "MPG", "format": "currency", "prefix": "$", "decimals": 2}],
+				"group_by": "cyl",
+				"highlights": [{"condition": "mpg > 30", "columns": ["mpg"]}],
+				"title": "Fuel economy",
+				"caption": "Source: mtcars",
+				"max_rows": 3
+			}`, string(spec))
+			return []byte(sampleRenderedTable), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	two := 2
+	args := TableRenderArgs{
+		Data:       "mtcars",
+		Columns:    []TableColumn{{Name: "model", Label: "Model"}, {Name: "mpg", Label: "MPG", Format: "currency", Decimals: &two}},
+		GroupBy:    "cyl",
+		Highlights: []TableHighlight{{Condition: "mpg > 30", Columns: []string{"mpg"}}},
+		Title:      "Fuel economy",
+		Caption:    "Source: mtcars",
+		MaxRows:    3,
+	}
+	response, err := RenderTable(args)
+	require.NoError(t, err)
+	require.Len(t, response.Content, 1)
+	assert.Equal(t, "**Fuel economy**\n\n"+
+		"| Model | MPG |\n"+
+		"| :--- | ---: |\n"+
+		"| **4** |  |\n"+
+		"| Datsun 710 | 22.80 |\n"+
+		"| Fiat \\| 128 | **32.40** |\n"+
+		"| **6** |  |\n"+
+		"| **Valiant** |  |\n"+
+		"\nSource: mtcars\n"+
+		"\n_Showing 3 of 5 rows_\n", response.Content[0].TextContent.Text)
+	assert.Empty(t, args.Columns[1].Prefix)
+}
+
+// TestRenderTableOutputs tests the HTML and PNG outputs and saving to the workspace
+func TestRenderTableOutputs(t *testing.T) {
+	dir := setupRmdDir(t)
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			jobDir := filepath.Dir(config.OutputPath)
+			records, err := os.ReadFile(filepath.Join(jobDir, "records.json"))
+			require.NoError(t, err)
+			assert.JSONEq(t, `[{"region": "north", "sales": 10}]`, string(records))
+
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "table.html"), []byte("<table></table>"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(jobDir, "table.png"), []byte("mock-png"), 0644))
+			return []byte(`{"total_rows": 1, "columns": [{"label": "region", "align": "left"}], "rows": [{"group": "", "cells": ["north"], "highlighted": [false]}]}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	records := []map[string]any{{"region": "north", "sales": 10.0}}
+
+	response, err := RenderTable(TableRenderArgs{Records: records, OutputType: "html", Filename: "sales"})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 3)
+	resource := response.Content[1].EmbeddedResource.TextResourceContents
+	assert.Equal(t, "table:///sales.html", resource.Uri)
+	assert.Equal(t, "<table></table>", resource.Text)
+	assert.Equal(t, "Saved the table as sales.html in the "+dir+" directory", response.Content[2].TextContent.Text)
+	data, err := os.ReadFile(filepath.Join(dir, "sales.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "<table></table>", string(data))
+
+	response, err = RenderTable(TableRenderArgs{Records: records, OutputType: "png"})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 2)
+	assert.Equal(t, "image/png", response.Content[1].ImageContent.MimeType)
+
+	_, err = RenderTable(TableRenderArgs{Records: records, Filename: "sales.md"})
+	require.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(dir, "sales.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "| region |\n| :--- |\n| north |\n", string(data))
+}
+
+// TestRenderTableValidation tests the validation of the table arguments
+func TestRenderTableValidation(t *testing.T) {
+	records := []map[string]any{{"mpg": 21.0, "model": "Mazda"}}
+	tests := []struct {
+		name     string
+		args     TableRenderArgs
+		errorMsg string
+	}{
+		{"No data", TableRenderArgs{}, "either data or records is required"},
+		{"Data and records", TableRenderArgs{Data: "mtcars", Records: records}, "cannot be used together"},
+		{"Nested value", TableRenderArgs{Records: []map[string]any{{"a": []any{1.0}}}}, `record 1: value of "a" must be a string, number, boolean or null`},
+		{"Bad format", TableRenderArgs{Records: records, Columns: []TableColumn{{Name: "mpg", Format: "money"}}}, "column mpg: format must be"},
+		{"Bad align", TableRenderArgs{Records: records, Columns: []TableColumn{{Name: "mpg", Align: "middle"}}}, "column mpg: align must be left, center or right"},
+		{"Unknown column in condition", TableRenderArgs{Records: records, Highlights: []TableHighlight{{Condition: "cyl > 4"}}}, "invalid highlight condition: unknown name in expression: cyl"},
+		{"Function in condition", TableRenderArgs{Data: "mtcars", Highlights: []TableHighlight{{Condition: "system('ls')"}}}, "function not allowed in expression: system"},
+		{"Bad color", TableRenderArgs{Records: records, Highlights: []TableHighlight{{Condition: "mpg > 20", Color: "red; x"}}}, "invalid highlight color"},
+		{"Too many rows", TableRenderArgs{Records: records, MaxRows: 5000}, "max_rows must be between 1 and 1000"},
+		{"Bad output type", TableRenderArgs{Records: records, OutputType: "pdf"}, "output_type must be markdown, html or png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := RenderTable(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}
@@ -0,0 +1,472 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateDir is the directory holding the R Markdown and Quarto report
+// templates used by generate_report
+var TemplateDir = "templates"
+
+// reportTemplate is a report template and the parameters it declares
+type reportTemplate struct {
+	Name   string
+	File   string
+	Title  string
+	Engine string
+	Params []templateParam
+}
+
+// templateParam is a parameter declared in the params section of a template's
+// front matter
+type templateParam struct {
+	Name     string
+	Type     string
+	Default  any
+	Label    string
+	Choices  []any
+	Min      *float64
+	Max      *float64
+	Required bool
+}
+
+// templateInputTypes maps the input controls of R Markdown parameters to
+// parameter types
+var templateInputTypes = map[string]string{
+	"checkbox": "boolean",
+	"numeric":  "number",
+	"slider":   "number",
+	"date":     "date",
+	"text":     "string",
+	"password": "string",
+	"file":     "string",
+}
+
+// ListReportTemplatesArgs represents the arguments for listing report templates
+type ListReportTemplatesArgs struct {
+	Name string `json:"name" jsonschema:"description=Only describe the template with this name"`
+
+	BundleOption
+}
+
+// GenerateReportArgs represents the arguments for generating a report
+type GenerateReportArgs struct {
+	Template string         `json:"template" jsonschema:"required,description=Name of the report template"`
+	Params   map[string]any `json:"params,omitempty" jsonschema:"description=Values for the template parameters"`
+	Format   string         `json:"format" jsonschema:"description=Output format (html, pdf, word for R Markdown; html, pdf, docx, revealjs for Quarto)"`
+	Filename string         `json:"filename" jsonschema:"description=Name of the rendered report without extension (defaults to the template name)"`
+
+	BundleOption
+}
+
+// ListReportTemplates returns the report templates with a JSON schema of the
+// parameters each one accepts
+func ListReportTemplates(args ListReportTemplatesArgs) (*mcp.ToolResponse, error) {
+	templates, err := loadReportTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	type templateInfo struct {
+		Name       string         `json:"name"`
+		Title      string         `json:"title,omitempty"`
+		File       string         `json:"file"`
+		Engine     string         `json:"engine"`
+		Parameters map[string]any `json:"parameters"`
+	}
+	infos := []templateInfo{}
+	for _, t := range templates {
+		if args.Name != "" && t.Name != args.Name {
+			continue
+		}
+		infos = append(infos, templateInfo{
+			Name:       t.Name,
+			Title:      t.Title,
+			File:       t.File,
+			Engine:     t.Engine,
+			Parameters: templateSchema(t.Params),
+		})
+	}
+	if args.Name != "" && len(infos) == 0 {
+		return nil, fmt.Errorf("report template not found: %s", args.Name)
+	}
+
+	data, err := json.MarshalIndent(infos, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode templates: %w", err)
+	}
+	return mcp.NewToolResponse(mcp.NewTextContent(string(data))), nil
+}
+
+// GenerateReport validates the params against a template's declared
+// parameters and renders the template with them
+func GenerateReport(args GenerateReportArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	if args.Template == "" {
+		return nil, fmt.Errorf("template is required")
+	}
+	templates, err := loadReportTemplates()
+	if err != nil {
+		return nil, err
+	}
+	var template *reportTemplate
+	for i := range templates {
+		if templates[i].Name == args.Template {
+			template = &templates[i]
+			break
+		}
+	}
+	if template == nil {
+		return nil, fmt.Errorf("report template not found: %s", args.Template)
+	}
+
+	if err := validateTemplateParams(template.Params, args.Params); err != nil {
+		return nil, err
+	}
+
+	outputName := template.Name
+	if args.Filename != "" {
+		if outputName, err = sanitizeWorkspaceFilename(args.Filename, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	format := args.Format
+	if format == "" {
+		format = "html"
+	}
+	path := filepath.Join(TemplateDir, template.File)
+
+	if template.Engine == "quarto" {
+		extension, ok := quartoFormats[format]
+		if !ok {
+			return nil, fmt.Errorf("format must be html, pdf, docx or revealjs for Quarto templates")
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report template: %w", err)
+		}
+		return renderQuartoSource(source, template.File, outputName, format, extension, args.Params)
+	}
+
+	rmdFormat, ok := rmdFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("format must be html, pdf or word for R Markdown templates")
+	}
+	inputPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve report template: %w", err)
+	}
+	return renderRmdFile(inputPath, template.File, outputName, rmdFormat.OutputFormat, rmdFormat.Extension, args.Params)
+}
+
+// loadReportTemplates reads the templates in TemplateDir, ordered by name.
+// When an R Markdown and a Quarto template share a name, the R Markdown one
+// is used.
+func loadReportTemplates() ([]reportTemplate, error) {
+	files, err := readDirFiles(TemplateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for file := range files {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+
+	seen := make(map[string]bool)
+	var templates []reportTemplate
+	for _, engine := range []string{"rmarkdown", "quarto"} {
+		extension := ".Rmd"
+		if engine == "quarto" {
+			extension = ".qmd"
+		}
+		for _, file := range names {
+			ext := filepath.Ext(file)
+			name := strings.TrimSuffix(file, ext)
+			if !strings.EqualFold(ext, extension) || seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			data, err := os.ReadFile(filepath.Join(TemplateDir, file))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read report template %s: %w", file, err)
+			}
+			params, err := parseTemplateParams(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("report template %s: %w", file, err)
+			}
+			templates = append(templates, reportTemplate{
+				Name:   name,
+				File:   file,
+				Title:  rmdTitle(string(data)),
+				Engine: engine,
+				Params: params,
+			})
+		}
+	}
+
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// parseTemplateParams reads the params section of a template's front matter.
+// A parameter is either a plain default value or a mapping with value, label,
+// input, choices, min and max, as understood by rmarkdown and quarto.
+// Parameters without a value are required; parameters whose value is an R
+// expression (!r) are optional and untyped.
+func parseTemplateParams(content string) ([]templateParam, error) {
+	block, ok := frontMatterBlock(content)
+	if !ok {
+		return nil, nil
+	}
+
+	var frontMatter struct {
+		Params yaml.Node `yaml:"params"`
+	}
+	if err := yaml.Unmarshal([]byte(block), &frontMatter); err != nil {
+		return nil, fmt.Errorf("invalid front matter: %w", err)
+	}
+	if frontMatter.Params.Kind == 0 {
+		return nil, nil
+	}
+	if frontMatter.Params.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("params must be a mapping")
+	}
+
+	var params []templateParam
+	nodes := frontMatter.Params.Content
+	for i := 0; i+1 < len(nodes); i += 2 {
+		param := templateParam{Name: nodes[i].Value}
+		spec := nodes[i+1]
+
+		value := spec
+		if spec.Kind == yaml.MappingNode {
+			value = nil
+			for j := 0; j+1 < len(spec.Content); j += 2 {
+				key, field := spec.Content[j].Value, spec.Content[j+1]
+				var err error
+				switch key {
+				case "value":
+					value = field
+				case "label":
+					param.Label = field.Value
+				case "input":
+					param.Type = templateInputTypes[field.Value]
+				case "choices":
+					err = field.Decode(&param.Choices)
+				case "min":
+					err = field.Decode(&param.Min)
+				case "max":
+					err = field.Decode(&param.Max)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("param %s: invalid %s: %w", param.Name, key, err)
+				}
+			}
+		}
+
+		switch {
+		case value == nil || value.Tag == "!!null":
+			param.Required = true
+		case value.Tag == "!r" || value.Tag == "!expr":
+			// Evaluated by R when the report is rendered
+		case value.Tag == "!!timestamp":
+			param.Default = value.Value
+			if param.Type == "" {
+				param.Type = "date"
+			}
+		default:
+			if err := value.Decode(&param.Default); err != nil {
+				return nil, fmt.Errorf("param %s: invalid value: %w", param.Name, err)
+			}
+			if param.Type == "" {
+				param.Type = valueType(param.Default)
+			}
+		}
+		if param.Type == "" && param.Required {
+			param.Type = "string"
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// valueType returns the parameter type of a default value
+func valueType(value any) string {
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case int:
+		return "integer"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return ""
+	}
+}
+
+// templateSchema returns the JSON schema of a template's parameters
+func templateSchema(params []templateParam) map[string]any {
+	properties := make(map[string]any, len(params))
+	required := []string{}
+	for _, p := range params {
+		property := map[string]any{}
+		switch p.Type {
+		case "date":
+			property["type"] = "string"
+			property["format"] = "date"
+		case "":
+		default:
+			property["type"] = p.Type
+		}
+		if p.Default != nil {
+			property["default"] = p.Default
+		}
+		if p.Label != "" {
+			property["description"] = p.Label
+		}
+		if len(p.Choices) > 0 {
+			property["enum"] = p.Choices
+		}
+		if p.Min != nil {
+			property["minimum"] = *p.Min
+		}
+		if p.Max != nil {
+			property["maximum"] = *p.Max
+		}
+		properties[p.Name] = property
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// validateTemplateParams checks the supplied values against the declared
+// parameters of a template
+func validateTemplateParams(params []templateParam, values map[string]any) error {
+	declared := make(map[string]templateParam, len(params))
+	names := make([]string, len(params))
+	for i, p := range params {
+		declared[p.Name] = p
+		names[i] = p.Name
+	}
+
+	supplied := make([]string, 0, len(values))
+	for name := range values {
+		supplied = append(supplied, name)
+	}
+	sort.Strings(supplied)
+	for _, name := range supplied {
+		if _, ok := declared[name]; !ok {
+			if len(names) == 0 {
+				return fmt.Errorf("unknown parameter %q (the template has no parameters)", name)
+			}
+			return fmt.Errorf("unknown parameter %q (template parameters: %s)", name, strings.Join(names, ", "))
+		}
+	}
+
+	for _, p := range params {
+		value, ok := values[p.Name]
+		if !ok || value == nil {
+			if p.Required {
+				return fmt.Errorf("missing required parameter %q", p.Name)
+			}
+			continue
+		}
+		if err := validateParamValue(p, value); err != nil {
+			return fmt.Errorf("parameter %q %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateParamValue checks a single value against its parameter declaration
+func validateParamValue(p templateParam, value any) error {
+	switch p.Type {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("must be a string")
+		}
+	case "date":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a date (YYYY-MM-DD)")
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return fmt.Errorf("must be a date (YYYY-MM-DD)")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be true or false")
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("must be a number")
+		}
+		if p.Type == "integer" && n != math.Trunc(n) {
+			return fmt.Errorf("must be an integer")
+		}
+		if p.Min != nil && n < *p.Min {
+			return fmt.Errorf("must be at least %s", formatRNumber(*p.Min))
+		}
+		if p.Max != nil && n > *p.Max {
+			return fmt.Errorf("must be at most %s", formatRNumber(*p.Max))
+		}
+	case "array":
+		if _, ok := value.([]any); !ok {
+			return fmt.Errorf("must be an array")
+		}
+	}
+
+	if len(p.Choices) > 0 {
+		for _, choice := range p.Choices {
+			if sameParamValue(choice, value) {
+				return nil
+			}
+		}
+		choices := make([]string, len(p.Choices))
+		for i, choice := range p.Choices {
+			choices[i] = fmt.Sprint(choice)
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(choices, ", "))
+	}
+	return nil
+}
+
+// sameParamValue compares a value decoded from YAML with one decoded from
+// JSON, where all numbers are float64
+func sameParamValue(a, b any) bool {
+	if i, ok := a.(int); ok {
+		a = float64(i)
+	}
+	if i, ok := b.(int); ok {
+		b = float64(i)
+	}
+	return reflect.DeepEqual(a, b)
+}
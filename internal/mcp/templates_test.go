@@ -0,0 +1,175 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const weeklyTemplate = `---
+title: Weekly Sales
+output: html_document
+params:
+  region:
+    label: Sales region
+    value: north
+    input: select
+    choices: [north, south]
+  weeks:
+    value: 4
+    min: 1
+    max: 52
+  start: 2024-01-01
+  threshold: 0.5
+  detailed: false
+  as_of: !r Sys.Date()
+  owner:
+    label: Report owner
+---
+
+Body
+`
+
+// setupTemplateDir points TemplateDir at a temporary directory with the given
+// templates
+func setupTemplateDir(t *testing.T, templates map[string]string) {
+	original := TemplateDir
+	TemplateDir = t.TempDir()
+	t.Cleanup(func() { TemplateDir = original })
+	for name, content := range templates {
+		require.NoError(t, os.WriteFile(filepath.Join(TemplateDir, name), []byte(content), 0644))
+	}
+}
+
+// TestParseTemplateParams tests the parameter declarations understood in front matter
+func TestParseTemplateParams(t *testing.T) {
+	params, err := parseTemplateParams(weeklyTemplate)
+	require.NoError(t, err)
+	require.Len(t, params, 7)
+
+	one, fiftyTwo := 1.0, 52.0
+	assert.Equal(t, templateParam{Name: "region", Type: "string", Default: "north", Label: "Sales region", Choices: []any{"north", "south"}}, params[0])
+	assert.Equal(t, templateParam{Name: "weeks", Type: "integer", Default: 4, Min: &one, Max: &fiftyTwo}, params[1])
+	assert.Equal(t, templateParam{Name: "start", Type: "date", Default: "2024-01-01"}, params[2])
+	assert.Equal(t, templateParam{Name: "threshold", Type: "number", Default: 0.5}, params[3])
+	assert.Equal(t, templateParam{Name: "detailed", Type: "boolean", Default: false}, params[4])
+	assert.Equal(t, templateParam{Name: "as_of"}, params[5])
+	assert.Equal(t, templateParam{Name: "owner", Type: "string", Label: "Report owner", Required: true}, params[6])
+
+	params, err = parseTemplateParams("---\ntitle: No params\n---\n")
+	require.NoError(t, err)
+	assert.Empty(t, params)
+
+	_, err = parseTemplateParams("---\nparams: [a, b]\n---\n")
+	assert.EqualError(t, err, "params must be a mapping")
+}
+
+// TestListReportTemplates tests the listing of templates and their parameter schemas
+func TestListReportTemplates(t *testing.T) {
+	setupTemplateDir(t, map[string]string{
+		"weekly.Rmd": weeklyTemplate,
+		"slides.qmd": "---\ntitle: Slides\n---\n",
+		"notes.txt":  "not a template",
+	})
+
+	response, err := ListReportTemplates(ListReportTemplatesArgs{})
+	require.NoError(t, err)
+
+	var templates []struct {
+		Name       string         `json:"name"`
+		Title      string         `json:"title"`
+		Engine     string         `json:"engine"`
+		Parameters map[string]any `json:"parameters"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(response.Content[0].TextContent.Text), &templates))
+	require.Len(t, templates, 2)
+	assert.Equal(t, "slides", templates[0].Name)
+	assert.Equal(t, "quarto", templates[0].Engine)
+	assert.Equal(t, "weekly", templates[1].Name)
+	assert.Equal(t, "Weekly Sales", templates[1].Title)
+	assert.Equal(t, []any{"owner"}, templates[1].Parameters["required"])
+
+	properties := templates[1].Parameters["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string", "default": "north", "description": "Sales region", "enum": []any{"north", "south"}}, properties["region"])
+	assert.Equal(t, map[string]any{"type": "string", "format": "date", "default": "2024-01-01"}, properties["start"])
+	assert.Equal(t, map[string]any{"type": "integer", "default": 4.0, "minimum": 1.0, "maximum": 52.0}, properties["weeks"])
+
+	_, err = ListReportTemplates(ListReportTemplatesArgs{Name: "missing"})
+	assert.EqualError(t, err, "report template not found: missing")
+}
+
+// TestValidateTemplateParams tests the validation of supplied parameter values
+func TestValidateTemplateParams(t *testing.T) {
+	params, err := parseTemplateParams(weeklyTemplate)
+	require.NoError(t, err)
+
+	assert.NoError(t, validateTemplateParams(params, map[string]any{"owner": "ana", "region": "south", "weeks": 8.0, "start": "2024-03-04", "detailed": true, "as_of": "2024-01-01"}))
+
+	tests := []struct {
+		name     string
+		values   map[string]any
+		errorMsg string
+	}{
+		{"Missing required", map[string]any{}, `missing required parameter "owner"`},
+		{"Unknown", map[string]any{"owner": "ana", "colour": "red"}, `unknown parameter "colour" (template parameters: region, weeks, start, threshold, detailed, as_of, owner)`},
+		{"Bad choice", map[string]any{"owner": "ana", "region": "east"}, `parameter "region" must be one of north, south`},
+		{"Not an integer", map[string]any{"owner": "ana", "weeks": 1.5}, `parameter "weeks" must be an integer`},
+		{"Below minimum", map[string]any{"owner": "ana", "weeks": 0.0}, `parameter "weeks" must be at least 1`},
+		{"Above maximum", map[string]any{"owner": "ana", "weeks": 53.0}, `parameter "weeks" must be at most 52`},
+		{"Bad date", map[string]any{"owner": "ana", "start": "March"}, `parameter "start" must be a date (YYYY-MM-DD)`},
+		{"Bad boolean", map[string]any{"owner": "ana", "detailed": "yes"}, `parameter "detailed" must be true or false`},
+		{"Bad string", map[string]any{"owner": 3.0}, `parameter "owner" must be a string`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, validateTemplateParams(params, tt.values), tt.errorMsg)
+		})
+	}
+}
+
+// TestGenerateReport tests that validated params are passed to the render
+func TestGenerateReport(t *testing.T) {
+	dir := setupRmdDir(t)
+	setupTemplateDir(t, map[string]string{"weekly.Rmd": weeklyTemplate})
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), filepath.Join(TemplateDir, "weekly.Rmd"))
+			assert.Contains(t, string(script), "params = jsonlite::read_json(")
+
+			params, err := os.ReadFile(filepath.Join(filepath.Dir(config.OutputPath), "params.json"))
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"owner":"ana","region":"south"}`, string(params))
+			return []byte("%PDF"), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := GenerateReport(GenerateReportArgs{
+		Template: "weekly",
+		Params:   map[string]any{"owner": "ana", "region": "south"},
+		Format:   "pdf",
+		Filename: "weekly-south",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Successfully rendered weekly.Rmd to weekly-south.pdf", response.Content[0].TextContent.Text)
+	_, err = os.Stat(filepath.Join(dir, "output", "weekly-south.pdf"))
+	assert.NoError(t, err)
+
+	_, err = GenerateReport(GenerateReportArgs{Template: "weekly"})
+	assert.EqualError(t, err, `missing required parameter "owner"`)
+
+	_, err = GenerateReport(GenerateReportArgs{Template: "weekly", Params: map[string]any{"owner": "ana"}, Format: "revealjs"})
+	assert.EqualError(t, err, "format must be html, pdf or word for R Markdown templates")
+
+	_, err = GenerateReport(GenerateReportArgs{Template: "monthly"})
+	assert.EqualError(t, err, "report template not found: monthly")
+}
@@ -0,0 +1,329 @@
+package mcp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// textPlotScript extracts the data of the last plot with ggplot_build and
+// writes it as JSON for the text renderer. It expects plot_data_file to be set.
+const textPlotScript = `
+# Extract the built plot data for the text renderer
+plot_object <- last_plot()
+built <- ggplot_build(plot_object)
+panel <- built$layout$panel_params[[1]]
+x_discrete <- tryCatch(panel$x$is_discrete(), error = function(e) FALSE)
+x_labels <- if (x_discrete) tryCatch(as.character(panel$x$get_labels()), error = function(e) character(0)) else character(0)
+column <- function(d, name, keep) if (!is.null(d[[name]])) I(as.numeric(d[[name]])[keep]) else NULL
+layers <- lapply(seq_along(built$data), function(i) {
+  d <- built$data[[i]]
+  if (is.null(d$x) || is.null(d$y)) return(list(geom = class(plot_object$layers[[i]]$geom)[1]))
+  keep <- is.finite(as.numeric(d$x)) & is.finite(as.numeric(d$y))
+  list(
+    geom = class(plot_object$layers[[i]]$geom)[1],
+    x = column(d, "x", keep),
+    y = column(d, "y", keep),
+    xmin = column(d, "xmin", keep),
+    xmax = column(d, "xmax", keep),
+    ymin = column(d, "ymin", keep),
+    ymax = column(d, "ymax", keep),
+    group = if (!is.null(d$group)) I(as.integer(d$group)[keep]) else NULL
+  )
+})
+label <- function(x) if (is.null(x)) "" else paste(as.character(x), collapse = " ")
+data_summary <- if (is.data.frame(plot_object$data)) {
+  paste(c(sprintf("%d rows x %d columns", nrow(plot_object$data), ncol(plot_object$data)),
+          capture.output(summary(plot_object$data))), collapse = "\n")
+} else ""
+jsonlite::write_json(list(
+  title = label(plot_object$labels$title),
+  x_label = label(plot_object$labels$x),
+  y_label = label(plot_object$labels$y),
+  x_discrete = x_discrete,
+  x_labels = I(x_labels),
+  layers = layers,
+  summary = data_summary
+), plot_data_file, auto_unbox = TRUE, digits = NA, null = "null")
+`
+
+// textPlot is the plot data written by textPlotScript
+type textPlot struct {
+	Title     string          `json:"title"`
+	XLabel    string          `json:"x_label"`
+	YLabel    string          `json:"y_label"`
+	XDiscrete bool            `json:"x_discrete"`
+	XLabels   []string        `json:"x_labels"`
+	Layers    []textPlotLayer `json:"layers"`
+	Summary   string          `json:"summary"`
+}
+
+// textPlotLayer is the built data of a single ggplot layer
+type textPlotLayer struct {
+	Geom  string    `json:"geom"`
+	X     []float64 `json:"x"`
+	Y     []float64 `json:"y"`
+	XMin  []float64 `json:"xmin"`
+	XMax  []float64 `json:"xmax"`
+	YMin  []float64 `json:"ymin"`
+	YMax  []float64 `json:"ymax"`
+	Group []int     `json:"group"`
+}
+
+// textPlotMarkers are the symbols used for the groups of a plot
+var textPlotMarkers = []rune{'●', '○', '◆', '◇', '▲', '△', '■', '□'}
+
+// barGeoms and lineGeoms classify ggplot geoms for the text renderer; any
+// other geom with x and y data is drawn as a scatter plot
+var (
+	barGeoms  = map[string]bool{"GeomBar": true, "GeomCol": true, "GeomRect": true, "GeomTile": true}
+	lineGeoms = map[string]bool{"GeomLine": true, "GeomPath": true, "GeomStep": true, "GeomSmooth": true, "GeomArea": true, "GeomDensity": true}
+)
+
+// textPlotSize converts the requested image size in pixels to a character
+// canvas size
+func textPlotSize(width, height int) (int, int) {
+	cols := clampInt(width/10, 40, 120)
+	rows := clampInt(height/30, 10, 40)
+	return cols, rows
+}
+
+// renderTextPlot draws the plot data as Unicode text. Bar and histogram
+// layers are drawn as horizontal bars; points and lines share a character
+// canvas.
+func renderTextPlot(p textPlot, cols, rows int) string {
+	var b strings.Builder
+	if p.Title != "" {
+		b.WriteString(p.Title + "\n\n")
+	}
+
+	var barLayers, canvasLayers []textPlotLayer
+	for _, layer := range p.Layers {
+		if len(layer.X) == 0 {
+			continue
+		}
+		if barGeoms[layer.Geom] {
+			barLayers = append(barLayers, layer)
+		} else {
+			canvasLayers = append(canvasLayers, layer)
+		}
+	}
+
+	switch {
+	case len(barLayers) == 0 && len(canvasLayers) == 0:
+		b.WriteString("(no drawable layers)\n")
+	case len(canvasLayers) == 0:
+		renderTextBars(&b, p, barLayers, cols)
+	default:
+		renderTextCanvas(&b, p, canvasLayers, cols, rows)
+	}
+
+	if p.Summary != "" {
+		b.WriteString("\nData summary:\n" + p.Summary + "\n")
+	}
+	return b.String()
+}
+
+// renderTextBars draws bar layers as horizontal bars, one line per bar
+func renderTextBars(b *strings.Builder, p textPlot, layers []textPlotLayer, cols int) {
+	type bar struct {
+		label string
+		value float64
+	}
+	var bars []bar
+	maxValue := 0.0
+	for _, layer := range layers {
+		stacked := hasRepeats(layer.X)
+		for i := range layer.X {
+			value := layer.Y[i]
+			if i < len(layer.YMin) && i < len(layer.YMax) {
+				value = layer.YMax[i] - layer.YMin[i]
+			}
+
+			label := formatAxisNumber(layer.X[i])
+			if p.XDiscrete {
+				if idx := int(math.Round(layer.X[i])) - 1; idx >= 0 && idx < len(p.XLabels) {
+					label = p.XLabels[idx]
+				}
+			} else if i < len(layer.XMin) && i < len(layer.XMax) {
+				label = fmt.Sprintf("[%s, %s)", formatAxisNumber(layer.XMin[i]), formatAxisNumber(layer.XMax[i]))
+			}
+			if stacked && i < len(layer.Group) {
+				label = fmt.Sprintf("%s (%d)", label, layer.Group[i])
+			}
+
+			bars = append(bars, bar{label, value})
+			maxValue = math.Max(maxValue, math.Abs(value))
+		}
+	}
+
+	labelWidth := 0
+	for i := range bars {
+		if r := []rune(bars[i].label); len(r) > 20 {
+			bars[i].label = string(r[:19]) + "…"
+		}
+		labelWidth = max(labelWidth, len([]rune(bars[i].label)))
+	}
+
+	if p.YLabel != "" {
+		fmt.Fprintf(b, "%s%s\n", strings.Repeat(" ", labelWidth+2), p.YLabel)
+	}
+	barWidth := max(cols-labelWidth-12, 10)
+	for _, bar := range bars {
+		length := 0.0
+		if maxValue > 0 {
+			length = math.Abs(bar.value) / maxValue * float64(barWidth)
+		}
+		fmt.Fprintf(b, "%s%s │%s %s\n", bar.label, strings.Repeat(" ", labelWidth-len([]rune(bar.label))),
+			blockBar(length), formatAxisNumber(bar.value))
+	}
+	if p.XLabel != "" {
+		fmt.Fprintf(b, "%s\n", p.XLabel)
+	}
+}
+
+// renderTextCanvas draws point and line layers on a character grid with axes
+func renderTextCanvas(b *strings.Builder, p textPlot, layers []textPlotLayer, cols, rows int) {
+	xMin, xMax, yMin, yMax := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, layer := range layers {
+		for i := range layer.X {
+			xMin, xMax = math.Min(xMin, layer.X[i]), math.Max(xMax, layer.X[i])
+			yMin, yMax = math.Min(yMin, layer.Y[i]), math.Max(yMax, layer.Y[i])
+		}
+	}
+	if xMin == xMax {
+		xMin, xMax = xMin-1, xMax+1
+	}
+	if yMin == yMax {
+		yMin, yMax = yMin-1, yMax+1
+	}
+
+	grid := make([][]rune, rows)
+	for r := range grid {
+		grid[r] = []rune(strings.Repeat(" ", cols))
+	}
+	toCell := func(x, y float64) (int, int) {
+		c := int(math.Round((x - xMin) / (xMax - xMin) * float64(cols-1)))
+		r := rows - 1 - int(math.Round((y-yMin)/(yMax-yMin)*float64(rows-1)))
+		return c, r
+	}
+
+	// Markers are assigned per layer and group so that series can be told apart
+	series := 0
+	var legend []string
+	for _, layer := range layers {
+		byGroup := make(map[int][]int)
+		for i := range layer.X {
+			group := 0
+			if i < len(layer.Group) {
+				group = layer.Group[i]
+			}
+			byGroup[group] = append(byGroup[group], i)
+		}
+		groups := make([]int, 0, len(byGroup))
+		for group := range byGroup {
+			groups = append(groups, group)
+		}
+		sort.Ints(groups)
+
+		for _, group := range groups {
+			marker := textPlotMarkers[series%len(textPlotMarkers)]
+			series++
+			legend = append(legend, fmt.Sprintf("%c %s %d", marker, strings.TrimPrefix(layer.Geom, "Geom"), group))
+
+			points := byGroup[group]
+			if lineGeoms[layer.Geom] {
+				sort.Slice(points, func(i, j int) bool { return layer.X[points[i]] < layer.X[points[j]] })
+				for k := 1; k < len(points); k++ {
+					c0, r0 := toCell(layer.X[points[k-1]], layer.Y[points[k-1]])
+					c1, r1 := toCell(layer.X[points[k]], layer.Y[points[k]])
+					steps := max(absInt(c1-c0), absInt(r1-r0), 1)
+					for s := 0; s <= steps; s++ {
+						c := c0 + (c1-c0)*s/steps
+						r := r0 + (r1-r0)*s/steps
+						grid[r][c] = '•'
+					}
+				}
+			}
+			for _, i := range points {
+				c, r := toCell(layer.X[i], layer.Y[i])
+				grid[r][c] = marker
+			}
+		}
+	}
+
+	// Draw the y axis with labels at the top, middle and bottom
+	yLabels := map[int]string{
+		0:        formatAxisNumber(yMax),
+		rows / 2: formatAxisNumber(yMax - (yMax-yMin)*float64(rows/2)/float64(rows-1)),
+		rows - 1: formatAxisNumber(yMin),
+	}
+	labelWidth := 0
+	for _, label := range yLabels {
+		labelWidth = max(labelWidth, len(label))
+	}
+	if p.YLabel != "" {
+		fmt.Fprintf(b, "%s\n", p.YLabel)
+	}
+	for r, row := range grid {
+		tick := "│"
+		if _, ok := yLabels[r]; ok {
+			tick = "┤"
+		}
+		fmt.Fprintf(b, "%*s %s%s\n", labelWidth, yLabels[r], tick, strings.TrimRight(string(row), " "))
+	}
+	fmt.Fprintf(b, "%s └%s\n", strings.Repeat(" ", labelWidth), strings.Repeat("─", cols))
+
+	// Draw the x axis labels
+	left, right := formatAxisNumber(xMin), formatAxisNumber(xMax)
+	if p.XDiscrete && len(p.XLabels) > 0 {
+		left, right = p.XLabels[0], p.XLabels[len(p.XLabels)-1]
+	}
+	gap := max(cols-len([]rune(left))-len([]rune(right)), 1)
+	fmt.Fprintf(b, "%s  %s%s%s\n", strings.Repeat(" ", labelWidth), left, strings.Repeat(" ", gap), right)
+	if p.XLabel != "" {
+		pad := max((cols-len([]rune(p.XLabel)))/2, 0)
+		fmt.Fprintf(b, "%s  %s%s\n", strings.Repeat(" ", labelWidth), strings.Repeat(" ", pad), p.XLabel)
+	}
+	if len(legend) > 1 {
+		fmt.Fprintf(b, "\n%s\n", strings.Join(legend, "   "))
+	}
+}
+
+// blockBar returns a bar of the given length using eighth block characters
+func blockBar(length float64) string {
+	eighths := []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+	full := int(length)
+	return strings.Repeat("█", full) + eighths[int((length-float64(full))*8)]
+}
+
+// formatAxisNumber formats a number with up to four significant digits
+func formatAxisNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', 4, 64)
+}
+
+// hasRepeats reports whether any value occurs more than once in s, as it does
+// for stacked or dodged bars
+func hasRepeats(s []float64) bool {
+	seen := make(map[float64]bool)
+	for _, v := range s {
+		if seen[v] {
+			return true
+		}
+		seen[v] = true
+	}
+	return false
+}
+
+func clampInt(v, lo, hi int) int {
+	return min(max(v, lo), hi)
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
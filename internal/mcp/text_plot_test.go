@@ -0,0 +1,90 @@
+package mcp
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderGGPlotTextMode tests that text mode returns a text rendition instead of an image
+func TestRenderGGPlotTextMode(t *testing.T) {
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "ggplot_build(plot_object)")
+			assert.NotContains(t, string(script), "ggsave(")
+			assert.Contains(t, config.OutputPath, "plot_data.json")
+
+			return []byte(`{
+				"title": "Cars", "x_label": "cyl", "y_label": "count",
+				"x_discrete": true, "x_labels": ["4", "6", "8"],
+				"layers": [{"geom": "GeomBar", "x": [1, 2, 3], "y": [11, 7, 14], "ymin": [0, 0, 0], "ymax": [11, 7, 14], "group": [1, 2, 3]}],
+				"summary": "32 rows x 1 columns"
+			}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := RenderGGPlot(GGPlotRenderArgs{
+		Code:       "ggplot(mtcars, aes(factor(cyl))) + geom_bar()",
+		RenderMode: "text",
+	})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 1)
+	require.NotNil(t, response.Content[0].TextContent)
+
+	text := response.Content[0].TextContent.Text
+	assert.Contains(t, text, "Cars")
+	assert.Contains(t, text, "4 │"+strings.Repeat("█", 52)+"▋ 11\n")
+	assert.Contains(t, text, "8 │"+strings.Repeat("█", 67)+" 14\n")
+	assert.Contains(t, text, "Data summary:\n32 rows x 1 columns")
+}
+
+// TestRenderGGPlotRenderModeValidation tests that unknown render modes are rejected
+func TestRenderGGPlotRenderModeValidation(t *testing.T) {
+	response, err := RenderGGPlot(GGPlotRenderArgs{Code: "ggplot()", RenderMode: "ascii"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "render_mode must be image, text or both")
+	assert.Nil(t, response)
+}
+
+// TestIsRenderMode tests the render modes accepted by the -render-mode flag
+func TestIsRenderMode(t *testing.T) {
+	for _, mode := range []string{"image", "text", "both"} {
+		assert.True(t, IsRenderMode(mode), mode)
+	}
+	for _, mode := range []string{"", "txt", "Image"} {
+		assert.False(t, IsRenderMode(mode), mode)
+	}
+}
+
+// TestRenderTextCanvas tests that points and lines are drawn on a canvas with axes
+func TestRenderTextCanvas(t *testing.T) {
+	plot := textPlot{
+		XLabel: "mpg",
+		YLabel: "hp",
+		Layers: []textPlotLayer{
+			{Geom: "GeomPoint", X: []float64{10, 20, 30}, Y: []float64{100, 200, 300}, Group: []int{-1, -1, -1}},
+			{Geom: "GeomLine", X: []float64{10, 30}, Y: []float64{300, 100}, Group: []int{1, 1}},
+		},
+	}
+
+	text := renderTextPlot(plot, 40, 10)
+	lines := strings.Split(text, "\n")
+	require.GreaterOrEqual(t, len(lines), 13)
+
+	assert.Equal(t, "hp", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "  300 ┤○••"), lines[1])
+	assert.True(t, strings.HasSuffix(lines[1], "●"), lines[1])
+	assert.True(t, strings.HasPrefix(lines[10], "  100 ┤●"), lines[10])
+	assert.True(t, strings.HasSuffix(lines[10], "○"), lines[10])
+	assert.Contains(t, lines[11], "└"+strings.Repeat("─", 40))
+	assert.Contains(t, lines[12], "10")
+	assert.Contains(t, lines[12], "30")
+	assert.Contains(t, text, "● Point -1   ○ Line 1")
+}
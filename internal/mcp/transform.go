@@ -0,0 +1,445 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	mcp "github.com/metoro-io/mcp-golang"
+)
+
+// maxTransformSteps bounds the length of a transform_data pipeline
+const maxTransformSteps = 50
+
+// transformPreviewRows is the number of result rows shown as markdown
+const transformPreviewRows = 10
+
+// transformFunctions are the functions that filter, mutate and summarise
+// expressions may call: the math functions, summaries and the vectorized
+// helpers of dplyr and base R
+var transformFunctions = map[string]bool{
+	"c": true, "n": true, "n_distinct": true, "sum": true, "mean": true, "median": true,
+	"min": true, "max": true, "sd": true, "var": true, "quantile": true, "IQR": true,
+	"first": true, "last": true, "nth": true, "any": true, "all": true,
+	"if_else": true, "case_when": true, "coalesce": true, "na_if": true, "between": true,
+	"lag": true, "lead": true, "cumsum": true, "cumprod": true, "cummin": true, "cummax": true, "cummean": true,
+	"row_number": true, "min_rank": true, "dense_rank": true, "percent_rank": true, "ntile": true,
+	"nchar": true, "toupper": true, "tolower": true, "trimws": true, "substr": true, "paste": true, "paste0": true,
+	"startsWith": true, "endsWith": true, "grepl": true, "sub": true, "gsub": true, "format": true,
+	"as.numeric": true, "as.integer": true, "as.character": true, "as.logical": true, "as.Date": true,
+	"as.factor": true, "factor": true, "weekdays": true, "months": true,
+}
+
+func init() {
+	for name := range mathFunctions {
+		transformFunctions[name] = true
+	}
+}
+
+// joinTypes are the join steps supported by transform_data
+var joinTypes = map[string]bool{"left": true, "inner": true, "right": true, "full": true, "semi": true, "anti": true}
+
+// TransformStep is a step of a transform_data pipeline. Op selects the step
+// and the fields it uses.
+type TransformStep struct {
+	Op         string                `json:"op" jsonschema:"required,description=Step (filter, select, mutate, group_by, summarise, arrange, join, pivot_longer, pivot_wider)"`
+	Condition  string                `json:"condition,omitempty" jsonschema:"description=filter: condition over the columns such as revenue > 0 & region == 'EU'"`
+	Columns    []string              `json:"columns,omitempty" jsonschema:"description=select: columns kept or dropped with a leading -; group_by: grouping columns; arrange: sort columns with a leading - for descending order; pivot_longer: columns gathered"`
+	Compute    []TransformExpression `json:"compute,omitempty" jsonschema:"description=mutate and summarise: columns computed in order"`
+	Dataset    string                `json:"dataset,omitempty" jsonschema:"description=join: name of the dataset joined"`
+	By         []string              `json:"by,omitempty" jsonschema:"description=join: key columns; name=other for keys named differently in the joined dataset"`
+	Type       string                `json:"type,omitempty" jsonschema:"description=join: left; inner; right; full; semi or anti (default left)"`
+	NamesTo    string                `json:"names_to,omitempty" jsonschema:"description=pivot_longer: column receiving the gathered column names (default name)"`
+	ValuesTo   string                `json:"values_to,omitempty" jsonschema:"description=pivot_longer: column receiving the gathered values (default value)"`
+	NamesFrom  string                `json:"names_from,omitempty" jsonschema:"description=pivot_wider: column holding the new column names"`
+	ValuesFrom string                `json:"values_from,omitempty" jsonschema:"description=pivot_wider: column holding the values"`
+}
+
+// TransformExpression is a column computed by a mutate or summarise step
+type TransformExpression struct {
+	Name string `json:"name" jsonschema:"required,description=Name of the computed column"`
+	Expr string `json:"expr" jsonschema:"required,description=R expression over the columns; call arguments may be named as in na.rm = TRUE"`
+}
+
+// TransformDataArgs represents the arguments for transforming a dataset
+type TransformDataArgs struct {
+	Dataset string          `json:"dataset,omitempty" jsonschema:"description=Name of a catalog or uploaded dataset; either dataset or data is required"`
+	Data    string          `json:"data,omitempty" jsonschema:"description=R code evaluating to a data frame; datasets can be used by name"`
+	Steps   []TransformStep `json:"steps" jsonschema:"required,description=Steps applied in order"`
+	Name    string          `json:"name" jsonschema:"required,description=Name of the dataset storing the result"`
+
+	BundleOption
+}
+
+// transformDataScript runs the compiled steps one at a time and stores the
+// result as an .rds file, along with a preview table of its first rows. Before
+// a step runs, the names its expressions use are checked against the columns
+// at that point, counting the columns computed earlier in the same step, so
+// expressions cannot reach other variables. It is included in the local
+// environment of the driver, which provides load_data, steps, packages,
+// rds_file, preview_rows and output_file.
+const transformDataScript = tablePreviewScript + `
+fail <- function(msg) {
+  message("Error: ", msg)
+  quit(save = "no", status = 1)
+}
+suppressPackageStartupMessages(for (pkg in packages) library(pkg, character.only = TRUE))
+
+result <- tryCatch(load_data(), error = function(e) fail(conditionMessage(e)))
+if (is.matrix(result)) result <- as.data.frame(result, stringsAsFactors = FALSE)
+if (!is.data.frame(result)) fail(paste("data must evaluate to a data frame, not", class(result)[1]))
+
+for (i in seq_along(steps)) {
+  step <- steps[[i]]
+  where <- paste0("step ", i, " (", step$op, "): ")
+  known <- c(names(result), "T", "F", "pi")
+  for (j in seq_along(step$exprs)) {
+    unknown <- setdiff(all.vars(parse(text = step$exprs[[j]], keep.source = FALSE)), known)
+    if (length(unknown) > 0) fail(paste0(where, "unknown column in expression: ", paste(unknown, collapse = ", ")))
+    known <- c(known, step$names[[j]])
+  }
+  call <- parse(text = paste("result |>", step$call), keep.source = FALSE)[[1]]
+  result <- tryCatch(eval(call, list(result = result), globalenv()),
+    error = function(e) fail(paste0(where, conditionMessage(e))))
+}
+if (!is.data.frame(result)) fail(paste("the steps must produce a data frame, not", class(result)[1]))
+result <- as.data.frame(result, stringsAsFactors = FALSE)
+saveRDS(result, rds_file)
+
+jsonlite::write_json(list(
+  rows = nrow(result),
+  columns = lapply(names(result), function(n) list(name = n, type = class(result[[n]])[1])),
+  table = table_preview(result, preview_rows)
+), output_file, auto_unbox = TRUE, digits = NA)
+`
+
+// transformCall is a compiled step: its dplyr or tidyr call, and the
+// expressions it evaluates over the columns with the names of the columns
+// they compute
+type transformCall struct {
+	Op    string
+	Code  string
+	Exprs []string
+	Names []string
+}
+
+// TransformData compiles a list of declarative steps to dplyr code, runs it
+// and stores the result as a dataset. The generated code is returned so that
+// the transformation can be audited.
+func TransformData(args TransformDataArgs) (*mcp.ToolResponse, error) {
+	// Validate arguments
+	loadData, inputs, err := dataLoadCode(args.Dataset, args.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDatasetName("name", args.Name); err != nil {
+		return nil, err
+	}
+
+	calls, usesTidyr, err := transformPipeline(args.Steps)
+	if err != nil {
+		return nil, err
+	}
+	code := transformCode(args, calls, usesTidyr)
+
+	// Joined datasets are found by name
+	datasetCode, err := datasetPreamble()
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range args.Steps {
+		if step.Op == "join" {
+			d, err := findDataset(step.Dataset)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, d.Path)
+		}
+	}
+
+	job, err := newRJob("transform-data-")
+	if err != nil {
+		return nil, err
+	}
+	defer job.Close()
+
+	packages := []string{rQuote("dplyr")}
+	if usesTidyr {
+		packages = append(packages, rQuote("tidyr"))
+	}
+	steps := make([]string, len(calls))
+	for i, call := range calls {
+		exprs := make([]string, len(call.Exprs))
+		names := make([]string, len(call.Names))
+		for j := range call.Exprs {
+			exprs[j] = rQuote(call.Exprs[j])
+			names[j] = rQuote(call.Names[j])
+		}
+		steps[i] = fmt.Sprintf("  list(op = %s, call = %s, exprs = c(%s), names = c(%s))",
+			rQuote(call.Op), rQuote(call.Code), strings.Join(exprs, ", "), strings.Join(names, ", "))
+	}
+
+	// The driver keeps its state in a local environment, so neither the
+	// expressions nor the result name can reach it
+	scriptContent := fmt.Sprintf(`
+%slocal({
+load_data <- function() %s
+steps <- list(
+%s
+)
+packages <- c(%s)
+rds_file <- %s
+preview_rows <- %d
+output_file <- %s
+%s})
+`, datasetCode, loadData, strings.Join(steps, ",\n"), strings.Join(packages, ", "), rQuote(job.Path("result.rds")),
+		transformPreviewRows, rQuote(job.Path("output.json")), transformDataScript)
+
+	outputData, err := job.Run(scriptContent, "output.json", RExecutionConfig{Inputs: inputs})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		datasetSummary
+		Table renderedTable `json:"table"`
+	}
+	if err := json.Unmarshal(outputData, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse transformation result: %w", err)
+	}
+
+	rds, err := job.ReadFile("result.rds")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := storeDataset(args.Name, rds); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stored dataset %s with %d rows and %d columns. Later execute_r_script and render_ggplot calls can use it as the data frame `%s`.\n\n",
+		args.Name, result.Rows, len(result.Columns), args.Name)
+	b.WriteString(markdownTable(result.Table, "", ""))
+
+	content := []*mcp.Content{
+		mcp.NewTextContent(b.String()),
+		mcp.NewTextContent("Generated code:\n\n```r\n" + code + "\n```"),
+	}
+
+	session.record("transform_data", code, contentOutputs(content[:1]))
+	return mcp.NewToolResponse(content...), nil
+}
+
+// transformPipeline validates the steps and compiles them to dplyr and tidyr
+// calls, ending with ungroup() when a grouping is left. It also reports
+// whether tidyr is needed.
+func transformPipeline(steps []TransformStep) ([]transformCall, bool, error) {
+	if len(steps) == 0 {
+		return nil, false, fmt.Errorf("steps are required")
+	}
+	if len(steps) > maxTransformSteps {
+		return nil, false, fmt.Errorf("at most %d steps are allowed", maxTransformSteps)
+	}
+
+	var calls []transformCall
+	usesTidyr := false
+	grouped := false
+	for i, step := range steps {
+		call, err := transformStepCode(step)
+		if err != nil {
+			return nil, false, fmt.Errorf("step %d (%s): %w", i+1, step.Op, err)
+		}
+		calls = append(calls, call)
+
+		switch step.Op {
+		case "group_by":
+			grouped = true
+		case "summarise":
+			grouped = false
+		case "pivot_longer", "pivot_wider":
+			usesTidyr = true
+		}
+	}
+	if grouped {
+		calls = append(calls, transformCall{Op: "ungroup", Code: "ungroup()"})
+	}
+	return calls, usesTidyr, nil
+}
+
+// transformCode returns the compiled steps as a dplyr pipeline assigning the
+// result to the dataset name
+func transformCode(args TransformDataArgs, calls []transformCall, usesTidyr bool) string {
+	source := rName(args.Dataset)
+	if args.Dataset == "" {
+		source = "(" + args.Data + ")"
+	}
+
+	codes := make([]string, len(calls))
+	for i, call := range calls {
+		codes[i] = call.Code
+	}
+
+	var b strings.Builder
+	b.WriteString("library(dplyr)\n")
+	if usesTidyr {
+		b.WriteString("library(tidyr)\n")
+	}
+	fmt.Fprintf(&b, "\n%s <- %s |>\n  %s", rName(args.Name), source, strings.Join(codes, " |>\n  "))
+	return b.String()
+}
+
+// transformStepCode validates a step and returns its dplyr or tidyr call.
+// Expressions are checked for names here only when they call functions; the
+// names are checked against the columns in R.
+func transformStepCode(step TransformStep) (transformCall, error) {
+	// Each step only accepts its own fields
+	used := map[string]bool{
+		"condition":   step.Condition != "",
+		"columns":     len(step.Columns) > 0,
+		"compute":     len(step.Compute) > 0,
+		"dataset":     step.Dataset != "",
+		"by":          len(step.By) > 0,
+		"type":        step.Type != "",
+		"names_to":    step.NamesTo != "",
+		"values_to":   step.ValuesTo != "",
+		"names_from":  step.NamesFrom != "",
+		"values_from": step.ValuesFrom != "",
+	}
+	allowed := map[string][]string{
+		"filter":       {"condition"},
+		"select":       {"columns"},
+		"mutate":       {"compute"},
+		"group_by":     {"columns"},
+		"summarise":    {"compute"},
+		"arrange":      {"columns"},
+		"join":         {"dataset", "by", "type"},
+		"pivot_longer": {"columns", "names_to", "values_to"},
+		"pivot_wider":  {"names_from", "values_from"},
+	}
+	fields, ok := allowed[step.Op]
+	if !ok {
+		return transformCall{}, fmt.Errorf("op must be filter, select, mutate, group_by, summarise, arrange, join, pivot_longer or pivot_wider")
+	}
+	for _, field := range []string{"condition", "columns", "compute", "dataset", "by", "type", "names_to", "values_to", "names_from", "values_from"} {
+		if used[field] && !slices.Contains(fields, field) {
+			return transformCall{}, fmt.Errorf("%s cannot be used with %s", field, step.Op)
+		}
+	}
+
+	switch step.Op {
+	case "filter":
+		if step.Condition == "" {
+			return transformCall{}, fmt.Errorf("condition is required")
+		}
+		if err := validateRExpression(step.Condition, nil, transformFunctions); err != nil {
+			return transformCall{}, fmt.Errorf("invalid condition: %w", err)
+		}
+		return transformCall{Op: step.Op, Code: fmt.Sprintf("filter(%s)", step.Condition), Exprs: []string{step.Condition}, Names: []string{""}}, nil
+
+	case "select", "group_by", "arrange":
+		if len(step.Columns) == 0 {
+			return transformCall{}, fmt.Errorf("columns are required")
+		}
+		columns := make([]string, len(step.Columns))
+		for i, column := range step.Columns {
+			name, negated := strings.CutPrefix(column, "-")
+			if name == "" {
+				return transformCall{}, fmt.Errorf("column name is required")
+			}
+			switch {
+			case !negated || step.Op == "group_by":
+				if negated {
+					return transformCall{}, fmt.Errorf("group_by columns cannot start with -")
+				}
+				columns[i] = rName(name)
+			case step.Op == "select":
+				columns[i] = "-" + rName(name)
+			default:
+				columns[i] = "desc(" + rName(name) + ")"
+			}
+		}
+		return transformCall{Op: step.Op, Code: fmt.Sprintf("%s(%s)", step.Op, strings.Join(columns, ", "))}, nil
+
+	case "mutate", "summarise":
+		if len(step.Compute) == 0 {
+			return transformCall{}, fmt.Errorf("compute is required")
+		}
+		call := transformCall{Op: step.Op}
+		assignments := make([]string, len(step.Compute))
+		for i, column := range step.Compute {
+			if column.Name == "" {
+				return transformCall{}, fmt.Errorf("name of computed column is required")
+			}
+			if err := validateRExpression(column.Expr, nil, transformFunctions); err != nil {
+				return transformCall{}, fmt.Errorf("invalid expression for %s: %w", column.Name, err)
+			}
+			assignments[i] = rName(column.Name) + " = " + column.Expr
+			call.Exprs = append(call.Exprs, column.Expr)
+			call.Names = append(call.Names, column.Name)
+		}
+		if step.Op == "summarise" {
+			assignments = append(assignments, `.groups = "drop"`)
+		}
+		call.Code = fmt.Sprintf("%s(%s)", step.Op, strings.Join(assignments, ", "))
+		return call, nil
+
+	case "join":
+		if step.Dataset == "" {
+			return transformCall{}, fmt.Errorf("dataset is required")
+		}
+		if _, err := findDataset(step.Dataset); err != nil {
+			return transformCall{}, err
+		}
+		joinType := step.Type
+		if joinType == "" {
+			joinType = "left"
+		}
+		if !joinTypes[joinType] {
+			return transformCall{}, fmt.Errorf("type must be left, inner, right, full, semi or anti")
+		}
+		if len(step.By) == 0 {
+			return transformCall{}, fmt.Errorf("by is required")
+		}
+		keys := make([]string, len(step.By))
+		for i, key := range step.By {
+			left, right, renamed := strings.Cut(key, "=")
+			left, right = strings.TrimSpace(left), strings.TrimSpace(right)
+			switch {
+			case left == "" || (renamed && right == ""):
+				return transformCall{}, fmt.Errorf("invalid key %q", key)
+			case renamed:
+				keys[i] = rQuote(left) + " = " + rQuote(right)
+			default:
+				keys[i] = rQuote(left)
+			}
+		}
+		return transformCall{Op: step.Op, Code: fmt.Sprintf("%s_join(%s, by = c(%s))", joinType, rName(step.Dataset), strings.Join(keys, ", "))}, nil
+
+	case "pivot_longer":
+		if len(step.Columns) == 0 {
+			return transformCall{}, fmt.Errorf("columns are required")
+		}
+		columns := make([]string, len(step.Columns))
+		for i, column := range step.Columns {
+			if column == "" {
+				return transformCall{}, fmt.Errorf("column name is required")
+			}
+			columns[i] = rName(column)
+		}
+		namesTo, valuesTo := step.NamesTo, step.ValuesTo
+		if namesTo == "" {
+			namesTo = "name"
+		}
+		if valuesTo == "" {
+			valuesTo = "value"
+		}
+		return transformCall{Op: step.Op, Code: fmt.Sprintf("pivot_longer(c(%s), names_to = %s, values_to = %s)", strings.Join(columns, ", "), rQuote(namesTo), rQuote(valuesTo))}, nil
+
+	default:
+		if step.NamesFrom == "" || step.ValuesFrom == "" {
+			return transformCall{}, fmt.Errorf("names_from and values_from are required")
+		}
+		return transformCall{Op: step.Op, Code: fmt.Sprintf("pivot_wider(names_from = %s, values_from = %s)", rName(step.NamesFrom), rName(step.ValuesFrom))}, nil
+	}
+}
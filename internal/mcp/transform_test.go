@@ -0,0 +1,153 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTransformData tests that the compiled pipeline is run and its result
+// stored as a dataset
+func TestTransformData(t *testing.T) {
+	setupCatalog(t)
+	dataDir := setupDataDir(t)
+	setupSession(t)
+
+	steps := []TransformStep{
+		{Op: "filter", Condition: "!is.na(region)"},
+		{Op: "group_by", Columns: []string{"region"}},
+		{Op: "summarise", Compute: []TransformExpression{{Name: "stores", Expr: "n()"}}},
+	}
+	code := "library(dplyr)\n\nby_region <- regions |>\n  filter(!is.na(region)) |>\n  group_by(region) |>\n  summarise(stores = n(), .groups = \"drop\")"
+
+	mockExecutor := &MockRExecutor{
+		MockExecuteRScript: func(config RExecutionConfig) ([]byte, error) {
+			script, err := os.ReadFile(config.ScriptPath)
+			require.NoError(t, err)
+			assert.Contains(t, string(script), "delayedAssign(\"regions\"")
+			assert.Contains(t, string(script), "local({\nload_data <- function() utils::read.csv(")
+			assert.Contains(t, string(script), "steps <- list(\n"+
+				"  list(op = \"filter\", call = \"filter(!is.na(region))\", exprs = c(\"!is.na(region)\"), names = c(\"\")),\n"+
+				"  list(op = \"group_by\", call = \"group_by(region)\", exprs = c(), names = c()),\n"+
+				"  list(op = \"summarise\", call = \"summarise(stores = n(), .groups = \\\"drop\\\")\", exprs = c(\"n()\"), names = c(\"stores\"))\n)\n"+
+				"packages <- c(\"dplyr\")\n")
+
+			require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(config.OutputPath), "result.rds"), []byte("mock-rds"), 0644))
+			return []byte(`{"rows": 2, "columns": [{"name": "region", "type": "character"}, {"name": "stores", "type": "integer"}],
+				"table": {"total_rows": 2, "columns": [{"label": "region", "align": "left"}, {"label": "stores", "align": "right"}],
+				"rows": [{"group": "", "cells": ["north", "12"], "highlighted": [false, false]}, {"group": "", "cells": ["south", "7"], "highlighted": [false, false]}]}}`), nil
+		},
+	}
+	cleanup := SetupMockExecutor(mockExecutor)
+	defer cleanup()
+
+	response, err := TransformData(TransformDataArgs{Dataset: "regions", Steps: steps, Name: "by_region"})
+	require.NoError(t, err)
+	require.Len(t, response.Content, 2)
+	assert.Equal(t, "Stored dataset by_region with 2 rows and 2 columns. Later execute_r_script and render_ggplot calls can use it as the data frame `by_region`.\n\n"+
+		"| region | stores |\n| :--- | ---: |\n| north | 12 |\n| south | 7 |\n", response.Content[0].TextContent.Text)
+	assert.Equal(t, "Generated code:\n\n```r\n"+code+"\n```", response.Content[1].TextContent.Text)
+
+	data, err := os.ReadFile(filepath.Join(dataDir, "by_region.rds"))
+	require.NoError(t, err)
+	assert.Equal(t, "mock-rds", string(data))
+	assert.Equal(t, code, session.snapshot()[0].Code)
+}
+
+// TestTransformCode tests the code generated for each step
+func TestTransformCode(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+
+	args := TransformDataArgs{
+		Data: "mtcars",
+		Name: "wide",
+		Steps: []TransformStep{
+			{Op: "select", Columns: []string{"cyl", "gear", "mpg", "-am", "fuel type"}},
+			{Op: "mutate", Compute: []TransformExpression{
+				{Name: "kpl", Expr: "round(mpg * 0.425, digits = 1)"},
+				{Name: "heavy car", Expr: "if_else(wt > 3.5, 'yes', 'no')"},
+			}},
+			{Op: "arrange", Columns: []string{"cyl", "-mpg"}},
+			{Op: "join", Dataset: "regions", By: []string{"cyl", "gear = gears"}, Type: "inner"},
+			{Op: "group_by", Columns: []string{"cyl"}},
+			{Op: "mutate", Compute: []TransformExpression{{Name: "rank", Expr: "row_number()"}}},
+			{Op: "pivot_longer", Columns: []string{"kpl", "mpg"}, NamesTo: "unit"},
+			{Op: "pivot_wider", NamesFrom: "unit", ValuesFrom: "value"},
+		},
+	}
+	calls, usesTidyr, err := transformPipeline(args.Steps)
+	require.NoError(t, err)
+	assert.True(t, usesTidyr)
+	assert.Equal(t, transformCall{
+		Op:    "mutate",
+		Code:  "mutate(kpl = round(mpg * 0.425, digits = 1), `heavy car` = if_else(wt > 3.5, 'yes', 'no'))",
+		Exprs: []string{"round(mpg * 0.425, digits = 1)", "if_else(wt > 3.5, 'yes', 'no')"},
+		Names: []string{"kpl", "heavy car"},
+	}, calls[1])
+	assert.Equal(t, transformCall{Op: "ungroup", Code: "ungroup()"}, calls[len(calls)-1])
+
+	code := transformCode(args, calls, usesTidyr)
+	assert.Equal(t, "library(dplyr)\nlibrary(tidyr)\n\nwide <- (mtcars) |>\n"+
+		"  select(cyl, gear, mpg, -am, `fuel type`) |>\n"+
+		"  mutate(kpl = round(mpg * 0.425, digits = 1), `heavy car` = if_else(wt > 3.5, 'yes', 'no')) |>\n"+
+		"  arrange(cyl, desc(mpg)) |>\n"+
+		"  inner_join(regions, by = c(\"cyl\", \"gear\" = \"gears\")) |>\n"+
+		"  group_by(cyl) |>\n"+
+		"  mutate(rank = row_number()) |>\n"+
+		"  pivot_longer(c(kpl, mpg), names_to = \"unit\", values_to = \"value\") |>\n"+
+		"  pivot_wider(names_from = unit, values_from = value) |>\n"+
+		"  ungroup()", code)
+}
+
+// TestTransformDataValidation tests the validation of the pipeline
+func TestTransformDataValidation(t *testing.T) {
+	setupCatalog(t)
+	setupDataDir(t)
+
+	filter := []TransformStep{{Op: "filter", Condition: "x > 1"}}
+	tests := []struct {
+		name     string
+		args     TransformDataArgs
+		errorMsg string
+	}{
+		{"No data", TransformDataArgs{Steps: filter, Name: "out"}, "either dataset or data is required"},
+		{"Unknown dataset", TransformDataArgs{Dataset: "missing", Steps: filter, Name: "out"}, "dataset not found: missing"},
+		{"Bad name", TransformDataArgs{Dataset: "regions", Steps: filter, Name: "my result"}, "name must be a valid R name"},
+		{"Constant name", TransformDataArgs{Dataset: "regions", Steps: filter, Name: "month.abb"}, "name cannot be month.abb, which would shadow the R constant"},
+		{"Catalog name", TransformDataArgs{Dataset: "regions", Steps: filter, Name: "sales"}, "name is used by the catalog dataset sales"},
+		{"No steps", TransformDataArgs{Dataset: "regions", Name: "out"}, "steps are required"},
+		{"Unknown op", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "slice"}}},
+			"step 1 (slice): op must be filter, select, mutate, group_by, summarise, arrange, join, pivot_longer or pivot_wider"},
+		{"Foreign field", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "filter", Condition: "x > 1", Columns: []string{"x"}}}},
+			"step 1 (filter): columns cannot be used with filter"},
+		{"Code in condition", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "filter", Condition: "file.remove('data.csv')"}}},
+			"invalid condition: function not allowed in expression: file.remove"},
+		{"Assignment in mutate", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "select", Columns: []string{"x"}}, {Op: "mutate", Compute: []TransformExpression{{Name: "y", Expr: "x <- 1"}}}}},
+			"step 2 (mutate): invalid expression for y: <- is not allowed"},
+		{"Unnamed column", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "summarise", Compute: []TransformExpression{{Expr: "n()"}}}}},
+			"name of computed column is required"},
+		{"Negated group", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "group_by", Columns: []string{"-x"}}}},
+			"group_by columns cannot start with -"},
+		{"Unknown join dataset", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "join", Dataset: "crm", By: []string{"id"}}}},
+			"dataset not found: crm"},
+		{"Bad join type", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "join", Dataset: "sales", By: []string{"id"}, Type: "cross"}}},
+			"type must be left, inner, right, full, semi or anti"},
+		{"Bad join key", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "join", Dataset: "sales", By: []string{"id="}}}},
+			`invalid key "id="`},
+		{"Incomplete pivot", TransformDataArgs{Dataset: "regions", Name: "out", Steps: []TransformStep{{Op: "pivot_wider", NamesFrom: "unit"}}},
+			"names_from and values_from are required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := TransformData(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			assert.Nil(t, response)
+		})
+	}
+}